@@ -0,0 +1,178 @@
+package socketio
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrAckTimeout is passed to the ack callback when the acknowledgement did
+	// not arrive in time.
+	ErrAckTimeout = errors.New("acknowledgement timed out")
+
+	// ErrAckNotSupported is used when the codec can not carry acknowledgements.
+	ErrAckNotSupported = errors.New("codec does not support acknowledgements")
+
+	// ErrNoAckRequested is used when a message that did not request an
+	// acknowledgement with data is being acknowledged.
+	ErrNoAckRequested = errors.New("message does not request an acknowledgement")
+)
+
+// AckRequest is a message tagged with an id that the client must acknowledge.
+type ackRequest struct {
+	id   int
+	data interface{}
+}
+
+// AckReply acknowledges the client's message with the id. If args is not nil,
+// it is sent along with the acknowledgement.
+type ackReply struct {
+	id   int
+	args []interface{}
+}
+
+// PendingAck holds the callback of a message waiting for an acknowledgement.
+type pendingAck struct {
+	callback func(Message, error)
+	timer    *time.Timer
+}
+
+// SendWithAck queues data for a delivery just like Send, but it also requests
+// the client to acknowledge the message. When the acknowledgement arrives, f is
+// invoked with the reply, whose Data holds the JSON encoded array of the arguments
+// sent by the client (if any). If the acknowledgement does not arrive within
+// the timeout, f is invoked with ErrAckTimeout instead. If the connection gets
+// disconnected before either happens, f is invoked with ErrDestroyed, and if
+// the queued message is evicted to make room for another one, with
+// ErrQueueFull. A full send queue is handled according to the
+// Config.OverflowPolicy, like with Send, and if SendWithAck returns an error, f
+// is not invoked. A timeout of zero or less waits forever. Acknowledgements
+// require a codec that supports them, such as the SIO07Codec.
+func (c *Conn) SendWithAck(data interface{}, f func(reply Message, err error), timeout time.Duration) error {
+	if !c.sio.supportsPackets() {
+		return ErrAckNotSupported
+	}
+
+	c.mutex.Lock()
+	c.lastAckID++
+	id := c.lastAckID
+	c.mutex.Unlock()
+
+	// the ack is pending by the time the flusher can write the request
+	return c.sendQueued(ackRequest{id, data}, func() {
+		a := &pendingAck{callback: f}
+		if c.pendingAcks == nil {
+			c.pendingAcks = make(map[int]*pendingAck)
+		}
+		c.pendingAcks[id] = a
+
+		if timeout > 0 {
+			a.timer = time.AfterFunc(timeout, func() {
+				if a := c.popAck(id); a != nil {
+					a.callback(nil, ErrAckTimeout)
+				}
+			})
+		}
+	})
+}
+
+// Ack acknowledges msg with the given arguments. It must be used with the
+// messages passed to the OnMessage callback whose sender requested an
+// acknowledgement with data. The other messages carrying an id are acknowledged
+// automatically and the events are acknowledged with the return values of their
+// handlers.
+func (c *Conn) Ack(msg Message, args ...interface{}) error {
+	if !c.sio.supportsPackets() {
+		return ErrAckNotSupported
+	}
+
+	id, ok := ackRequested(msg)
+	if !ok {
+		return ErrNoAckRequested
+	}
+
+	if args == nil {
+		args = []interface{}{}
+	}
+	return c.Send(replyTo(msg, ackReply{id, args}))
+}
+
+// PopAck removes and returns the pending ack with the id, or nil if there is none.
+func (c *Conn) popAck(id int) *pendingAck {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	a, ok := c.pendingAcks[id]
+	if !ok {
+		return nil
+	}
+
+	delete(c.pendingAcks, id)
+	if a.timer != nil {
+		a.timer.Stop()
+	}
+	return a
+}
+
+// AbortAcks invokes the callbacks of all the pending acks with ErrDestroyed.
+// The caller must hold c.mutex.
+func (c *Conn) abortAcks() {
+	for id, a := range c.pendingAcks {
+		delete(c.pendingAcks, id)
+		if a.timer != nil {
+			a.timer.Stop()
+		}
+		go a.callback(nil, ErrDestroyed)
+	}
+}
+
+// ReceiveAck matches an incoming acknowledgement with a pending ack and
+// invokes its callback.
+func (c *Conn) receiveAck(msg Message) {
+	data := msg.Bytes()
+	var args []byte
+
+	if i := bytes.IndexByte(data, '+'); i >= 0 {
+		data, args = data[:i], data[i+1:]
+	}
+
+	id, err := strconv.Atoi(string(data))
+	if err != nil {
+		c.log(LogWarn, "sio/conn: malformed ack", "malformed_ack", "data", msg.Data())
+		return
+	}
+
+	if a := c.popAck(id); a != nil {
+		a.callback(&sio07Message{typ: SIO07PacketAck, id: id, data: args}, nil)
+	} else {
+		c.log(LogWarn, "sio/conn: unexpected ack", "unexpected_ack", "id", id)
+	}
+}
+
+// SupportsPackets reports whether the codec carries the packet fields of the
+// 0.7+ protocol, i.e. message ids, acknowledgements and endpoints.
+func (sio *SocketIO) supportsPackets() bool {
+	_, ok := sio.config.Codec.(SIO07Codec)
+	return ok
+}
+
+// AckID returns the message id of msg, if the message has one.
+func ackID(msg Message) (int, bool) {
+	if s, ok := msg.Annotation(SIO07AnnotationID); ok {
+		if id, err := strconv.Atoi(s); err == nil {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// AckRequested returns the message id of msg if its sender requested an
+// acknowledgement with data.
+func ackRequested(msg Message) (int, bool) {
+	if _, ok := msg.Annotation(SIO07AnnotationAck); !ok {
+		return 0, false
+	}
+	return ackID(msg)
+}
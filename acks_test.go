@@ -0,0 +1,162 @@
+package socketio
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func expectQueued(t *testing.T, c *Conn, expect string) {
+	buf := new(bytes.Buffer)
+
+	select {
+	case msg := <-c.queue:
+		if err := c.enc.Encode(buf, unkeyed(msg)); err != nil {
+			t.Fatal("Encode:", err)
+		}
+	default:
+		t.Fatalf("Expected %q to be queued, but the queue is empty", expect)
+	}
+
+	if buf.String() != sio07Frame(expect) {
+		t.Fatalf("Expected %q but got %q", sio07Frame(expect), buf.String())
+	}
+}
+
+func TestSendWithAck(t *testing.T) {
+	config := DefaultConfig
+	config.Logger = NOPLogger
+	config.Codec = SIO07Codec{}
+	sio := NewSocketIO(&config)
+	c := connectedConn(t, sio)
+
+	replies := make(chan Message, 1)
+	errors := make(chan error, 1)
+	callback := func(reply Message, err error) {
+		if err != nil {
+			errors <- err
+		} else {
+			replies <- reply
+		}
+	}
+
+	if err := c.SendWithAck("hello", callback, 0); err != nil {
+		t.Fatal("SendWithAck:", err)
+	}
+	expectQueued(t, c, "3:1+::hello")
+
+	c.receive("", []byte(`6:::1+["ok",1]`))
+	select {
+	case reply := <-replies:
+		if reply.Type() != MessageAck || reply.Data() != `["ok",1]` {
+			t.Fatalf("Unexpected reply: %#v", reply)
+		}
+	default:
+		t.Fatal("Expected the ack callback to be invoked")
+	}
+
+	if err := c.SendWithAck(struct{ A int }{1}, callback, time.Millisecond); err != nil {
+		t.Fatal("SendWithAck:", err)
+	}
+	expectQueued(t, c, `4:2+::{"A":1}`)
+
+	if err := <-errors; err != ErrAckTimeout {
+		t.Fatalf("Expected ErrAckTimeout but got %v", err)
+	}
+
+	c.receive("", []byte("6:::2"))
+	if len(replies) != 0 {
+		t.Fatal("Did not expect a reply after the timeout")
+	}
+}
+
+func TestSendWithAckNotSupported(t *testing.T) {
+	config := DefaultConfig
+	config.Logger = NOPLogger
+	sio := NewSocketIO(&config)
+	c := connectedConn(t, sio)
+
+	if err := c.SendWithAck("hello", func(Message, error) {}, 0); err != ErrAckNotSupported {
+		t.Fatalf("Expected ErrAckNotSupported but got %v", err)
+	}
+}
+
+func TestReceiveAckRequests(t *testing.T) {
+	config := DefaultConfig
+	config.Logger = NOPLogger
+	config.Codec = SIO07Codec{}
+	sio := NewSocketIO(&config)
+	c := connectedConn(t, sio)
+
+	var received Message
+	sio.OnMessage(func(c *Conn, msg Message) {
+		received = msg
+	})
+	sio.On("sum", func(c *Conn, a, b int) (int, string) {
+		return a + b, "ok"
+	})
+
+	c.receive("", []byte("3:5::hey"))
+	expectQueued(t, c, "6:::5")
+	if received == nil || received.Data() != "hey" {
+		t.Fatalf("Expected the message to be passed on, got %#v", received)
+	}
+
+	c.receive("", []byte(`5:6+::{"name":"sum","args":[1,2]}`))
+	expectQueued(t, c, `6:::6+[3,"ok"]`)
+
+	c.receive("", []byte("3:7+::hey"))
+	if err := c.Ack(received, "thanks"); err != nil {
+		t.Fatal("Ack:", err)
+	}
+	expectQueued(t, c, `6:::7+["thanks"]`)
+
+	c.receive("", []byte("3:::hey"))
+	if err := c.Ack(received); err != ErrNoAckRequested {
+		t.Fatalf("Expected ErrNoAckRequested but got %v", err)
+	}
+}
+
+func TestSendWithAckOverflow(t *testing.T) {
+	c, dropped := overflowConn(t, OverflowDropOldest)
+	<-c.queue
+
+	errors := make(chan error, 2)
+	callback := func(reply Message, err error) {
+		errors <- err
+	}
+
+	// "c" evicts "b" and the second request evicts the first one
+	if err := c.SendWithAck("x", callback, 0); err != nil {
+		t.Fatal("SendWithAck:", err)
+	}
+	if err := c.Send("c"); err != nil {
+		t.Fatal("Send:", err)
+	}
+	if err := c.SendWithAck("y", callback, 0); err != nil {
+		t.Fatal("SendWithAck:", err)
+	}
+	expectDropped(t, dropped, "b:"+DropReasonEvicted, "x:"+DropReasonEvicted)
+	select {
+	case err := <-errors:
+		if err != ErrQueueFull {
+			t.Fatalf("Expected ErrQueueFull but got %v", err)
+		}
+	default:
+		t.Fatal("Expected the callback of the evicted request to be invoked")
+	}
+	expectQueued(t, c, "3:::c")
+	expectQueued(t, c, "3:2+::y")
+
+	c, dropped = overflowConn(t, OverflowDisconnect)
+	if err := c.SendWithAck("x", callback, 0); err != ErrQueueFull {
+		t.Fatalf("Expected ErrQueueFull but got %v", err)
+	}
+	expectDropped(t, dropped, "x:"+DropReasonQueueFull)
+	if !c.disconnected {
+		t.Fatal("Expected the slow connection to be disconnected")
+	}
+	if len(errors) != 0 {
+		t.Fatalf("Did not expect the callback to be invoked but got %v", <-errors)
+	}
+}
@@ -0,0 +1,261 @@
+package socketio
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+)
+
+// Broadcast describes data to be delivered to several connections.
+type Broadcast struct {
+	Room     string      // The room to deliver to, or "" for every connection.
+	Endpoint string      // The namespace to deliver to, or "" for the default endpoint.
+	Except   SessionID   // The session to skip, if any.
+	Data     interface{} // The data to deliver.
+}
+
+// Adapter is the interface that wraps the Init and Broadcast methods. All the
+// broadcasts of the server and its rooms and namespaces go through an adapter,
+// which makes it possible to fan them out to the connections of other servers.
+//
+// Init is invoked once by NewSocketIO with the server using the adapter, so an
+// adapter must not be shared by several servers. Broadcast delivers b to the
+// matching connections, typically by calling DeliverLocal of the server and
+// passing b on to the other servers.
+type Adapter interface {
+	Init(*SocketIO) error
+	Broadcast(*Broadcast) error
+}
+
+// DeliverLocal delivers b to the matching connections of this server.
+func (sio *SocketIO) DeliverLocal(b *Broadcast) {
+	data := b.Data
+	if b.Endpoint != "" {
+		data = endpointed{b.Endpoint, data}
+	}
+
+	sio.sessionsLock.RLock()
+	defer sio.sessionsLock.RUnlock()
+
+	send := func(c *Conn) {
+		if c.sessionid != b.Except && (b.Endpoint == "" || c.namespaces[b.Endpoint]) {
+			c.Send(data)
+		}
+	}
+
+	if b.Room != "" {
+		for c := range sio.rooms[b.Room] {
+			send(c)
+		}
+	} else {
+		for _, c := range sio.sessions {
+			send(c)
+		}
+	}
+}
+
+// Broadcast passes b to the adapter.
+func (sio *SocketIO) broadcast(b *Broadcast) {
+	if err := sio.adapter.Broadcast(b); err != nil {
+		sio.log(LogError, "sio/broadcast: unable to broadcast", "broadcast", LogKeyError, err)
+	}
+}
+
+// SessionIDOf returns the session id of c, or "" if c is nil.
+func sessionIDOf(c *Conn) SessionID {
+	if c == nil {
+		return ""
+	}
+	return c.sessionid
+}
+
+// LocalAdapter is the default adapter that delivers the broadcasts to the
+// connections of its own server only.
+type LocalAdapter struct {
+	sio *SocketIO
+}
+
+func (la *LocalAdapter) Init(sio *SocketIO) error {
+	la.sio = sio
+	return nil
+}
+
+func (la *LocalAdapter) Broadcast(b *Broadcast) error {
+	la.sio.DeliverLocal(b)
+	return nil
+}
+
+// Bus is the interface of a publish/subscribe backplane shared by several
+// servers, e.g. a connection to a message broker.
+//
+// Publish sends data to every subscriber of the channel, including the ones
+// of the publishing server. Subscribe sets f to be invoked with the data
+// published to the channel.
+type Bus interface {
+	Publish(channel string, data []byte) error
+	Subscribe(channel string, f func(data []byte)) error
+}
+
+// The kinds of data carried over the bus.
+const (
+	busKindText = iota
+	busKindJSON
+	busKindEvent
+)
+
+// BusMessage is a broadcast encoded for the bus.
+type busMessage struct {
+	Node     string
+	Room     string
+	Endpoint string
+	Except   SessionID
+	Kind     int
+	Data     json.RawMessage
+}
+
+// PubSubAdapter is an adapter that delivers the broadcasts to the connections
+// of its own server and publishes them to a bus for the other servers. The data
+// of the broadcasts must be a string, []byte, an int, an event or otherwise
+// marshallable by the standard json package.
+type PubSubAdapter struct {
+	sio     *SocketIO
+	bus     Bus
+	channel string
+	node    string
+}
+
+// NewPubSubAdapter creates a new adapter that uses the channel of the bus.
+func NewPubSubAdapter(bus Bus, channel string) *PubSubAdapter {
+	return &PubSubAdapter{bus: bus, channel: channel}
+}
+
+// Init subscribes the adapter to the channel of the bus. The broadcasts are
+// published with the Config.NodeID of the server, so that the server does not
+// deliver its own broadcasts twice.
+func (pa *PubSubAdapter) Init(sio *SocketIO) error {
+	pa.sio = sio
+	pa.node = sio.node
+	return pa.bus.Subscribe(pa.channel, pa.receive)
+}
+
+// Broadcast delivers b locally and publishes it to the bus.
+func (pa *PubSubAdapter) Broadcast(b *Broadcast) (err error) {
+	pa.sio.DeliverLocal(b)
+
+	m := &busMessage{
+		Node:     pa.node,
+		Room:     b.Room,
+		Endpoint: b.Endpoint,
+		Except:   b.Except,
+	}
+
+	switch t := b.Data.(type) {
+	case string:
+		m.Data, err = json.Marshal(t)
+
+	case []byte:
+		m.Data, err = json.Marshal(string(t))
+
+	case int:
+		m.Data, err = json.Marshal(strconv.Itoa(t))
+
+	case event:
+		m.Kind = busKindEvent
+		m.Data, err = json.Marshal(t)
+
+	default:
+		m.Kind = busKindJSON
+		m.Data, err = json.Marshal(t)
+	}
+	if err != nil {
+		return
+	}
+
+	var data []byte
+	if data, err = json.Marshal(m); err != nil {
+		return
+	}
+
+	return pa.bus.Publish(pa.channel, data)
+}
+
+// Receive delivers a broadcast published by another server locally.
+func (pa *PubSubAdapter) receive(data []byte) {
+	var m busMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		pa.sio.log(LogWarn, "sio/pubsub: malformed message", "pubsub_malformed", LogKeyError, err)
+		return
+	}
+
+	if m.Node == pa.node {
+		return
+	}
+
+	b := &Broadcast{
+		Room:     m.Room,
+		Endpoint: m.Endpoint,
+		Except:   m.Except,
+	}
+
+	switch m.Kind {
+	case busKindText:
+		var s string
+		if err := json.Unmarshal(m.Data, &s); err != nil {
+			pa.sio.log(LogWarn, "sio/pubsub: malformed text", "pubsub_malformed", LogKeyError, err)
+			return
+		}
+		b.Data = s
+
+	case busKindEvent:
+		var e struct {
+			Name string
+			Args []json.RawMessage
+		}
+		if err := json.Unmarshal(m.Data, &e); err != nil {
+			pa.sio.log(LogWarn, "sio/pubsub: malformed event", "pubsub_malformed", LogKeyError, err)
+			return
+		}
+		args := make([]interface{}, len(e.Args))
+		for i := range e.Args {
+			args[i] = &e.Args[i]
+		}
+		b.Data = event{e.Name, args}
+
+	default:
+		b.Data = &m.Data
+	}
+
+	pa.sio.DeliverLocal(b)
+}
+
+// MemoryBus is an in-memory bus that can be shared by several servers in the
+// same process, e.g. to test the fan-out of the broadcasts.
+type MemoryBus struct {
+	mutex       sync.RWMutex
+	subscribers map[string][]func([]byte)
+}
+
+// NewMemoryBus creates a new memory bus without subscribers.
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{subscribers: make(map[string][]func([]byte))}
+}
+
+// Publish invokes the subscribers of the channel synchronously.
+func (mb *MemoryBus) Publish(channel string, data []byte) error {
+	mb.mutex.RLock()
+	subscribers := mb.subscribers[channel]
+	mb.mutex.RUnlock()
+
+	for _, f := range subscribers {
+		f(data)
+	}
+	return nil
+}
+
+func (mb *MemoryBus) Subscribe(channel string, f func([]byte)) error {
+	mb.mutex.Lock()
+	defer mb.mutex.Unlock()
+
+	mb.subscribers[channel] = append(mb.subscribers[channel], f)
+	return nil
+}
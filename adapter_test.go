@@ -0,0 +1,75 @@
+package socketio
+
+import "testing"
+
+func TestPubSubAdapter(t *testing.T) {
+	bus := NewMemoryBus()
+
+	config := DefaultConfig
+	config.Logger = NOPLogger
+	config.Codec = SIO07Codec{}
+	config.Adapter = NewPubSubAdapter(bus, "sio")
+	config.NodeID = "node1"
+	node1 := NewSocketIO(&config)
+	config.Adapter = NewPubSubAdapter(bus, "sio")
+	config.NodeID = "node2"
+	node2 := NewSocketIO(&config)
+	if node := node1.adapter.(*PubSubAdapter).node; node != "node1" {
+		t.Fatalf("Expected the adapter to use the node id of the server but got %q", node)
+	}
+
+	a := connectedConn(t, node1)
+	b := connectedConn(t, node2)
+	c := connectedConn(t, node2)
+
+	node1.Broadcast("hello")
+	expectQueued(t, a, "3:::hello")
+	expectQueued(t, b, "3:::hello")
+	expectQueued(t, c, "3:::hello")
+
+	node1.BroadcastExcept(b, struct{ A int }{1})
+	expectQueued(t, a, `4:::{"A":1}`)
+	expectQueued(t, c, `4:::{"A":1}`)
+	if len(b.queue) != 0 {
+		t.Fatal("Did not expect a broadcast to the excepted connection")
+	}
+
+	if err := c.Join("room"); err != nil {
+		t.Fatal("Join:", err)
+	}
+	node1.BroadcastTo("room", event{"tweet", []interface{}{"hi", 1}})
+	expectQueued(t, c, `5:::{"name":"tweet","args":["hi",1]}`)
+	if len(a.queue) != 0 || len(b.queue) != 0 {
+		t.Fatal("Did not expect a room broadcast to the other connections")
+	}
+
+	chat := node2.Of("/chat")
+	node1.Of("/chat")
+	b.receive("", []byte("1::/chat"))
+	expectQueued(t, b, "1::/chat")
+	node1.Of("/chat").Broadcast(123)
+	expectQueued(t, b, "3::/chat:123")
+	if len(a.queue) != 0 || len(c.queue) != 0 {
+		t.Fatal("Did not expect a namespace broadcast to the other connections")
+	}
+
+	chat.Broadcast("local")
+	expectQueued(t, b, "3::/chat:local")
+}
+
+func TestLocalAdapter(t *testing.T) {
+	config := DefaultConfig
+	config.Logger = NOPLogger
+	config.Codec = SIO07Codec{}
+	node1 := NewSocketIO(&config)
+	node2 := NewSocketIO(&config)
+
+	a := connectedConn(t, node1)
+	b := connectedConn(t, node2)
+
+	node1.Broadcast("hello")
+	expectQueued(t, a, "3:::hello")
+	if len(b.queue) != 0 {
+		t.Fatal("Did not expect a broadcast to reach the other server")
+	}
+}
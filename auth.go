@@ -0,0 +1,120 @@
+package socketio
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+var (
+	// ErrUnauthenticated can be returned by an Authorizer to answer the
+	// handshake with 401 Unauthorized.
+	ErrUnauthenticated = &AuthError{Status: http.StatusUnauthorized, Reason: "unauthenticated"}
+
+	// ErrForbidden can be returned by an Authorizer to answer the handshake
+	// with 403 Forbidden.
+	ErrForbidden = &AuthError{Status: http.StatusForbidden, Reason: "forbidden"}
+)
+
+// AuthError is an error returned by an Authorizer to refuse a handshake with
+// the given status and reason. The reason is sent to the client as the body
+// of the response, so it should not reveal anything the client should not
+// know. An Authorizer can wrap an AuthError, e.g. with fmt.Errorf and %w, to
+// log more details than it sends.
+type AuthError struct {
+	Status int    // The status of the response, e.g. http.StatusForbidden.
+	Reason string // The reason sent to the client.
+}
+
+func (e *AuthError) Error() string {
+	return "sio: handshake refused: " + e.Reason
+}
+
+// HandshakeData describes the request that established a session.
+type HandshakeData struct {
+	Header     http.Header    // The headers of the request.
+	Query      url.Values     // The query parameters of the request.
+	Cookies    []*http.Cookie // The cookies of the request.
+	RemoteAddr string         // The remote address of the client in IP:port format.
+	Transport  string         // The resource of the transport, e.g. "websocket".
+	Time       time.Time      // The time of the handshake.
+}
+
+// Cookie returns the cookie with the given name, or nil if there is none.
+func (hd *HandshakeData) Cookie(name string) *http.Cookie {
+	for _, c := range hd.Cookies {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func newHandshakeData(t Transport, req *http.Request) *HandshakeData {
+	return &HandshakeData{
+		Header:     req.Header.Clone(),
+		Query:      req.URL.Query(),
+		Cookies:    req.Cookies(),
+		RemoteAddr: req.RemoteAddr,
+		Transport:  t.Resource(),
+		Time:       time.Now(),
+	}
+}
+
+// Authorizer decides whether a handshake may establish a new session. It
+// returns the identity of the client, e.g. the claims of a token, which is
+// then available through Conn.Identity. A non-nil error refuses the
+// handshake: an AuthError decides the status and the reason of the response,
+// any other error is answered with 401 Unauthorized.
+type Authorizer func(*HandshakeData) (identity interface{}, err error)
+
+// SetAuthorizer sets f to be invoked on every handshake, i.e. a request that
+// would establish a new session or resume a retained one. Unlike the callback
+// of SetAuthorization, which runs on every request, f runs once per session
+// and its result is kept with the connection. Not setting this callback
+// results in a default pass-through with a nil identity.
+func (sio *SocketIO) SetAuthorizer(f Authorizer) error {
+	sio.callbacks.authorizer = f
+	return nil
+}
+
+// Authorize runs the Authorizer for the handshake of a new session. It answers
+// the request and returns false if the handshake is refused.
+func (sio *SocketIO) authorize(t Transport, w http.ResponseWriter, req *http.Request) (data *HandshakeData, identity interface{}, ok bool) {
+	data = newHandshakeData(t, req)
+	if sio.callbacks.authorizer == nil {
+		return data, nil, true
+	}
+
+	identity, err := sio.callbacks.authorizer(data)
+	if err == nil {
+		return data, identity, true
+	}
+
+	status, reason := http.StatusUnauthorized, "unauthorized"
+	var ae *AuthError
+	if errors.As(err, &ae) {
+		status, reason = ae.Status, ae.Reason
+	}
+
+	sio.log(LogWarn, "sio/handle: handshake refused", "handshake_refused", LogKeyTransport, t.Resource(), LogKeyRemoteAddr, req.RemoteAddr, "status", status, LogKeyError, err)
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	sio.reject(t, w, status)
+	w.Write([]byte(reason))
+	return nil, nil, false
+}
+
+// Identity returns the identity the Authorizer returned for the handshake of
+// the session, or nil if there is no Authorizer.
+func (c *Conn) Identity() interface{} {
+	return c.identity
+}
+
+// HandshakeData returns the description of the request that established the
+// session. It must not be modified.
+func (c *Conn) HandshakeData() *HandshakeData {
+	return c.handshakeData
+}
@@ -0,0 +1,87 @@
+package socketio
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestAuthorizer(t *testing.T) {
+	sio, server, connected := testServer(t, nil)
+
+	handshakes := 0
+	sio.SetAuthorizer(func(data *HandshakeData) (interface{}, error) {
+		handshakes++
+		cookie := data.Cookie("token")
+		switch {
+		case cookie == nil:
+			return nil, ErrUnauthenticated
+		case cookie.Value == "banned":
+			return nil, fmt.Errorf("user %s: %w", cookie.Value, &AuthError{Status: http.StatusForbidden, Reason: "banned"})
+		case cookie.Value == "broken":
+			return nil, io.ErrUnexpectedEOF
+		}
+		return "user:" + cookie.Value, nil
+	})
+
+	get := func(url, token string) (int, string) {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			t.Fatal("NewRequest:", err)
+		}
+		req.Header.Set("X-Client", "test")
+		if token != "" {
+			req.AddCookie(&http.Cookie{Name: "token", Value: token})
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal("Do:", err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal("ReadAll:", err)
+		}
+		return resp.StatusCode, string(body)
+	}
+
+	for _, tc := range []struct {
+		token  string
+		status int
+		reason string
+	}{
+		{"", http.StatusUnauthorized, "unauthenticated"},
+		{"banned", http.StatusForbidden, "banned"},
+		{"broken", http.StatusUnauthorized, "unauthorized"},
+	} {
+		status, body := get(server.URL+"/socket.io/xhr-polling", tc.token)
+		if status != tc.status || body != tc.reason {
+			t.Fatalf("%q: expected %d %q but got %d %q", tc.token, tc.status, tc.reason, status, body)
+		}
+	}
+
+	if status, body := get(server.URL+"/socket.io/xhr-polling?room=lobby", "alice"); status != http.StatusOK || !strings.Contains(body, "1::") {
+		t.Fatalf("Expected a handshake but got %d %q", status, body)
+	}
+	c := <-connected
+
+	if id := c.Identity(); id != "user:alice" {
+		t.Fatalf("Expected the identity user:alice but got %v", id)
+	}
+	data := c.HandshakeData()
+	if data.Query.Get("room") != "lobby" || data.Header.Get("X-Client") != "test" || data.Transport != "xhr-polling" || data.RemoteAddr != c.RemoteAddr() {
+		t.Fatalf("Unexpected handshake data %+v", data)
+	}
+
+	// the requests of an established session are not authorized again
+	n := handshakes
+	c.Send("a")
+	if _, body := get(server.URL+"/socket.io/xhr-polling/"+string(c.sessionid), ""); !strings.Contains(body, "3:::a") {
+		t.Fatalf("Expected the message to be polled but got %q", body)
+	}
+	if handshakes != n {
+		t.Fatalf("Expected the authorizer to run once per session but it ran %d times", handshakes)
+	}
+}
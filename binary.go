@@ -0,0 +1,71 @@
+package socketio
+
+import (
+	"encoding/base64"
+)
+
+// BinaryData is arbitrary binary data sent with SendBinary. The sockets that
+// carry binary frames natively write it as a single binary frame. Otherwise
+// the codecs encode it in base64, which is safe for the text-only transports.
+type binaryData []byte
+
+// BinaryMessage is a binary frame received from a socket that carries binary
+// frames natively. It fulfills the message interface.
+type binaryMessage []byte
+
+func (bm binaryMessage) heartbeat() (heartbeat, bool) {
+	return -1, false
+}
+
+func (bm binaryMessage) Annotations() map[string]string {
+	return map[string]string{}
+}
+
+func (bm binaryMessage) Annotation(key string) (string, bool) {
+	return "", false
+}
+
+// Data returns the binary data as a string.
+func (bm binaryMessage) Data() string {
+	return string(bm)
+}
+
+// Bytes returns the binary data.
+func (bm binaryMessage) Bytes() []byte {
+	return bm
+}
+
+func (bm binaryMessage) Type() uint8 {
+	return MessageBinary
+}
+
+func (bm binaryMessage) JSON() ([]byte, bool) {
+	return nil, false
+}
+
+// SendBinary queues binary data for a delivery just like Send. Unlike a []byte
+// given to Send, which is written as text, data may contain any bytes. The
+// client receives it as a message of the type MessageBinary.
+func (c *Conn) SendBinary(data []byte) error {
+	return c.send(binaryData(data))
+}
+
+// ReceiveBinary handles a binary frame received through the transport.
+func (c *Conn) receiveBinary(transport string, data []byte) {
+	c.sio.metrics.MessagesReceived(transport, 1, len(data))
+	c.dispatch([]Message{binaryMessage(data)})
+}
+
+// EncodeBinary returns the base64 encoding of data used by the codecs.
+func encodeBinary(data []byte) []byte {
+	dst := make([]byte, base64.StdEncoding.EncodedLen(len(data)))
+	base64.StdEncoding.Encode(dst, data)
+	return dst
+}
+
+// DecodeBinary decodes the base64 encoding of binary data used by the codecs.
+func decodeBinary(data []byte) ([]byte, error) {
+	dst := make([]byte, base64.StdEncoding.DecodedLen(len(data)))
+	n, err := base64.StdEncoding.Decode(dst, data)
+	return dst[:n], err
+}
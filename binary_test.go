@@ -0,0 +1,63 @@
+package socketio
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebsocketBinary(t *testing.T) {
+	sio, server, _ := testServer(t, nil)
+	addr := strings.TrimPrefix(server.URL, "http://")
+	sio.config.Origins = []string{addr}
+
+	received := make(chan Message, 2)
+	sio.OnMessage(func(c *Conn, msg Message) {
+		received <- msg
+		if msg.Type() == MessageBinary {
+			c.SendBinary(msg.Bytes())
+		}
+	})
+
+	client := NewWebsocketClient(SIO07Codec{})
+	echoed := make(chan Message, 2)
+	client.OnMessage(func(msg Message) {
+		echoed <- msg
+	})
+
+	if err := client.Dial("ws://"+addr+"/socket.io/websocket", server.URL+"/"); err != nil {
+		t.Fatal("Dial:", err)
+	}
+	defer client.Close()
+
+	data := []byte{0, 0xff, 'a', '~', 0xfd}
+	if err := client.SendBinary(data); err != nil {
+		t.Fatal("SendBinary:", err)
+	}
+	if err := client.Send(binaryData(data)); err != nil {
+		t.Fatal("Send:", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case msg := <-received:
+			if msg.Type() != MessageBinary || !bytes.Equal(msg.Bytes(), data) {
+				t.Fatalf("Expected the server to receive %v but got %d %v", data, msg.Type(), msg.Bytes())
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Expected the server to receive the binary data")
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case msg := <-echoed:
+			if _, ok := msg.(binaryMessage); !ok || !bytes.Equal(msg.Bytes(), data) {
+				t.Fatalf("Expected a native binary frame with %v but got %#v", data, msg)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Expected the client to receive the binary data")
+		}
+	}
+}
@@ -1,25 +1,27 @@
 package socketio
 
 import (
-	"websocket"
-	"io"
 	"bytes"
-	"os"
+	"errors"
+	"io"
 	"strconv"
 )
 
-// Client is a toy interface.
+// Client is the interface of the socketio clients, e.g. ClientConn.
 type Client interface {
 	io.Closer
 
-	Dial(string, string) os.Error
-	Send(interface{}) os.Error
+	Dial(string, string) error
+	Send(interface{}) error
 	OnDisconnect(func())
 	OnMessage(func(Message))
 	SessionID() SessionID
 }
 
-// WebsocketClient is a toy that implements the Client interface.
+// WebsocketClient is a minimal websocket-only client that implements the Client
+// interface. It does not reconnect.
+//
+// Deprecated: Use ClientConn.
 type WebsocketClient struct {
 	connected    bool
 	enc          Encoder
@@ -27,7 +29,7 @@ type WebsocketClient struct {
 	decBuf       bytes.Buffer
 	codec        Codec
 	sessionid    SessionID
-	ws           *websocket.Conn
+	ws           *websocketConn
 	onDisconnect func()
 	onMessage    func(Message)
 }
@@ -38,34 +40,33 @@ func NewWebsocketClient(codec Codec) (wc *WebsocketClient) {
 	return
 }
 
-func (wc *WebsocketClient) Dial(rawurl string, origin string) (err os.Error) {
+func (wc *WebsocketClient) Dial(rawurl string, origin string) (err error) {
 	var messages []Message
-	var nr int
 
 	if wc.connected {
 		return ErrConnected
 	}
 
-	if wc.ws, err = websocket.Dial(rawurl, "", origin); err != nil {
+	if wc.ws, err = dialWebsocket(rawurl, origin, &DefaultWebsocketConfig); err != nil {
 		return
 	}
 
 	// read handshake
-	buf := make([]byte, 2048)
-	if nr, err = wc.ws.Read(buf); err != nil {
+	var buf []byte
+	if _, buf, err = wc.ws.ReadMessage(); err != nil {
 		wc.ws.Close()
-		return os.NewError("Dial: " + err.String())
+		return errors.New("Dial: " + err.Error())
 	}
-	wc.decBuf.Write(buf[0:nr])
+	wc.decBuf.Write(buf)
 
 	if messages, err = wc.dec.Decode(); err != nil {
 		wc.ws.Close()
-		return os.NewError("Dial: " + err.String())
+		return errors.New("Dial: " + err.Error())
 	}
 
 	if len(messages) != 1 {
 		wc.ws.Close()
-		return os.NewError("Dial: expected exactly 1 message, but got " + strconv.Itoa(len(messages)))
+		return errors.New("Dial: expected exactly 1 message, but got " + strconv.Itoa(len(messages)))
 	}
 
 	// TODO: Fix me: The original Socket.IO codec does not have a special encoding for handshake
@@ -73,16 +74,16 @@ func (wc *WebsocketClient) Dial(rawurl string, origin string) (err os.Error) {
 	// The old codec should be gone pretty soon (waiting for 0.7 release) so this might suffice
 	// until then.
 	if _, ok := wc.codec.(SIOCodec); !ok {
-		if messages[0].Type() != MessageHandshake {
+		if t := messages[0].Type(); t != MessageHandshake && t != MessageConnect {
 			wc.ws.Close()
-			return os.NewError("Dial: expected handshake, but got " + messages[0].Data())
+			return errors.New("Dial: expected handshake, but got " + messages[0].Data())
 		}
 	}
 
 	wc.sessionid = SessionID(messages[0].Data())
 	if wc.sessionid == "" {
 		wc.ws.Close()
-		return os.NewError("Dial: received empty sessionid")
+		return errors.New("Dial: received empty sessionid")
 	}
 
 	wc.connected = true
@@ -96,19 +97,23 @@ func (wc *WebsocketClient) SessionID() SessionID {
 }
 
 func (wc *WebsocketClient) reader() {
-	var err os.Error
-	var nr int
+	var err error
 	var messages []Message
-	buf := make([]byte, 2048)
+	var op byte
+	var p []byte
 
 	defer wc.Close()
 
 	for {
-		if nr, err = wc.ws.Read(buf); err != nil {
+		if op, p, err = wc.ws.ReadMessage(); err != nil {
 			return
 		}
-		if nr > 0 {
-			wc.decBuf.Write(buf[0:nr])
+		if op == websocketOpBinary {
+			if wc.onMessage != nil {
+				wc.onMessage(binaryMessage(p))
+			}
+		} else if len(p) > 0 {
+			wc.decBuf.Write(p)
 			if messages, err = wc.dec.Decode(); err != nil {
 				return
 			}
@@ -133,15 +138,28 @@ func (wc *WebsocketClient) OnMessage(f func(Message)) {
 	wc.onMessage = f
 }
 
-func (wc *WebsocketClient) Send(payload interface{}) os.Error {
+func (wc *WebsocketClient) Send(payload interface{}) error {
+	if wc.ws == nil {
+		return ErrNotConnected
+	}
+
+	var buf bytes.Buffer
+	if err := wc.enc.Encode(&buf, payload); err != nil {
+		return err
+	}
+	return wc.ws.WriteMessage(websocketOpText, buf.Bytes())
+}
+
+// SendBinary sends data as a single binary frame.
+func (wc *WebsocketClient) SendBinary(data []byte) error {
 	if wc.ws == nil {
 		return ErrNotConnected
 	}
 
-	return wc.enc.Encode(wc.ws, payload)
+	return wc.ws.WriteMessage(websocketOpBinary, data)
 }
 
-func (wc *WebsocketClient) Close() os.Error {
+func (wc *WebsocketClient) Close() error {
 	if !wc.connected {
 		return ErrNotConnected
 	}
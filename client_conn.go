@@ -0,0 +1,640 @@
+package socketio
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrClosed is used when a closed ClientConn is used.
+	ErrClosed = errors.New("client closed")
+
+	// ErrSessionGone is used when the server no longer knows the session a
+	// ClientConn tries to reconnect to.
+	ErrSessionGone = errors.New("session gone")
+
+	errUnknownTransport = errors.New("unknown client transport")
+)
+
+// ClientConfig represents the settings of a ClientConn.
+type ClientConfig struct {
+	// The transport to connect with: "websocket" or "xhr-polling".
+	Transport string
+
+	// Codec to use. It must be the one the server uses.
+	Codec Codec
+
+	// The delay before the first reconnect attempt. The delay is doubled
+	// after each failed attempt, up to the MaxReconnectDelay.
+	ReconnectDelay    time.Duration
+	MaxReconnectDelay time.Duration
+
+	// Maximum number of consecutive reconnect attempts before the client
+	// gives up and disconnects. Zero means no limit.
+	MaxReconnectAttempts int
+
+	// The period during which the server must send something, e.g. a
+	// heartbeat, or the connection is considered lost. It must be longer
+	// than the heartbeat interval of the server and the read timeout of its
+	// polling transports. Zero means no timeout.
+	ReadTimeout time.Duration
+
+	// The http client of the polling transports. If nil, the
+	// http.DefaultClient is used.
+	HTTPClient *http.Client
+}
+
+var DefaultClientConfig = ClientConfig{
+	Transport:            "websocket",
+	Codec:                SIOCodec{},
+	ReconnectDelay:       500 * time.Millisecond,
+	MaxReconnectDelay:    30 * time.Second,
+	MaxReconnectAttempts: 0,
+	ReadTimeout:          30 * time.Second,
+	HTTPClient:           nil,
+}
+
+// ClientConn is a client of a socketio server that implements the Client
+// interface. It connects with the websocket or the xhr-polling transport, and
+// when the connection is lost, it reconnects to its session with an
+// exponential backoff. The server replays the messages the client missed if
+// the replay buffer is enabled. If the session is gone, a new one is
+// established. It is safe for concurrent use.
+type ClientConn struct {
+	config ClientConfig
+
+	mutex     sync.Mutex
+	resource  *url.URL        // The resource of the server, e.g. http://localhost/socket.io/.
+	origin    string          // The origin sent with the websocket handshakes.
+	tr        clientTransport // The current transport connection, nil while reconnecting.
+	enc       Encoder
+	sessionid SessionID
+	seq       uint64 // The number of the messages received in the session.
+	closed    bool
+	done      chan struct{} // Closed by Close.
+
+	dec    Decoder
+	decBuf bytes.Buffer
+
+	onConnect    func()
+	onDisconnect func()
+	onReconnect  func(int)
+	onMessage    func(Message)
+}
+
+// NewClientConn creates a new client with the config. If config is nil, the
+// DefaultClientConfig is used.
+func NewClientConn(config *ClientConfig) *ClientConn {
+	if config == nil {
+		config = &DefaultClientConfig
+	}
+
+	cc := &ClientConn{
+		config: *config,
+		enc:    config.Codec.NewEncoder(),
+		done:   make(chan struct{}),
+	}
+	cc.dec = config.Codec.NewDecoder(&cc.decBuf)
+	return cc
+}
+
+// OnConnect sets f to be invoked when a session is established, including a
+// new session established because the previous one was gone.
+func (cc *ClientConn) OnConnect(f func()) {
+	cc.mutex.Lock()
+	cc.onConnect = f
+	cc.mutex.Unlock()
+}
+
+// OnDisconnect sets f to be invoked when a session ends: the client is
+// closed, it gives up reconnecting, or the server no longer knows the session.
+func (cc *ClientConn) OnDisconnect(f func()) {
+	cc.mutex.Lock()
+	cc.onDisconnect = f
+	cc.mutex.Unlock()
+}
+
+// OnReconnect sets f to be invoked when the client has reconnected to its
+// session after losing the connection. It passes the number of the attempts it
+// took as an argument to the callback.
+func (cc *ClientConn) OnReconnect(f func(attempts int)) {
+	cc.mutex.Lock()
+	cc.onReconnect = f
+	cc.mutex.Unlock()
+}
+
+// OnMessage sets f to be invoked for each message received from the server.
+// The heartbeats are answered by the client and never passed to f.
+func (cc *ClientConn) OnMessage(f func(Message)) {
+	cc.mutex.Lock()
+	cc.onMessage = f
+	cc.mutex.Unlock()
+}
+
+// SessionID returns the id of the current session.
+func (cc *ClientConn) SessionID() SessionID {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	return cc.sessionid
+}
+
+// Dial connects to the server at the resource rawurl, e.g.
+// http://localhost:8080/socket.io/, and establishes a new session. The origin
+// is sent with the websocket handshakes. The client reconnects by itself from
+// then on, until Close is called.
+func (cc *ClientConn) Dial(rawurl string, origin string) (err error) {
+	cc.mutex.Lock()
+	if cc.closed {
+		cc.mutex.Unlock()
+		return ErrClosed
+	}
+	if cc.resource != nil {
+		cc.mutex.Unlock()
+		return ErrConnected
+	}
+
+	if cc.resource, err = url.Parse(rawurl); err != nil {
+		cc.mutex.Unlock()
+		return
+	}
+	if !strings.HasSuffix(cc.resource.Path, "/") {
+		cc.resource.Path += "/"
+	}
+	cc.origin = origin
+	cc.mutex.Unlock()
+
+	msgs, err := cc.connect()
+	if err != nil {
+		cc.mutex.Lock()
+		cc.resource = nil
+		cc.mutex.Unlock()
+		return
+	}
+
+	cc.connected()
+	go cc.run(msgs)
+	return
+}
+
+// Send encodes payload and sends it to the server. It returns ErrNotConnected
+// while the client is reconnecting.
+func (cc *ClientConn) Send(payload interface{}) error {
+	cc.mutex.Lock()
+
+	if cc.closed {
+		cc.mutex.Unlock()
+		return ErrClosed
+	}
+	tr := cc.tr
+	if tr == nil {
+		cc.mutex.Unlock()
+		return ErrNotConnected
+	}
+
+	var buf bytes.Buffer
+	err := cc.enc.Encode(&buf, payload)
+	cc.mutex.Unlock()
+
+	if err != nil {
+		return err
+	}
+	return tr.write(buf.Bytes())
+}
+
+// SendBinary sends binary data to the server. The websocket transport sends it
+// as a single binary frame, the polling one encodes it in base64.
+func (cc *ClientConn) SendBinary(data []byte) error {
+	cc.mutex.Lock()
+	tr := cc.tr
+	cc.mutex.Unlock()
+
+	if ws, ok := tr.(*websocketClientTransport); ok {
+		return ws.ws.WriteMessage(websocketOpBinary, data)
+	}
+	return cc.Send(binaryData(data))
+}
+
+// Close ends the session. The server notices it when the session times out.
+func (cc *ClientConn) Close() error {
+	cc.mutex.Lock()
+
+	if cc.closed {
+		cc.mutex.Unlock()
+		return ErrClosed
+	}
+	cc.closed = true
+	close(cc.done)
+
+	tr := cc.tr
+	cc.tr = nil
+	connected := cc.resource != nil
+	cc.mutex.Unlock()
+
+	if tr != nil {
+		tr.close()
+	}
+	if connected {
+		cc.disconnected()
+	}
+	return nil
+}
+
+// Connected invokes the OnConnect callback.
+func (cc *ClientConn) connected() {
+	cc.mutex.Lock()
+	f := cc.onConnect
+	cc.mutex.Unlock()
+
+	if f != nil {
+		f()
+	}
+}
+
+// Disconnected invokes the OnDisconnect callback.
+func (cc *ClientConn) disconnected() {
+	cc.mutex.Lock()
+	f := cc.onDisconnect
+	cc.mutex.Unlock()
+
+	if f != nil {
+		f()
+	}
+}
+
+// Reconnected invokes the OnReconnect callback.
+func (cc *ClientConn) reconnected(attempts int) {
+	cc.mutex.Lock()
+	f := cc.onReconnect
+	cc.mutex.Unlock()
+
+	if f != nil {
+		f(attempts)
+	}
+}
+
+// Run receives the messages until the client is closed. Msgs are the
+// messages received along with the handshake. When the connection is lost,
+// run reconnects.
+func (cc *ClientConn) run(msgs []Message) {
+	cc.deliver(msgs)
+
+	for {
+		cc.mutex.Lock()
+		tr := cc.tr
+		cc.mutex.Unlock()
+
+		if tr != nil {
+			cc.receive(tr)
+			tr.close()
+		}
+
+		if !cc.reconnect() {
+			return
+		}
+	}
+}
+
+// Receive reads and delivers the messages from tr until it fails.
+func (cc *ClientConn) receive(tr clientTransport) {
+	for {
+		p, binary, err := tr.read()
+		if err != nil {
+			return
+		}
+
+		if binary {
+			cc.deliver([]Message{binaryMessage(p)})
+			continue
+		}
+
+		cc.decBuf.Write(p)
+		msgs, err := cc.dec.Decode()
+		if err != nil {
+			return
+		}
+		cc.deliver(msgs)
+	}
+}
+
+// Deliver answers the heartbeats and passes the rest of msgs to the OnMessage
+// callback.
+func (cc *ClientConn) deliver(msgs []Message) {
+	for _, msg := range msgs {
+		if hb, ok := msg.heartbeat(); ok {
+			cc.Send(heartbeat(hb))
+			continue
+		}
+
+		cc.mutex.Lock()
+		cc.seq++
+		f := cc.onMessage
+		cc.mutex.Unlock()
+
+		if f != nil {
+			f(msg)
+		}
+	}
+}
+
+// Reconnect reconnects with an exponential backoff. If the session is gone, a
+// new one is established. It returns false if the client was closed or it gave
+// up.
+func (cc *ClientConn) reconnect() bool {
+	cc.mutex.Lock()
+	cc.tr = nil
+	cc.mutex.Unlock()
+
+	delay := cc.config.ReconnectDelay
+	for attempts := 1; ; attempts++ {
+		if max := cc.config.MaxReconnectAttempts; max > 0 && attempts > max {
+			cc.mutex.Lock()
+			cc.closed = true
+			close(cc.done)
+			cc.mutex.Unlock()
+
+			cc.disconnected()
+			return false
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-cc.done:
+			return false
+		}
+		if delay *= 2; cc.config.MaxReconnectDelay > 0 && delay > cc.config.MaxReconnectDelay {
+			delay = cc.config.MaxReconnectDelay
+		}
+
+		msgs, err := cc.connect()
+		if err == ErrSessionGone {
+			cc.disconnected()
+
+			cc.mutex.Lock()
+			cc.sessionid, cc.seq = "", 0
+			cc.mutex.Unlock()
+
+			if msgs, err = cc.connect(); err == nil {
+				cc.connected()
+				cc.deliver(msgs)
+				return true
+			}
+		}
+		if err == ErrClosed {
+			return false
+		}
+		if err == nil {
+			cc.reconnected(attempts)
+			cc.deliver(msgs)
+			return true
+		}
+	}
+}
+
+// Connect opens a transport connection to the session, or establishes a new
+// session if there is none. It returns the messages received after the
+// handshake of a new session.
+func (cc *ClientConn) connect() ([]Message, error) {
+	cc.mutex.Lock()
+	u := *cc.resource
+	u.Path += cc.config.Transport
+	if cc.sessionid != "" {
+		u.Path += "/" + string(cc.sessionid)
+		u.RawQuery = "seq=" + strconv.FormatUint(cc.seq, 10)
+	}
+	origin := cc.origin
+	isNew := cc.sessionid == ""
+	cc.mutex.Unlock()
+
+	var tr clientTransport
+	var err error
+
+	switch cc.config.Transport {
+	case "websocket":
+		tr, err = dialWebsocketTransport(u, origin, cc.config.ReadTimeout)
+
+	case "xhr-polling":
+		tr = newPollingClientTransport(cc)
+
+	default:
+		return nil, errUnknownTransport
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cc.decBuf.Reset()
+
+	var msgs []Message
+	if isNew {
+		msgs, err = cc.handshake(tr)
+	} else if pt, ok := tr.(*pollingClientTransport); ok {
+		// the first poll tells if the session is still there
+		var p []byte
+		if p, err = pt.poll(); err == nil {
+			cc.decBuf.Write(p)
+			msgs, err = cc.dec.Decode()
+		}
+	}
+	if err != nil {
+		tr.close()
+		return nil, err
+	}
+
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	if cc.closed {
+		tr.close()
+		return nil, ErrClosed
+	}
+	cc.tr = tr
+	return msgs, nil
+}
+
+// Handshake reads the handshake of a new session from tr. It returns the
+// messages received after it.
+func (cc *ClientConn) handshake(tr clientTransport) ([]Message, error) {
+	var msgs []Message
+	for len(msgs) == 0 {
+		p, _, err := tr.read()
+		if err != nil {
+			return nil, err
+		}
+
+		cc.decBuf.Write(p)
+		if msgs, err = cc.dec.Decode(); err != nil {
+			return nil, err
+		}
+	}
+
+	// the SIOCodec does not have a special encoding for the handshake, so
+	// the first message is assumed to be the handshake
+	if _, ok := cc.config.Codec.(SIOCodec); !ok {
+		if t := msgs[0].Type(); t != MessageHandshake && t != MessageConnect {
+			return nil, errors.New("expected handshake, but got " + msgs[0].Data())
+		}
+	}
+
+	sessionid := SessionID(msgs[0].Data())
+	if sessionid == "" {
+		return nil, errors.New("received empty sessionid")
+	}
+
+	cc.mutex.Lock()
+	cc.sessionid, cc.seq = sessionid, 0
+	cc.mutex.Unlock()
+
+	return msgs[1:], nil
+}
+
+// ClientTransport is a transport connection of a ClientConn.
+//
+// Read returns the next payload received from the server and tells if it is
+// binary data. Write sends an encoded payload to the server. Close closes the
+// connection.
+type clientTransport interface {
+	read() (p []byte, binary bool, err error)
+	write(p []byte) error
+	close() error
+}
+
+// The websocket transport connection of a ClientConn.
+type websocketClientTransport struct {
+	ws *websocketConn
+}
+
+func dialWebsocketTransport(u url.URL, origin string, rtimeout time.Duration) (clientTransport, error) {
+	switch u.Scheme {
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	}
+
+	config := DefaultWebsocketConfig
+	config.ReadTimeout = rtimeout
+	config.WriteTimeout = 0
+
+	ws, err := dialWebsocket(u.String(), origin, &config)
+	if status, ok := err.(websocketStatusError); ok && status == http.StatusBadRequest {
+		return nil, ErrSessionGone
+	} else if err != nil {
+		return nil, err
+	}
+	return &websocketClientTransport{ws}, nil
+}
+
+func (t *websocketClientTransport) read() ([]byte, bool, error) {
+	op, p, err := t.ws.ReadMessage()
+	return p, op == websocketOpBinary, err
+}
+
+func (t *websocketClientTransport) write(p []byte) error {
+	return t.ws.WriteMessage(websocketOpText, p)
+}
+
+func (t *websocketClientTransport) close() error {
+	return t.ws.Close()
+}
+
+// The xhr-polling transport connection of a ClientConn. Each read is a GET
+// request and each write is a POST request.
+type pollingClientTransport struct {
+	cc     *ClientConn
+	client *http.Client
+	ctx    context.Context // Canceled by close, which aborts the pending requests.
+	cancel context.CancelFunc
+}
+
+func newPollingClientTransport(cc *ClientConn) clientTransport {
+	client := cc.config.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if cc.config.ReadTimeout > 0 && (client.Timeout == 0 || client.Timeout > cc.config.ReadTimeout) {
+		c := *client
+		c.Timeout = cc.config.ReadTimeout
+		client = &c
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &pollingClientTransport{cc: cc, client: client, ctx: ctx, cancel: cancel}
+}
+
+// SessionURL returns the url of the session. After the handshake the session
+// id is known, and the seq parameter tells the messages received.
+func (t *pollingClientTransport) sessionURL() string {
+	t.cc.mutex.Lock()
+	defer t.cc.mutex.Unlock()
+
+	u := *t.cc.resource
+	u.Path += t.cc.config.Transport
+	if t.cc.sessionid == "" {
+		return u.String()
+	}
+	u.Path += "/" + string(t.cc.sessionid)
+	u.RawQuery = "seq=" + strconv.FormatUint(t.cc.seq, 10)
+	return u.String()
+}
+
+func (t *pollingClientTransport) do(req *http.Request) ([]byte, error) {
+	resp, err := t.client.Do(req.WithContext(t.ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusBadRequest:
+		return nil, ErrSessionGone
+	default:
+		return nil, errors.New("poll failed with status " + resp.Status)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// Poll sends a single GET request and returns the response body, which is
+// empty if the poll timed out on the server.
+func (t *pollingClientTransport) poll() ([]byte, error) {
+	req, err := http.NewRequest("GET", t.sessionURL(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return t.do(req)
+}
+
+func (t *pollingClientTransport) read() ([]byte, bool, error) {
+	for {
+		if p, err := t.poll(); err != nil || len(p) > 0 {
+			return p, false, err
+		}
+	}
+}
+
+func (t *pollingClientTransport) write(p []byte) error {
+	form := url.Values{"data": {string(p)}}
+	req, err := http.NewRequest("POST", t.sessionURL(), strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	_, err = t.do(req)
+	return err
+}
+
+func (t *pollingClientTransport) close() error {
+	t.cancel()
+	return nil
+}
@@ -0,0 +1,99 @@
+package socketio
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func testClientConn(t *testing.T, transport string) {
+	sio, server, conns := testServer(t, func(config *Config) {
+		config.ReplayBufferSize = 100
+	})
+	sio.OnMessage(func(c *Conn, msg Message) {
+		c.Send("echo:" + msg.Data())
+	})
+	sio.config.Origins = []string{strings.TrimPrefix(server.URL, "http://")}
+
+	clientConfig := DefaultClientConfig
+	clientConfig.Transport = transport
+	clientConfig.Codec = SIO07Codec{}
+	clientConfig.ReconnectDelay = 10 * time.Millisecond
+	cc := NewClientConn(&clientConfig)
+
+	events := make(chan string, 10)
+	cc.OnConnect(func() { events <- "connect" })
+	cc.OnDisconnect(func() { events <- "disconnect" })
+	cc.OnReconnect(func(attempts int) { events <- "reconnect" })
+	messages := make(chan string, 10)
+	cc.OnMessage(func(msg Message) { messages <- msg.Data() })
+
+	expect := func(ch chan string, what string) {
+		select {
+		case got := <-ch:
+			if got != what {
+				t.Fatalf("%s: expected %q but got %q", transport, what, got)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s: expected %q", transport, what)
+		}
+	}
+
+	if err := cc.Dial(server.URL+"/socket.io", server.URL); err != nil {
+		t.Fatal("Dial:", err)
+	}
+	defer cc.Close()
+
+	expect(events, "connect")
+	c := <-conns
+	if cc.SessionID() != c.sessionid {
+		t.Fatalf("%s: expected the session id %s but got %s", transport, c.sessionid, cc.SessionID())
+	}
+
+	if err := cc.Send("hello"); err != nil {
+		t.Fatal("Send:", err)
+	}
+	expect(messages, "echo:hello")
+
+	// a transient failure: the client resumes the session and the server
+	// replays what was sent in the meantime
+	cc.mutex.Lock()
+	cc.tr.close()
+	cc.mutex.Unlock()
+	c.Send("missed")
+
+	expect(events, "reconnect")
+	expect(messages, "missed")
+
+	if err := cc.Send("again"); err != nil {
+		t.Fatal("Send:", err)
+	}
+	expect(messages, "echo:again")
+
+	// the session is gone: the client establishes a new one
+	c.Close()
+	expect(events, "disconnect")
+	expect(events, "connect")
+
+	if c = <-conns; cc.SessionID() != c.sessionid {
+		t.Fatalf("%s: expected the new session id %s but got %s", transport, c.sessionid, cc.SessionID())
+	}
+	if err := cc.Send("new"); err != nil {
+		t.Fatal("Send:", err)
+	}
+	expect(messages, "echo:new")
+
+	select {
+	case msg := <-messages:
+		t.Fatalf("%s: unexpected message %q", transport, msg)
+	default:
+	}
+}
+
+func TestClientConnWebsocket(t *testing.T) {
+	testClientConn(t, "websocket")
+}
+
+func TestClientConnPolling(t *testing.T) {
+	testClientConn(t, "xhr-polling")
+}
@@ -2,18 +2,19 @@ package socketio
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"json"
-	"os"
 	"strconv"
-	"utf8"
+	"unicode/utf8"
 )
 
 // The various delimiters used for framing in the socket.io protocol.
 const (
-	SIOAnnotationRealm = "r"
-	SIOAnnotationJSON  = "j"
+	SIOAnnotationRealm  = "r"
+	SIOAnnotationJSON   = "j"
+	SIOAnnotationBinary = "b"
 
 	sioMessageTypeDisconnect = 0
 	sioMessageTypeMessage    = 1
@@ -25,6 +26,7 @@ var (
 	sioFrameDelim          = []byte("~m~")
 	sioFrameDelimJSON      = []byte("~j~")
 	sioFrameDelimHeartbeat = []byte("~h~")
+	sioFrameDelimBinary    = []byte("~b~")
 )
 
 // SioMessage fulfills the message interface.
@@ -34,15 +36,18 @@ type sioMessage struct {
 	data        []byte
 }
 
-// Type checks if the message starts with sioFrameDelimJSON or
-// sioFrameDelimHeartbeat. If the prefix is something else, then the message
-// is interpreted as a basic messageText.
+// Type checks if the message starts with sioFrameDelimJSON,
+// sioFrameDelimBinary or sioFrameDelimHeartbeat. If the prefix is something
+// else, then the message is interpreted as a basic messageText.
 func (sm *sioMessage) Type() uint8 {
 	switch sm.typ {
 	case sioMessageTypeMessage:
 		if _, ok := sm.Annotation(SIOAnnotationJSON); ok {
 			return MessageJSON
 		}
+		if _, ok := sm.Annotation(SIOAnnotationBinary); ok {
+			return MessageBinary
+		}
 
 	case sioMessageTypeDisconnect:
 		return MessageDisconnect
@@ -82,12 +87,14 @@ func (sm *sioMessage) heartbeat() (heartbeat, bool) {
 	return -1, false
 }
 
-// Data returns the raw message as a string.
+// Data returns the raw message as a string. The data of a binary message has
+// already been decoded from base64.
 func (sm *sioMessage) Data() string {
 	return string(sm.data)
 }
 
-// Bytes returns the raw message.
+// Bytes returns the raw message. The data of a binary message has already been
+// decoded from base64.
 func (sm *sioMessage) Bytes() []byte {
 	return sm.data
 }
@@ -115,10 +122,11 @@ func (sc SIOCodec) NewEncoder() Encoder {
 }
 
 // Encode takes payload, encodes it and writes it to dst. Payload must be one
-// of the following: a heartbeat, a handshake, []byte, string, int or anything
-// than can be marshalled by the default json package. If payload can't be
-// encoded or the writing fails, an error will be returned.
-func (enc *sioEncoder) Encode(dst io.Writer, payload interface{}) (err os.Error) {
+// of the following: a heartbeat, a handshake, binary data, []byte, string, int
+// or anything than can be marshalled by the default json package. The binary
+// data is encoded in base64 and prefixed with sioFrameDelimBinary. If payload
+// can't be encoded or the writing fails, an error will be returned.
+func (enc *sioEncoder) Encode(dst io.Writer, payload interface{}) (err error) {
 	enc.elem.Reset()
 
 	switch t := payload.(type) {
@@ -129,6 +137,14 @@ func (enc *sioEncoder) Encode(dst io.Writer, payload interface{}) (err os.Error)
 	case handshake:
 		_, err = fmt.Fprintf(dst, "%s%d%s%s", sioFrameDelim, len(t), sioFrameDelim, t)
 
+	case disconnect:
+		// the framing has no notion of a forced disconnection
+		break
+
+	case binaryData:
+		data := encodeBinary(t)
+		_, err = fmt.Fprintf(dst, "%s%d%s%s%s", sioFrameDelim, len(data)+len(sioFrameDelimBinary), sioFrameDelim, sioFrameDelimBinary, data)
+
 	case []byte:
 		l := utf8.RuneCount(t)
 		if l == 0 {
@@ -203,9 +219,9 @@ func (dec *sioDecoder) Reset() {
 	dec.length = 0
 }
 
-func (dec *sioDecoder) Decode() (messages []Message, err os.Error) {
+func (dec *sioDecoder) Decode() (messages []Message, err error) {
 	messages = make([]Message, 0, 1)
-	var c int
+	var c rune
 
 L:
 	for {
@@ -226,7 +242,7 @@ L:
 			if dec.buf.Len() == len(sioFrameDelim) {
 				if !bytes.Equal(dec.buf.Bytes(), sioFrameDelim) {
 					dec.Reset()
-					return nil, os.NewError("Malformed header")
+					return nil, errors.New("Malformed header")
 				}
 
 				dec.state = sioDecodeStateLength
@@ -257,7 +273,7 @@ L:
 
 			if !bytes.Equal(dec.buf.Bytes(), sioFrameDelim) {
 				dec.Reset()
-				return nil, os.NewError("Malformed header")
+				return nil, errors.New("Malformed header")
 			}
 
 			dec.state = sioDecodeStateData
@@ -272,12 +288,8 @@ L:
 				dec.buf.WriteRune(c)
 				dec.length--
 
-				utf8str := utf8.NewString(dec.src.String())
-
-				if utf8str.RuneCount() >= dec.length {
-					str := utf8str.Slice(0, dec.length)
-					dec.buf.WriteString(str)
-					dec.src.Next(len(str))
+				if n := runeOffset(dec.src.Bytes(), dec.length); n >= 0 {
+					dec.buf.Write(dec.src.Next(n))
 					dec.length = 0
 				} else {
 					break L
@@ -291,6 +303,13 @@ L:
 				dec.msg.annotations = make(map[string]string)
 				dec.msg.annotations[SIOAnnotationJSON] = ""
 				data = data[len(sioFrameDelimJSON):]
+			} else if bytes.HasPrefix(data, sioFrameDelimBinary) {
+				dec.msg.annotations = make(map[string]string)
+				dec.msg.annotations[SIOAnnotationBinary] = ""
+				if data, err = decodeBinary(data[len(sioFrameDelimBinary):]); err != nil {
+					dec.Reset()
+					return nil, err
+				}
 			} else if bytes.HasPrefix(data, sioFrameDelimHeartbeat) {
 				dec.msg.typ = sioMessageTypeHeartbeat
 				data = data[len(sioFrameDelimHeartbeat):]
@@ -308,7 +327,7 @@ L:
 		dec.buf.WriteRune(c)
 	}
 
-	if err == os.EOF {
+	if err == io.EOF {
 		err = nil
 	}
 
@@ -0,0 +1,482 @@
+package socketio
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// The packet types of the Socket.IO 0.7+ protocol.
+const (
+	SIO07PacketDisconnect = iota
+	SIO07PacketConnect
+	SIO07PacketHeartbeat
+	SIO07PacketMessage
+	SIO07PacketJSON
+	SIO07PacketEvent
+	SIO07PacketAck
+	SIO07PacketError
+	SIO07PacketNoop
+
+	// SIO07PacketBinary carries binary data encoded in base64. It is an
+	// extension that is not part of the protocol revision 1.
+	SIO07PacketBinary
+)
+
+// The annotations available in the messages decoded by the SIO07Codec.
+const (
+	// SIO07AnnotationEndpoint holds the endpoint (namespace) of the message.
+	// It is not present for the default endpoint.
+	SIO07AnnotationEndpoint = "endpoint"
+
+	// SIO07AnnotationID holds the message id. It is not present if the
+	// message has no id.
+	SIO07AnnotationID = "id"
+
+	// SIO07AnnotationAck is present with the value "data" if the message id
+	// was suffixed with a '+', i.e. the sender expects the ack to carry data.
+	SIO07AnnotationAck = "ack"
+)
+
+var sio07FrameDelim = []byte("\ufffd")
+
+// SIO07Packet is a fully specified packet of the 0.7+ protocol. Sending a
+// SIO07Packet through a connection that uses the SIO07Codec gives full control
+// over the fields written to the wire. An ID of zero or less means that the
+// packet has no message id.
+type SIO07Packet struct {
+	Type     uint8
+	ID       int
+	Ack      bool
+	Endpoint string
+	Data     []byte
+}
+
+// Sio07Message fulfills the message interface.
+type sio07Message struct {
+	typ      uint8
+	id       int
+	ack      bool
+	endpoint string
+	data     []byte
+}
+
+// Type maps the packet type into one of the message types.
+func (sm *sio07Message) Type() uint8 {
+	switch sm.typ {
+	case SIO07PacketDisconnect:
+		return MessageDisconnect
+
+	case SIO07PacketConnect:
+		return MessageConnect
+
+	case SIO07PacketHeartbeat:
+		return MessageHeartbeat
+
+	case SIO07PacketJSON:
+		return MessageJSON
+
+	case SIO07PacketEvent:
+		return MessageEvent
+
+	case SIO07PacketAck:
+		return MessageAck
+
+	case SIO07PacketError:
+		return MessageError
+
+	case SIO07PacketNoop:
+		return MessageNoop
+
+	case SIO07PacketBinary:
+		return MessageBinary
+	}
+
+	return MessageText
+}
+
+// Annotations returns the endpoint, the message id and the ack-flag of the
+// message, if present.
+func (sm *sio07Message) Annotations() map[string]string {
+	annotations := make(map[string]string)
+	for _, key := range []string{SIO07AnnotationEndpoint, SIO07AnnotationID, SIO07AnnotationAck} {
+		if value, ok := sm.Annotation(key); ok {
+			annotations[key] = value
+		}
+	}
+	return annotations
+}
+
+func (sm *sio07Message) Annotation(key string) (value string, ok bool) {
+	switch key {
+	case SIO07AnnotationEndpoint:
+		return sm.endpoint, sm.endpoint != ""
+
+	case SIO07AnnotationID:
+		if sm.id > 0 {
+			return strconv.Itoa(sm.id), true
+		}
+
+	case SIO07AnnotationAck:
+		if sm.ack {
+			return "data", true
+		}
+	}
+
+	return "", false
+}
+
+// Heartbeat returns the heartbeat value of a heartbeat packet. The 0.7+
+// heartbeats do not carry a value, so unless the packet has a numeric
+// payload, a negative heartbeat is returned along with a true.
+func (sm *sio07Message) heartbeat() (heartbeat, bool) {
+	if sm.typ != SIO07PacketHeartbeat {
+		return -1, false
+	}
+
+	if n, err := strconv.Atoi(string(sm.data)); err == nil {
+		return heartbeat(n), true
+	}
+
+	return -1, true
+}
+
+// Data returns the raw message as a string. The data of a binary packet has
+// already been decoded from base64.
+func (sm *sio07Message) Data() string {
+	return string(sm.data)
+}
+
+// Bytes returns the raw message. The data of a binary packet has already been
+// decoded from base64.
+func (sm *sio07Message) Bytes() []byte {
+	return sm.data
+}
+
+// JSON returns the JSON embedded in the message, if available. Both json and
+// event packets carry JSON.
+func (sm *sio07Message) JSON() ([]byte, bool) {
+	switch sm.typ {
+	case SIO07PacketJSON, SIO07PacketEvent:
+		return sm.data, true
+	}
+
+	return nil, false
+}
+
+// SIO07Codec is a packet codec of the Socket.IO 0.7 protocol (revision 1).
+// Each packet goes like this: TYPE:[ID[+]]:[ENDPOINT][:DATA]. When written to
+// the wire, each packet is framed with <DELIM>DATA-LENGTH<DELIM>PACKET, where
+// the delimiter is U+FFFD and the length is counted in UTF-16 code units, like
+// the length of a JavaScript string. The decoder accepts both framed payloads
+// and single unframed packets.
+//
+// Only the packet format is implemented, not the HTTP handshake of the 0.7
+// protocol: the server does not answer GET <resource>1/ with the
+// sid:heartbeat:close:transports handshake, nor does it route the
+// <resource>1/<transport>/<sid> URLs. Instead, a session starts at the first
+// request of a transport, like with the other codecs, and its handshake is
+// encoded as a connect packet of the default endpoint that carries the session
+// id as its data. The official 0.7+ clients therefore need a shim that makes
+// the handshake this way.
+type SIO07Codec struct{}
+
+type sio07Encoder struct {
+	elem bytes.Buffer
+	pkt  bytes.Buffer
+}
+
+func (sc SIO07Codec) NewEncoder() Encoder {
+	return &sio07Encoder{}
+}
+
+// Encode takes payload, encodes it and writes it to dst. Payload must be one
+// of the following: a SIO07Packet, a heartbeat, a handshake, a disconnect, an event,
+// an ack, a message to an endpoint, binary data, []byte, string, int or anything
+// than can be marshalled by the default json package. The binary data is written
+// as a SIO07PacketBinary. If payload can't be encoded or the writing fails, an
+// error will be returned.
+func (enc *sio07Encoder) Encode(dst io.Writer, payload interface{}) (err error) {
+	var p *SIO07Packet
+	if p, err = enc.packet(payload); p == nil || err != nil {
+		return
+	}
+	return enc.encodePacket(dst, p)
+}
+
+// Packet converts payload into a packet. A nil packet is returned if there is
+// nothing to write.
+func (enc *sio07Encoder) packet(payload interface{}) (p *SIO07Packet, err error) {
+	enc.elem.Reset()
+
+	switch t := payload.(type) {
+	case SIO07Packet:
+		return &t, nil
+
+	case *SIO07Packet:
+		return t, nil
+
+	case heartbeat:
+		return &SIO07Packet{Type: SIO07PacketHeartbeat}, nil
+
+	case handshake:
+		return &SIO07Packet{Type: SIO07PacketConnect, Data: []byte(t)}, nil
+
+	case disconnect:
+		return &SIO07Packet{Type: SIO07PacketDisconnect}, nil
+
+	case event:
+		var data []byte
+		if data, err = json.Marshal(t); err != nil {
+			break
+		}
+		return &SIO07Packet{Type: SIO07PacketEvent, Data: data}, nil
+
+	case ackRequest:
+		if p, err = enc.packet(t.data); p == nil || err != nil {
+			break
+		}
+		q := *p
+		q.ID = t.id
+		q.Ack = true
+		return &q, nil
+
+	case endpointed:
+		if p, err = enc.packet(t.data); p == nil || err != nil {
+			break
+		}
+		q := *p
+		q.Endpoint = t.endpoint
+		return &q, nil
+
+	case ackReply:
+		data := []byte(strconv.Itoa(t.id))
+		if t.args != nil {
+			var args []byte
+			if args, err = json.Marshal(t.args); err != nil {
+				break
+			}
+			data = append(data, '+')
+			data = append(data, args...)
+		}
+		return &SIO07Packet{Type: SIO07PacketAck, Data: data}, nil
+
+	case binaryData:
+		return &SIO07Packet{Type: SIO07PacketBinary, Data: encodeBinary(t)}, nil
+
+	case []byte:
+		if len(t) == 0 {
+			break
+		}
+		return &SIO07Packet{Type: SIO07PacketMessage, Data: t}, nil
+
+	case string:
+		if t == "" {
+			break
+		}
+		return &SIO07Packet{Type: SIO07PacketMessage, Data: []byte(t)}, nil
+
+	case int:
+		return &SIO07Packet{Type: SIO07PacketMessage, Data: []byte(strconv.Itoa(t))}, nil
+
+	default:
+		var data []byte
+		if data, err = json.Marshal(payload); len(data) == 0 || err != nil {
+			break
+		}
+		if err = json.Compact(&enc.elem, data); err != nil {
+			break
+		}
+		return &SIO07Packet{Type: SIO07PacketJSON, Data: enc.elem.Bytes()}, nil
+	}
+
+	return nil, err
+}
+
+// EncodePacket writes the framed packet p to dst.
+func (enc *sio07Encoder) encodePacket(dst io.Writer, p *SIO07Packet) (err error) {
+	if p.Type > SIO07PacketBinary {
+		return errors.New("unknown packet type " + strconv.Itoa(int(p.Type)))
+	}
+
+	enc.pkt.Reset()
+	enc.pkt.WriteString(strconv.Itoa(int(p.Type)))
+	enc.pkt.WriteByte(':')
+	if p.ID > 0 {
+		enc.pkt.WriteString(strconv.Itoa(p.ID))
+		if p.Ack {
+			enc.pkt.WriteByte('+')
+		}
+	}
+	enc.pkt.WriteByte(':')
+	enc.pkt.WriteString(p.Endpoint)
+
+	switch p.Type {
+	case SIO07PacketMessage, SIO07PacketJSON, SIO07PacketEvent, SIO07PacketAck, SIO07PacketError, SIO07PacketBinary:
+		enc.pkt.WriteByte(':')
+		enc.pkt.Write(p.Data)
+
+	default:
+		if len(p.Data) > 0 {
+			enc.pkt.WriteByte(':')
+			enc.pkt.Write(p.Data)
+		}
+	}
+
+	_, err = fmt.Fprintf(dst, "%s%d%s%s", sio07FrameDelim, utf16Length(enc.pkt.Bytes()), sio07FrameDelim, enc.pkt.Bytes())
+	return
+}
+
+type sio07Decoder struct {
+	src *bytes.Buffer
+}
+
+func (sc SIO07Codec) NewDecoder(src *bytes.Buffer) Decoder {
+	return &sio07Decoder{src: src}
+}
+
+func (dec *sio07Decoder) Reset() {
+	dec.src.Reset()
+}
+
+// Decode decodes the packets buffered in the source. If the source begins with
+// a frame delimiter, the framed packets are decoded until the source is exhausted
+// or a frame is incomplete, in which case the rest is left in the source for the
+// following calls. Otherwise the whole source is decoded as a single packet.
+func (dec *sio07Decoder) Decode() (messages []Message, err error) {
+	messages = make([]Message, 0, 1)
+	var msg *sio07Message
+
+	for dec.src.Len() > 0 {
+		data := dec.src.Bytes()
+
+		if !bytes.HasPrefix(data, sio07FrameDelim) {
+			if msg, err = decodeSIO07Packet(data); err != nil {
+				dec.Reset()
+				return nil, err
+			}
+			messages = append(messages, msg)
+			dec.src.Reset()
+			break
+		}
+
+		rest := data[len(sio07FrameDelim):]
+		i := bytes.Index(rest, sio07FrameDelim)
+		if i < 0 {
+			for _, c := range rest {
+				if c < '0' || c > '9' {
+					dec.Reset()
+					return nil, errors.New("malformed frame length")
+				}
+			}
+			break
+		}
+
+		var length int
+		if length, err = strconv.Atoi(string(rest[:i])); err != nil || length < 0 {
+			dec.Reset()
+			return nil, errors.New("malformed frame length")
+		}
+
+		packet := rest[i+len(sio07FrameDelim):]
+		n := utf16Offset(packet, length)
+		if n < 0 {
+			break
+		}
+
+		if msg, err = decodeSIO07Packet(packet[:n]); err != nil {
+			dec.Reset()
+			return nil, err
+		}
+		messages = append(messages, msg)
+		dec.src.Next(len(data) - len(packet) + n)
+	}
+
+	return
+}
+
+// RuneOffset returns the number of bytes taken by the first n runes of p,
+// or -1 if p contains less than n complete runes.
+func runeOffset(p []byte, n int) int {
+	offset := 0
+	for ; n > 0; n-- {
+		if !utf8.FullRune(p[offset:]) {
+			return -1
+		}
+		_, size := utf8.DecodeRune(p[offset:])
+		offset += size
+	}
+	return offset
+}
+
+// UTF16Length returns the number of UTF-16 code units of p, in which the
+// characters outside of the Basic Multilingual Plane take two.
+func utf16Length(p []byte) int {
+	n := 0
+	for len(p) > 0 {
+		r, size := utf8.DecodeRune(p)
+		n += utf16.RuneLen(r)
+		p = p[size:]
+	}
+	return n
+}
+
+// UTF16Offset returns the number of bytes taken by the first n UTF-16 code
+// units of p, or -1 if p contains less than n code units of complete runes.
+func utf16Offset(p []byte, n int) int {
+	offset := 0
+	for n > 0 {
+		if !utf8.FullRune(p[offset:]) {
+			return -1
+		}
+		r, size := utf8.DecodeRune(p[offset:])
+		offset += size
+		n -= utf16.RuneLen(r)
+	}
+	return offset
+}
+
+// DecodeSIO07Packet decodes a single unframed packet.
+func decodeSIO07Packet(p []byte) (msg *sio07Message, err error) {
+	parts := bytes.SplitN(p, []byte{':'}, 4)
+	if len(parts) < 3 {
+		return nil, ErrMalformedPayload
+	}
+
+	msg = new(sio07Message)
+
+	if len(parts[0]) != 1 || parts[0][0] < '0' || parts[0][0] > '0'+SIO07PacketBinary {
+		return nil, errors.New("unknown packet type " + string(parts[0]))
+	}
+	msg.typ = parts[0][0] - '0'
+
+	if id := parts[1]; len(id) > 0 {
+		if id[len(id)-1] == '+' {
+			msg.ack = true
+			id = id[:len(id)-1]
+		}
+		if msg.id, err = strconv.Atoi(string(id)); err != nil || msg.id <= 0 {
+			return nil, errors.New("malformed message id " + string(parts[1]))
+		}
+	}
+
+	msg.endpoint = string(parts[2])
+
+	if len(parts) == 4 {
+		if msg.typ == SIO07PacketBinary {
+			if msg.data, err = decodeBinary(parts[3]); err != nil {
+				return nil, err
+			}
+		} else {
+			msg.data = make([]byte, len(parts[3]))
+			copy(msg.data, parts[3])
+		}
+	}
+
+	return
+}
@@ -0,0 +1,323 @@
+package socketio
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"unicode/utf16"
+)
+
+func sio07Frame(packet string) string {
+	return fmt.Sprintf("�%d�%s", len(utf16.Encode([]rune(packet))), packet)
+}
+
+type sio07EncodeTest struct {
+	in  interface{}
+	out string
+}
+
+var sio07EncodeTests = []sio07EncodeTest{
+	{
+		123,
+		sio07Frame("3:::123"),
+	},
+	{
+		"hello, world",
+		sio07Frame("3:::hello, world"),
+	},
+	{
+		"öäö¥£♥",
+		sio07Frame("3:::öäö¥£♥"),
+	},
+	{
+		// the length of a JavaScript string, i.e. two for a surrogate pair
+		"a😀",
+		"�7�3:::a😀",
+	},
+	{
+		heartbeat(123456),
+		sio07Frame("2::"),
+	},
+	{
+		handshake("abcdefg"),
+		sio07Frame("1:::abcdefg"),
+	},
+	{
+		disconnect(0),
+		sio07Frame("0::"),
+	},
+	{
+		binaryData{0, 0xff, 'a'},
+		sio07Frame("9:::AP9h"),
+	},
+	{
+		true,
+		sio07Frame("4:::true"),
+	},
+	{
+		struct {
+			Boolean bool
+			Str     string
+			Array   []int
+		}{
+			false,
+			"string♥",
+			[]int{1, 2, 3, 4},
+		},
+		sio07Frame(`4:::{"Boolean":false,"Str":"string♥","Array":[1,2,3,4]}`),
+	},
+	{
+		[]byte("hello, world"),
+		sio07Frame("3:::hello, world"),
+	},
+	{
+		SIO07Packet{Type: SIO07PacketConnect, Endpoint: "/chat"},
+		sio07Frame("1::/chat"),
+	},
+	{
+		&SIO07Packet{Type: SIO07PacketEvent, ID: 1, Ack: true, Endpoint: "/chat", Data: []byte(`{"name":"edwald","args":[{"a":"b"},2,"3"]}`)},
+		sio07Frame(`5:1+:/chat:{"name":"edwald","args":[{"a":"b"},2,"3"]}`),
+	},
+	{
+		SIO07Packet{Type: SIO07PacketAck, Data: []byte(`140+["A"]`)},
+		sio07Frame(`6:::140+["A"]`),
+	},
+	{
+		SIO07Packet{Type: SIO07PacketError, Endpoint: "/chat", Data: []byte("unauthorized+reconnect")},
+		sio07Frame("7::/chat:unauthorized+reconnect"),
+	},
+	{
+		SIO07Packet{Type: SIO07PacketNoop},
+		sio07Frame("8::"),
+	},
+}
+
+type sio07DecodeTestMessage struct {
+	messageType uint8
+	data        string
+	annotations map[string]string
+}
+
+type sio07DecodeTest struct {
+	in  string
+	out []sio07DecodeTestMessage
+}
+
+var sio07DecodeTests = []sio07DecodeTest{
+	{
+		"3:::wadap!",
+		[]sio07DecodeTestMessage{{MessageText, "wadap!", map[string]string{}}},
+	},
+	{
+		"2::",
+		[]sio07DecodeTestMessage{{MessageHeartbeat, "", map[string]string{}}},
+	},
+	{
+		sio07Frame("3:::♥wadap!"),
+		[]sio07DecodeTestMessage{{MessageText, "♥wadap!", map[string]string{}}},
+	},
+	{
+		sio07Frame(`4:1::{"a":"♥"}`) + sio07Frame("2::") + sio07Frame("3:2+:/chat:a:b:c"),
+		[]sio07DecodeTestMessage{
+			{MessageJSON, `{"a":"♥"}`, map[string]string{"id": "1"}},
+			{MessageHeartbeat, "", map[string]string{}},
+			{MessageText, "a:b:c", map[string]string{"id": "2", "ack": "data", "endpoint": "/chat"}},
+		},
+	},
+	{
+		"�7�3:::a😀�5�3:::b",
+		[]sio07DecodeTestMessage{
+			{MessageText, "a😀", map[string]string{}},
+			{MessageText, "b", map[string]string{}},
+		},
+	},
+	{
+		"1::/chat",
+		[]sio07DecodeTestMessage{{MessageConnect, "", map[string]string{"endpoint": "/chat"}}},
+	},
+	{
+		`5:::{"name":"edwald","args":[]}`,
+		[]sio07DecodeTestMessage{{MessageEvent, `{"name":"edwald","args":[]}`, map[string]string{}}},
+	},
+	{
+		`6:::140+["A"]`,
+		[]sio07DecodeTestMessage{{MessageAck, `140+["A"]`, map[string]string{}}},
+	},
+	{
+		"7:::unauthorized+reconnect",
+		[]sio07DecodeTestMessage{{MessageError, "unauthorized+reconnect", map[string]string{}}},
+	},
+	{
+		"0::/chat",
+		[]sio07DecodeTestMessage{{MessageDisconnect, "", map[string]string{"endpoint": "/chat"}}},
+	},
+	{
+		"8::",
+		[]sio07DecodeTestMessage{{MessageNoop, "", map[string]string{}}},
+	},
+	{
+		sio07Frame("9:::AP9h") + sio07Frame("9::/chat:"),
+		[]sio07DecodeTestMessage{
+			{MessageBinary, "\x00\xffa", map[string]string{}},
+			{MessageBinary, "", map[string]string{"endpoint": "/chat"}},
+		},
+	},
+	{
+		"9:::fael!",
+		nil,
+	},
+	{
+		"3:x::fael!",
+		nil,
+	},
+	{
+		"�x�3:::fael!",
+		nil,
+	},
+	{
+		"3:::wadap!",
+		[]sio07DecodeTestMessage{{MessageText, "wadap!", map[string]string{}}},
+	},
+}
+
+func TestSIO07Encode(t *testing.T) {
+	codec := SIO07Codec{}
+	enc := codec.NewEncoder()
+	buf := new(bytes.Buffer)
+
+	for _, test := range sio07EncodeTests {
+		t.Logf("in=%v out=%s", test.in, test.out)
+
+		buf.Reset()
+		if err := enc.Encode(buf, test.in); err != nil {
+			t.Fatal("Encode:", err)
+		}
+		if string(buf.Bytes()) != test.out {
+			t.Fatalf("Expected %q but got %q from %q", test.out, string(buf.Bytes()), test.in)
+		}
+	}
+}
+
+func TestSIO07Decode(t *testing.T) {
+	codec := SIO07Codec{}
+	buf := new(bytes.Buffer)
+	dec := codec.NewDecoder(buf)
+	var messages []Message
+	var err error
+
+	for _, test := range sio07DecodeTests {
+		t.Logf("in=%s out=%v", test.in, test.out)
+
+		buf.WriteString(test.in)
+		if messages, err = dec.Decode(); err != nil {
+			if test.out == nil {
+				continue
+			}
+			t.Fatal("Decode:", err)
+		}
+		if test.out == nil {
+			t.Fatalf("Expected decode error, but got: %v, %v", messages, err)
+		}
+		if len(messages) != len(test.out) {
+			t.Fatalf("Expected %d messages, but got %d", len(test.out), len(messages))
+		}
+		for i, msg := range messages {
+			if test.out[i].messageType != msg.Type() {
+				t.Logf("Message was: %#v", msg)
+				t.Fatalf("Expected type %d but got %d", test.out[i].messageType, msg.Type())
+			}
+			if test.out[i].data != msg.Data() {
+				t.Fatalf("Expected data %q but got %q", test.out[i].data, msg.Data())
+			}
+			annotations := msg.Annotations()
+			if len(annotations) != len(test.out[i].annotations) {
+				t.Fatalf("Expected annotations %v but got %v", test.out[i].annotations, annotations)
+			}
+			for k, v := range test.out[i].annotations {
+				if annotations[k] != v {
+					t.Fatalf("Expected annotations %v but got %v", test.out[i].annotations, annotations)
+				}
+			}
+		}
+	}
+}
+
+func TestSIO07RoundTrip(t *testing.T) {
+	codec := SIO07Codec{}
+	enc := codec.NewEncoder()
+	buf := new(bytes.Buffer)
+	dec := codec.NewDecoder(buf)
+
+	packets := []SIO07Packet{
+		{Type: SIO07PacketDisconnect, Endpoint: "/chat"},
+		{Type: SIO07PacketConnect, Endpoint: "/chat"},
+		{Type: SIO07PacketHeartbeat},
+		{Type: SIO07PacketMessage, ID: 7, Data: []byte("♥:wadap!")},
+		{Type: SIO07PacketJSON, ID: 8, Ack: true, Data: []byte(`{"a":1}`)},
+		{Type: SIO07PacketEvent, Endpoint: "/news", Data: []byte(`{"name":"tweet","args":["♥"]}`)},
+		{Type: SIO07PacketAck, Data: []byte("8")},
+		{Type: SIO07PacketError, Data: []byte("reason+advice")},
+		{Type: SIO07PacketNoop},
+	}
+
+	for _, p := range packets {
+		if err := enc.Encode(buf, p); err != nil {
+			t.Fatal("Encode:", err)
+		}
+	}
+
+	messages, err := dec.Decode()
+	if err != nil {
+		t.Fatal("Decode:", err)
+	}
+	if len(messages) != len(packets) {
+		t.Fatalf("Expected %d messages, but got %d", len(packets), len(messages))
+	}
+
+	for i, msg := range messages {
+		m := msg.(*sio07Message)
+		p := packets[i]
+		if m.typ != p.Type || m.id != p.ID || m.ack != p.Ack || m.endpoint != p.Endpoint || !bytes.Equal(m.data, p.Data) {
+			t.Fatalf("Expected %#v but got %#v", p, m)
+		}
+	}
+}
+
+func TestSIO07DecodeStreaming(t *testing.T) {
+	var messages []Message
+	var err error
+	codec := SIO07Codec{}
+	buf := new(bytes.Buffer)
+	dec := codec.NewDecoder(buf)
+
+	expectNothing := func(written string) {
+		if messages, err = dec.Decode(); err != nil || messages == nil || len(messages) != 0 {
+			t.Fatalf("Partial decode failed after writing %s. err=%#v messages=%#v", written, err, messages)
+		}
+	}
+
+	buf.WriteString("�")
+	expectNothing("�")
+	buf.WriteString("1")
+	expectNothing("�1")
+	buf.WriteString("0�")
+	expectNothing("�10�")
+	buf.WriteString("3:::12")
+	expectNothing("�10�3:::12")
+	buf.WriteString("\xe2\x99")
+	expectNothing("�10�3:::12\xe2\x99")
+	buf.WriteString("\xa5456�")
+	messages, err = dec.Decode()
+	if err != nil {
+		t.Fatalf("Did not expect errors: %s", err)
+	}
+	if messages == nil || len(messages) != 1 {
+		t.Fatalf("Expected 1 message, got: %#v", messages)
+	}
+	if messages[0].Type() != MessageText || messages[0].Data() != "12♥456" {
+		t.Fatalf("Expected data 12♥456 and text, got: %#v", messages[0])
+	}
+	if buf.String() != "�" {
+		t.Fatalf("Expected the next frame to be left in the buffer, got: %q", buf.String())
+	}
+}
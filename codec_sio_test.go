@@ -1,19 +1,18 @@
 package socketio
 
 import (
-	"testing"
-	"utf8"
-	"fmt"
 	"bytes"
-	"os"
+	"fmt"
+	"testing"
+	"unicode/utf8"
 )
 
 func frame(data string, json bool) string {
-	utf8str := utf8.NewString(data)
+	n := utf8.RuneCountInString(data)
 	if json {
-		return fmt.Sprintf("~m~%d~m~~j~%s", 3+utf8str.RuneCount(), data)
+		return fmt.Sprintf("~m~%d~m~~j~%s", 3+n, data)
 	}
-	return fmt.Sprintf("~m~%d~m~%s", utf8str.RuneCount(), data)
+	return fmt.Sprintf("~m~%d~m~%s", n, data)
 }
 
 type encodeTest struct {
@@ -66,9 +65,12 @@ var encodeTests = []encodeTest{
 		[]byte("hello, world"),
 		frame("hello, world", false),
 	},
+	{
+		binaryData{0, 0xff, 'a'},
+		frame("~b~AP9h", false),
+	},
 }
 
-
 type decodeTestMessage struct {
 	messageType uint8
 	data        string
@@ -110,6 +112,17 @@ var decodeTests = []decodeTest{
 		"1:3::fael!,",
 		nil,
 	},
+	{
+		frame("~b~AP9h", false) + frame("~b~", false),
+		[]decodeTestMessage{
+			{MessageBinary, "\x00\xffa", -1},
+			{MessageBinary, "", -1},
+		},
+	},
+	{
+		frame("~b~AP9", false),
+		nil,
+	},
 	{
 		frame("wadap!", false),
 		[]decodeTestMessage{{MessageText, "wadap!", -1}},
@@ -139,7 +152,7 @@ func TestDecode(t *testing.T) {
 	buf := new(bytes.Buffer)
 	dec := codec.NewDecoder(buf)
 	var messages []Message
-	var err os.Error
+	var err error
 
 	for _, test := range decodeTests {
 		t.Logf("in=%s out=%v", test.in, test.out)
@@ -176,7 +189,7 @@ func TestDecode(t *testing.T) {
 
 func TestDecodeStreaming(t *testing.T) {
 	var messages []Message
-	var err os.Error
+	var err error
 	codec := SIOCodec{}
 	buf := new(bytes.Buffer)
 	dec := codec.NewDecoder(buf)
@@ -2,12 +2,12 @@ package socketio
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"json"
-	"os"
 	"strconv"
-	"utf8"
+	"unicode/utf8"
 )
 
 // SIOStreamingCodec is the codec used by the official Socket.IO client by LearnBoost
@@ -23,10 +23,11 @@ func (sc SIOStreamingCodec) NewEncoder() Encoder {
 }
 
 // Encode takes payload, encodes it and writes it to dst. Payload must be one
-// of the following: a heartbeat, a handshake, []byte, string, int or anything
-// than can be marshalled by the default json package. If payload can't be
-// encoded or the writing fails, an error will be returned.
-func (enc *sioStreamingEncoder) Encode(dst io.Writer, payload interface{}) (err os.Error) {
+// of the following: a heartbeat, a handshake, a disconnect, binary data, []byte,
+// string, int or anything than can be marshalled by the default json package.
+// The binary data is encoded in base64 and annotated with SIOAnnotationBinary.
+// If payload can't be encoded or the writing fails, an error will be returned.
+func (enc *sioStreamingEncoder) Encode(dst io.Writer, payload interface{}) (err error) {
 	enc.elem.Reset()
 
 	switch t := payload.(type) {
@@ -37,6 +38,13 @@ func (enc *sioStreamingEncoder) Encode(dst io.Writer, payload interface{}) (err
 	case handshake:
 		_, err = fmt.Fprintf(dst, "%d:%d:%s,", sioMessageTypeHandshake, len(t), t)
 
+	case disconnect:
+		_, err = fmt.Fprintf(dst, "%d:0:,", sioMessageTypeDisconnect)
+
+	case binaryData:
+		data := encodeBinary(t)
+		_, err = fmt.Fprintf(dst, "%d:%d:%s\n:%s,", sioMessageTypeMessage, 2+len(SIOAnnotationBinary)+len(data), SIOAnnotationBinary, data)
+
 	case []byte:
 		l := utf8.RuneCount(t)
 		if l == 0 {
@@ -115,10 +123,10 @@ func (dec *sioStreamingDecoder) Reset() {
 	dec.length = 0
 }
 
-func (dec *sioStreamingDecoder) Decode() (messages []Message, err os.Error) {
+func (dec *sioStreamingDecoder) Decode() (messages []Message, err error) {
 	messages = make([]Message, 0, 1)
-	var c int
-	var typ uint
+	var c rune
+	var typ uint64
 
 L:
 	for {
@@ -136,7 +144,7 @@ L:
 		switch dec.state {
 		case sioStreamingDecodeStateType:
 			if c == ':' {
-				if typ, err = strconv.Atoui(dec.buf.String()); err != nil {
+				if typ, err = strconv.ParseUint(dec.buf.String(), 10, 8); err != nil {
 					dec.Reset()
 					return nil, err
 				}
@@ -186,7 +194,7 @@ L:
 			case '\n':
 				if dec.buf.Len() == 0 {
 					dec.Reset()
-					return nil, os.NewError("expecting key, but got...")
+					return nil, errors.New("expecting key, but got...")
 				}
 				dec.key = dec.buf.String()
 				if dec.msg.annotations == nil {
@@ -224,11 +232,8 @@ L:
 				dec.buf.WriteRune(c)
 				dec.length--
 
-				utf8str := utf8.NewString(dec.src.String())
-				if utf8str.RuneCount() >= dec.length {
-					str := utf8str.Slice(0, dec.length)
-					dec.buf.WriteString(str)
-					dec.src.Next(len(str))
+				if n := runeOffset(dec.src.Bytes(), dec.length); n >= 0 {
+					dec.buf.Write(dec.src.Next(n))
 					dec.length = 0
 					continue
 				} else {
@@ -237,8 +242,15 @@ L:
 			}
 
 			data := dec.buf.Bytes()
-			dec.msg.data = make([]byte, len(data))
-			copy(dec.msg.data, data)
+			if _, ok := dec.msg.Annotation(SIOAnnotationBinary); ok && dec.msg.typ == sioMessageTypeMessage {
+				if dec.msg.data, err = decodeBinary(data); err != nil {
+					dec.Reset()
+					return nil, err
+				}
+			} else {
+				dec.msg.data = make([]byte, len(data))
+				copy(dec.msg.data, data)
+			}
 
 			dec.buf.Reset()
 			dec.state = sioStreamingDecodeStateTrailer
@@ -251,14 +263,14 @@ L:
 				continue
 			} else {
 				dec.Reset()
-				return nil, os.NewError("Expecting trailer but got... " + string(c))
+				return nil, errors.New("Expecting trailer but got... " + string(c))
 			}
 		}
 
 		dec.buf.WriteRune(c)
 	}
 
-	if err == os.EOF {
+	if err == io.EOF {
 		err = nil
 	}
 
@@ -1,28 +1,27 @@
 package socketio
 
 import (
-	"testing"
-	"utf8"
-	"fmt"
 	"bytes"
+	"fmt"
+	"testing"
+	"unicode/utf8"
 	"unsafe"
-	"os"
 )
 
 func streamingFrame(data string, typ int, json bool) string {
-	utf8str := utf8.NewString(data)
+	n := utf8.RuneCountInString(data)
 	switch typ {
 	case 0:
 		return "0:0:,"
 
 	case 2, 3:
-		return fmt.Sprintf("%d:%d:%s,", typ, utf8str.RuneCount(), data)
+		return fmt.Sprintf("%d:%d:%s,", typ, n, data)
 	}
 
 	if json {
-		return fmt.Sprintf("%d:%d:j\n:%s,", typ, 3+utf8str.RuneCount(), data)
+		return fmt.Sprintf("%d:%d:j\n:%s,", typ, 3+n, data)
 	}
-	return fmt.Sprintf("%d:%d::%s,", typ, 1+utf8str.RuneCount(), data)
+	return fmt.Sprintf("%d:%d::%s,", typ, 1+n, data)
 }
 
 type streamingEncodeTest struct {
@@ -75,9 +74,12 @@ var streamingEncodeTests = []streamingEncodeTest{
 		[]byte("hello, world"),
 		streamingFrame("hello, world", 1, false),
 	},
+	{
+		binaryData{0, 0xff, 'a'},
+		"1:7:b\n:AP9h,",
+	},
 }
 
-
 type streamingDecodeTestMessage struct {
 	messageType uint8
 	data        string
@@ -119,6 +121,14 @@ var streamingDecodeTests = []streamingDecodeTest{
 		"1:3::fael!,",
 		nil,
 	},
+	{
+		"1:7:b\n:AP9h,",
+		[]streamingDecodeTestMessage{{MessageBinary, "\x00\xffa", -1}},
+	},
+	{
+		"1:6:b\n:AP9,",
+		nil,
+	},
 	{
 		streamingFrame("wadap!", 1, false),
 		[]streamingDecodeTestMessage{{MessageText, "wadap!", -1}},
@@ -148,7 +158,7 @@ func TestStreamingDecode(t *testing.T) {
 	buf := new(bytes.Buffer)
 	dec := codec.NewDecoder(buf)
 	var messages []Message
-	var err os.Error
+	var err error
 
 	for _, test := range streamingDecodeTests {
 		t.Logf("in=%s out=%v", test.in, test.out)
@@ -185,7 +195,7 @@ func TestStreamingDecode(t *testing.T) {
 
 func TestStreamingDecodeStreaming(t *testing.T) {
 	var messages []Message
-	var err os.Error
+	var err error
 	codec := SIOStreamingCodec{}
 	buf := new(bytes.Buffer)
 	dec := codec.NewDecoder(buf)
@@ -1,53 +1,168 @@
 package socketio
 
-import "log"
+import (
+	"time"
+)
 
 // Config represents a set of configurable settings used by the server
 type Config struct {
-	// Maximum number of connections.
+	// Maximum number of connections. Zero means no limit.
 	MaxConnections int
 
+	// What to do with a new connection when there are MaxConnections
+	// connections.
+	ConnectionLimitPolicy LimitPolicy
+
+	// Period during which a new connection may wait for a free slot with the
+	// LimitPolicyQueue.
+	ConnectionQueueTimeout time.Duration
+
+	// Maximum number of connections from a single remote IP. Zero means no
+	// limit.
+	MaxConnectionsPerIP int
+
+	// The value of the Retry-After header of the refused connections. Zero
+	// leaves the header out.
+	RetryAfter time.Duration
+
 	// Maximum amount of messages to store for a connection. If a connection
 	// has QueueLength amount of undelivered messages, the following Sends will
 	// return ErrQueueFull error.
 	QueueLength int
 
+	// What Send does when the send queue of a connection is full.
+	OverflowPolicy OverflowPolicy
+
+	// Maximum amount of sent messages kept per session for a replay to the
+	// clients that reconnect after missing some of them. Zero, the default,
+	// disables the replay, unless ReplayStorage is set.
+	ReplayBufferSize int
+
+	// Storage to keep the sent messages in for a replay. If nil, each server
+	// uses a new MemoryReplayStorage with ReplayBufferSize capacity.
+	ReplayStorage ReplayStorage
+
+	// Period during which the replay buffer of a session that timed out is
+	// kept, so that the client can resume the session by reconnecting with its
+	// session id and the seq parameter. Zero discards the buffer right away.
+	ReplayRetention time.Duration
+
 	// The size of the read buffer in bytes.
 	ReadBufferSize int
 
+	// Maximum size of a received message in bytes. Zero means no limit.
+	MaxMessageSize int
+
+	// Maximum number of received bytes buffered for decoding, which is also
+	// the maximum size of the POSTed request bodies. The larger bodies are
+	// refused regardless of the ViolationAction. Zero means no limit.
+	MaxBufferedBytes int
+
+	// Number of messages per second a connection may send, and the number of
+	// messages it may send in a burst. Zero rate means no limit.
+	MessageRate  float64
+	MessageBurst int
+
+	// What to do when a connection exceeds the limits above.
+	ViolationAction ViolationAction
+
 	// The interval between heartbeats
-	HeartbeatInterval int64
+	HeartbeatInterval time.Duration
 
-	// Period in ns during which the client must reconnect or it is considered
+	// Period during which the client must reconnect or it is considered
 	// disconnected.
-	ReconnectTimeout int64
+	ReconnectTimeout time.Duration
+
+	// Period during which a client probing an upgrade to another transport
+	// must complete it. Zero means no timeout.
+	UpgradeTimeout time.Duration
 
-	// Origins to allow for cross-domain requests.
-	// For example: ["localhost:8080", "myblog.com:*"].
+	// Origins to allow for cross-domain requests. Each is the Pattern of an
+	// OriginRule, for example: ["localhost:8080", "myblog.com:*",
+	// "https://*.example.com"].
 	Origins []string
 
+	// Rules to allow the cross-domain requests of the origins not allowed by
+	// the Origins, e.g. with a regexp or a callback.
+	OriginRules []OriginRule
+
+	// CORS policy of the allowed origins, unless their OriginRule has one.
+	CORS CORSPolicy
+
+	// Generator of the session ids. If nil, the DefaultSessionIDGenerator is
+	// used.
+	SessionIDGenerator SessionIDGenerator
+
+	// Signed session tokens to require from the clients. If nil, the bare
+	// session ids are accepted.
+	SessionTokens *SessionTokenConfig
+
 	// Transports to use.
 	Transports []Transport
 
 	// Codec to use.
 	Codec Codec
 
+	// Session store to use. If nil, each server uses a new MemorySessionStore.
+	SessionStore SessionStore
+
+	// The name of the server in the SessionStore and on the Bus of a
+	// PubSubAdapter, which must be unique among the servers sharing them. If
+	// empty, a random one is generated.
+	NodeID string
+
+	// The URL at which the other servers sharing the SessionStore can reach
+	// this one, e.g. http://10.0.0.1:8080. If set, the requests for the
+	// sessions of this server that arrive at another server are forwarded
+	// here. Otherwise they are refused with 421 Misdirected Request.
+	NodeURL string
+
+	// Adapter to use for the broadcasts. If nil, each server uses a new
+	// LocalAdapter.
+	Adapter Adapter
+
+	// Metrics to record the instrumentation to. If nil, nothing is recorded.
+	Metrics Metrics
+
 	// The resource to bind to, e.g. /socket.io/
 	Resource string
 
-	// Logger to use.
-	Logger *log.Logger
+	// Logger to pass the events to. If nil, nothing is logged.
+	Logger Logger
 }
 
 var DefaultConfig = Config{
-	MaxConnections:    0,
-	QueueLength:       10,
-	ReadBufferSize:    2048,
-	HeartbeatInterval: 10e9,
-	ReconnectTimeout:  10e9,
-	Origins:           nil,
-	Transports:        DefaultTransports,
-	Codec:             SIOCodec{},
-	Resource:          "/socket.io/",
-	Logger:            DefaultLogger,
+	MaxConnections:         0,
+	ConnectionLimitPolicy:  LimitPolicyReject,
+	ConnectionQueueTimeout: time.Second,
+	MaxConnectionsPerIP:    0,
+	RetryAfter:             5 * time.Second,
+	QueueLength:            10,
+	OverflowPolicy:         OverflowDropNewest,
+	ReplayBufferSize:       0,
+	ReplayStorage:          nil,
+	ReplayRetention:        0,
+	ReadBufferSize:         2048,
+	MaxMessageSize:         0,
+	MaxBufferedBytes:       0,
+	MessageRate:            0,
+	MessageBurst:           0,
+	ViolationAction:        ViolationDrop,
+	HeartbeatInterval:      10 * time.Second,
+	ReconnectTimeout:       10 * time.Second,
+	UpgradeTimeout:         10 * time.Second,
+	Origins:                nil,
+	OriginRules:            nil,
+	CORS:                   DefaultCORSPolicy,
+	SessionTokens:          nil,
+	SessionIDGenerator:     nil,
+	Transports:             DefaultTransports,
+	Codec:                  SIOCodec{},
+	SessionStore:           nil,
+	NodeID:                 "",
+	NodeURL:                "",
+	Adapter:                nil,
+	Metrics:                nil,
+	Resource:               "/socket.io/",
+	Logger:                 DefaultLogger,
 }
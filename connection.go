@@ -1,25 +1,31 @@
 package socketio
 
 import (
-	"http"
-	"os"
-	"net"
 	"bytes"
-	"time"
+	"context"
+	"errors"
 	"fmt"
+	"net"
+	"net/http"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 var (
 	// ErrDestroyed is used when the connection has been disconnected (i.e. can't be used anymore).
-	ErrDestroyed = os.NewError("connection is disconnected")
+	ErrDestroyed = errors.New("connection is disconnected")
 
 	// ErrQueueFull is used when the send queue is full.
-	ErrQueueFull = os.NewError("send queue is full")
+	ErrQueueFull = errors.New("send queue is full")
 
-	errMissingPostData = os.NewError("Missing HTTP post data-field")
+	errMissingPostData = errors.New("Missing HTTP post data-field")
 )
 
+// The number of the goroutines of a connection, i.e. the keepalive, the
+// flusher and the reader started by attach, which are tracked by Shutdown.
+const connGoroutines = 3
+
 // Conn represents a single session and handles its handshaking,
 // message buffering and reconnections.
 type Conn struct {
@@ -28,8 +34,8 @@ type Conn struct {
 	sio              *SocketIO // The server.
 	sessionid        SessionID
 	online           bool
-	lastConnected    int64
-	lastDisconnected int64
+	lastConnected    time.Time
+	lastDisconnected time.Time
 	lastHeartbeat    heartbeat
 	numHeartbeats    int
 	ticker           *time.Ticker
@@ -39,36 +45,60 @@ type Conn struct {
 	disconnected     bool             // Indicates if the connection has been disconnected.
 	wakeupFlusher    chan byte        // Used internally to wake up the flusher.
 	wakeupReader     chan byte        // Used internally to wake up the reader.
+	closed           chan byte        // Closed when the connection gets disconnected.
+	flushing         bool             // Indicates if the flusher is holding unwritten messages.
+	dequeued         chan struct{}    // Closed and replaced when the flusher takes messages from the queue.
+	seq              uint64           // The sequence number of the latest message taken for a write.
+	written          uint64           // The sequence number of the latest message known to be written.
+	resumed          bool             // Indicates if the session was resumed from its replay buffer.
 	enc              Encoder
 	dec              Decoder
 	decBuf           bytes.Buffer
 	raddr            string
+	logAddr          atomic.Pointer[connLogAddr]
+	ip               string                  // The remote IP the connection was admitted for.
+	admitted         bool                    // Indicates if the connection holds a slot, protected by sio.limitLock.
+	tokens           float64                 // The tokens left in the message rate bucket.
+	lastRefill       time.Time               // The time the message rate bucket was last refilled.
+	rooms            map[string]bool         // The rooms joined, protected by sio.sessionsLock.
+	namespaces       map[string]bool         // The namespaces connected to, protected by sio.sessionsLock.
+	lastAckID        int                     // The id of the latest message sent with SendWithAck.
+	pendingAcks      map[int]*pendingAck     // The messages waiting for an acknowledgement.
+	identity         interface{}             // The identity returned by the Authorizer.
+	handshakeData    *HandshakeData          // Describes the request that established the session.
+	token            string                  // The session token given to the client, if any.
+	ctx              context.Context         // Cancelled when the connection gets disconnected.
+	cancel           context.CancelCauseFunc // Cancels ctx.
+	valuesLock       sync.RWMutex            // Protects values.
+	values           map[string]interface{}  // The values stored by the user.
 }
 
 // NewConn creates a new connection for the sio. It generates the session id and
 // prepares the internal structure for usage.
-func newConn(sio *SocketIO) (c *Conn, err os.Error) {
+func newConn(sio *SocketIO) (c *Conn, err error) {
 	var sessionid SessionID
-	if sessionid, err = NewSessionID(); err != nil {
-		sio.Log("sio/newConn: newSessionID:", err)
+	if sessionid, err = sio.sessionIDs.NewSessionID(); err != nil {
+		sio.log(LogError, "sio/newConn: unable to generate a session id", "new_session_id", LogKeyError, err)
 		return
 	}
 
 	c = &Conn{
 		sio:           sio,
 		sessionid:     sessionid,
-		wakeupFlusher: make(chan byte),
+		wakeupFlusher: make(chan byte, 1),
 		wakeupReader:  make(chan byte),
+		closed:        make(chan byte),
+		dequeued:      make(chan struct{}),
 		queue:         make(chan interface{}, sio.config.QueueLength),
 		enc:           sio.config.Codec.NewEncoder(),
 	}
 
 	c.dec = sio.config.Codec.NewDecoder(&c.decBuf)
+	c.ctx, c.cancel = context.WithCancelCause(context.Background())
 
 	return
 }
 
-
 // String returns a string representation of the connection and implements the
 // fmt.Stringer interface.
 func (c *Conn) String() string {
@@ -77,32 +107,28 @@ func (c *Conn) String() string {
 
 // RemoteAddr returns the remote network address of the connection in IP:port format
 func (c *Conn) RemoteAddr() string {
-	return c.raddr
+	if a := c.logAddr.Load(); a != nil {
+		return a.raddr
+	}
+	return ""
 }
 
 // Send queues data for a delivery. It is totally content agnostic with one exception:
 // the given data must be one of the following: a handshake, a heartbeat, an int, a string or
-// it must be otherwise marshallable by the standard json package. If the send queue
-// has reached sio.config.QueueLength or the connection has been disconnected,
-// then the data is dropped and a an error is returned.
-func (c *Conn) Send(data interface{}) (err os.Error) {
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
-
-	if c.disconnected {
-		return ErrDestroyed
-	}
-
-	select {
-	case c.queue <- data:
-	default:
-		return ErrQueueFull
-	}
+// it must be otherwise marshallable by the standard json package. If the connection
+// has been disconnected, the data is dropped and an error is returned. If the send
+// queue has reached sio.config.QueueLength, the sio.config.OverflowPolicy decides
+// which message is dropped.
+func (c *Conn) Send(data interface{}) (err error) {
+	return c.send(data)
+}
 
-	return nil
+func (c *Conn) Close() error {
+	return c.close(DisconnectReasonClosed)
 }
 
-func (c *Conn) Close() os.Error {
+// Close disconnects the connection for the given reason.
+func (c *Conn) close(reason string) error {
 	c.mutex.Lock()
 
 	if c.disconnected {
@@ -110,7 +136,7 @@ func (c *Conn) Close() os.Error {
 		return ErrNotConnected
 	}
 
-	c.disconnect()
+	c.disconnect(reason)
 	c.mutex.Unlock()
 
 	c.sio.onDisconnect(c)
@@ -122,7 +148,7 @@ func (c *Conn) Close() os.Error {
 // message and the request is dropped. If the method is GET then a new socket encapsulating
 // the request is created and a new connection is establised (or the connection will be
 // reconnected). Finally, handle will wake up the reader and the flusher.
-func (c *Conn) handle(t Transport, w http.ResponseWriter, req *http.Request) (err os.Error) {
+func (c *Conn) handle(t Transport, w http.ResponseWriter, req *http.Request) (err error) {
 	c.mutex.Lock()
 
 	if c.disconnected {
@@ -133,117 +159,261 @@ func (c *Conn) handle(t Transport, w http.ResponseWriter, req *http.Request) (er
 	if req.Method == "POST" {
 		c.mutex.Unlock()
 
+		if max := c.sio.config.MaxBufferedBytes; max > 0 {
+			req.Body = http.MaxBytesReader(w, req.Body, int64(max))
+		}
+
+		// an oversized body has not been read in full, so it is refused
+		// even with ViolationWarn
+		if err = req.ParseForm(); err != nil {
+			var mbe *http.MaxBytesError
+			if errors.As(err, &mbe) {
+				c.violate(ErrBufferOverflow)
+				return ErrBufferOverflow
+			}
+			err = nil
+		}
+
 		if msg := req.FormValue("data"); msg != "" {
 			w.Header().Set("Content-Type", "text/plain")
 			w.Write(okResponse)
-			c.receive([]byte(msg))
+			c.receive(t.Resource(), []byte(msg))
 		} else {
-			c.sio.Log("sio/conn: handle: POST missing data-field:", c)
+			c.log(LogWarn, "sio/conn: POST missing data-field", "missing_data", LogKeyRemoteAddr, req.RemoteAddr)
 			err = errMissingPostData
 		}
 
 		return
 	}
 
+	if c.handshaked && req.URL.Query().Get("upgrade") != "" {
+		c.mutex.Unlock()
+		return c.upgrade(t, w, req)
+	}
+
 	didHandshake := false
+	proceeded := false
 
 	s := t.newSocket()
 	err = s.accept(w, req, func() {
-		if c.socket != nil {
-			c.socket.Close()
-		}
-		c.socket = s
-		c.online = true
-		c.lastConnected = time.Nanoseconds()
-
-		if !c.handshaked {
-			// the connection has not been handshaked yet.
-			if err = c.handshake(); err != nil {
-				c.sio.Log("sio/conn: handle/handshake:", err, c)
-				c.socket.Close()
-				return
-			}
+		// the polling sockets keep the request until the response is
+		// written, so c.mutex is released before accept returns
+		proceeded = true
+		didHandshake = c.attach(t, s, req)
+		c.mutex.Unlock()
 
-			c.raddr = req.RemoteAddr
-			c.handshaked = true
-			didHandshake = true
+		if didHandshake {
+			c.sio.onConnect(c)
+		}
+	})
 
-			go c.keepalive()
-			go c.flusher()
-			go c.reader()
+	if !proceeded {
+		c.mutex.Unlock()
+	}
 
-			c.sio.Log("sio/conn: connected:", c)
-		} else {
-			c.sio.Log("sio/conn: reconnected:", c)
-		}
+	return
+}
 
-		c.numConns++
+// Attach makes s the socket of the connection. It sends the handshake and
+// starts the goroutines of the connection if it has not been handshaked yet,
+// in which case it returns true. The caller holds c.mutex.
+func (c *Conn) attach(t Transport, s socket, req *http.Request) bool {
+	didHandshake := false
 
-		select {
-		case c.wakeupFlusher <- 1:
-		default:
+	if c.socket != nil {
+		c.socket.Close()
+	}
+	c.socket = s
+	c.publishLogAddr()
+	c.labelEvents()
+	c.online = true
+	c.lastConnected = time.Now()
+
+	if !c.handshaked {
+		// the connection has not been handshaked yet, unless it resumes
+		// a session the client already has the id of.
+		if c.resumed {
+			c.log(LogInfo, "sio/conn: resumed", "resumed")
+		} else if err := c.handshake(); err != nil {
+			c.log(LogWarn, "sio/conn: unable to handshake", "handshake", LogKeyError, err)
+			c.socket.Close()
+			return false
 		}
 
-		select {
-		case c.wakeupReader <- 1:
-		default:
+		// a new session that got past the check of handle while Shutdown
+		// was invoked is refused
+		if !c.sio.track(connGoroutines) {
+			c.log(LogInfo, "sio/conn: refused while shutting down", "shutdown")
+			c.socket.Close()
+			return false
 		}
 
-		if didHandshake {
-			c.mutex.Unlock()
-			c.sio.onConnect(c)
-		}
-	})
+		c.raddr = req.RemoteAddr
+		c.publishLogAddr()
+		c.handshaked = true
+		didHandshake = true
 
-	if !didHandshake {
-		c.mutex.Unlock()
+		go c.keepalive()
+		go c.flusher()
+		go c.reader()
+
+		c.log(LogInfo, "sio/conn: connected", "connected")
+	} else {
+		c.log(LogInfo, "sio/conn: reconnected", "reconnected", "conns", c.numConns)
 	}
 
-	return
+	// the sockets refused above are not counted, since the reader never
+	// records them closed
+	c.sio.metrics.SocketOpened(t.Resource(), c.numConns > 0)
+
+	c.replay(req)
+	c.numConns++
+
+	select {
+	case c.wakeupFlusher <- 1:
+	default:
+	}
+
+	select {
+	case c.wakeupReader <- 1:
+	default:
+	}
+
+	return didHandshake
 }
 
 // Handshake sends the handshake to the socket.
-func (c *Conn) handshake() os.Error {
-	return c.enc.Encode(c.socket, handshake(c.sessionid))
+func (c *Conn) handshake() error {
+	return c.enc.Encode(c.socket, handshake(c.publicID()))
 }
 
-
-func (c *Conn) disconnect() {
-	c.sio.Log("sio/conn: disconnected:", c)
-	c.socket.Close()
+func (c *Conn) disconnect(reason string) {
+	c.log(LogInfo, "sio/conn: disconnected", "disconnected", "reason", reason)
+	c.sio.metrics.SessionClosed(reason)
+	c.sio.releaseReplay(c.sessionid, reason)
+	if c.socket != nil {
+		c.socket.Close()
+	}
 	c.disconnected = true
 	close(c.wakeupFlusher)
 	close(c.wakeupReader)
 	close(c.queue)
+	close(c.closed)
+	c.cancel(disconnectCause(reason))
+	c.abortAcks()
+}
+
+// Drained reports whether all the queued messages have been written to the socket.
+func (c *Conn) drained() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.disconnected || (len(c.queue) == 0 && !c.flushing && c.written == c.seq)
 }
 
 // Receive decodes and handles data received from the socket.
 // It uses c.sio.codec to decode the data. The received non-heartbeat
 // messages (frames) are then passed to c.sio.onMessage method and the
-// heartbeats are processed right away (TODO).
-func (c *Conn) receive(data []byte) {
+// heartbeats are processed right away (TODO). Acknowledgements are matched
+// with the pending acks and the messages requesting a plain acknowledgement
+// are acknowledged before they are passed on.
+func (c *Conn) receive(transport string, data []byte) {
+	if max := c.sio.config.MaxBufferedBytes; max > 0 && c.decBuf.Len()+len(data) > max {
+		switch c.violate(ErrBufferOverflow) {
+		case ViolationDrop:
+			c.sio.metrics.MessagesDropped(DropReasonOverflow, 1)
+			c.dec.Reset()
+			return
+
+		case ViolationDisconnect:
+			return
+		}
+	}
+
 	c.decBuf.Write(data)
 	msgs, err := c.dec.Decode()
 	if err != nil {
-		c.sio.Log("sio/conn: receive/decode:", err, c)
+		c.log(LogWarn, "sio/conn: unable to decode", "decode", LogKeyError, err)
 		return
 	}
 
+	c.sio.metrics.MessagesReceived(transport, len(msgs), len(data))
+	c.dispatch(msgs)
+}
+
+// Dispatch handles the received messages. The heartbeats are processed right
+// away, the inbound limits are checked and the rest are passed on to
+// c.sio.onMessage.
+func (c *Conn) dispatch(msgs []Message) {
 	for _, m := range msgs {
 		if hb, ok := m.heartbeat(); ok {
+			c.mutex.Lock()
+			if hb < 0 {
+				// the codec does not carry heartbeat values, so
+				// accept it as a reply to the latest heartbeat.
+				hb = heartbeat(c.numHeartbeats)
+			}
 			c.lastHeartbeat = hb
-		} else {
-			c.sio.onMessage(c, m)
+			c.mutex.Unlock()
+			c.sio.store.Touch(c.sessionid, c.sio.node)
+			continue
+		}
+
+		if max := c.sio.config.MaxMessageSize; max > 0 && len(m.Data()) > max {
+			switch c.violate(ErrMessageTooLarge) {
+			case ViolationDrop:
+				c.sio.metrics.MessagesDropped(DropReasonTooLarge, 1)
+				continue
+
+			case ViolationDisconnect:
+				return
+			}
+		}
+
+		if !c.allowMessage() {
+			switch c.violate(ErrRateLimited) {
+			case ViolationDrop:
+				c.sio.metrics.MessagesDropped(DropReasonRateLimited, 1)
+				continue
+
+			case ViolationDisconnect:
+				return
+			}
+		}
+
+		if c.sio.supportsPackets() {
+			if m.Type() == MessageAck {
+				c.receiveAck(m)
+				continue
+			}
+
+			if id, ok := ackID(m); ok {
+				if _, ok = ackRequested(m); !ok {
+					c.Send(replyTo(m, ackReply{id, nil}))
+				}
+			}
 		}
+
+		c.sio.onMessage(c, m)
 	}
 }
 
 func (c *Conn) keepalive() {
+	defer c.sio.wg.Done()
+
 	c.ticker = time.NewTicker(c.sio.config.HeartbeatInterval)
 	defer c.ticker.Stop()
 
+	var t time.Time
+
 Loop:
-	for t := range c.ticker.C {
+	for {
+		select {
+		case t = <-c.ticker.C:
+		case <-c.closed:
+			return
+		}
+
 		c.mutex.Lock()
 
 		if c.disconnected {
@@ -251,8 +421,14 @@ Loop:
 			return
 		}
 
-		if (!c.online && t-c.lastDisconnected > c.sio.config.ReconnectTimeout) || int(c.lastHeartbeat) < c.numHeartbeats {
-			c.disconnect()
+		if !c.online && t.Sub(c.lastDisconnected) > c.sio.config.ReconnectTimeout {
+			c.disconnect(DisconnectReasonReconnectTimeout)
+			c.mutex.Unlock()
+			break
+		}
+
+		if int(c.lastHeartbeat) < c.numHeartbeats {
+			c.disconnect(DisconnectReasonHeartbeat)
 			c.mutex.Unlock()
 			break
 		}
@@ -262,8 +438,8 @@ Loop:
 		select {
 		case c.queue <- heartbeat(c.numHeartbeats):
 		default:
-			c.sio.Log("sio/keepalive: unable to queue heartbeat. fail now. TODO: FIXME", c)
-			c.disconnect()
+			c.log(LogWarn, "sio/keepalive: unable to queue heartbeat", "heartbeat")
+			c.disconnect(DisconnectReasonQueueFull)
 			c.mutex.Unlock()
 			break Loop
 		}
@@ -284,25 +460,61 @@ Loop:
 // NOTE: the c.sio.config.QueueLength is not a "hard limit", because one could have
 // max amount of messages waiting in the queue and in the payload itself
 // simultaneously.
+//
+// If the replay is enabled, the messages are numbered and stored for a replay
+// before they are written, and a failed payload is not retried: the messages
+// are replayed when the client reconnects.
+//
+// Binary data is always flushed alone, so that it can be written as a native
+// binary frame if the socket supports them. It is encoded nevertheless for the
+// replay and for the other sockets.
 func (c *Conn) flusher() {
+	defer c.sio.wg.Done()
+
 	buf := new(bytes.Buffer)
-	var err os.Error
-	var msg interface{}
-	var n int
+	var err error
+	var msg, next interface{}
+	var ok bool
+	var raw binaryData
+	var n, size int
+	var start time.Time
+	var spans [][2]int
+	var prev uint64
+
+	for {
+		if next != nil {
+			msg, next = next, nil
+		} else if msg, ok = <-c.queue; !ok {
+			return
+		}
+
+		start = time.Now()
+		c.mutex.Lock()
+		c.flushing = true
+		c.mutex.Unlock()
 
-	for msg = range c.queue {
 		buf.Reset()
-		err = c.enc.Encode(buf, msg)
+		spans = spans[:0]
+		err = c.encode(buf, &spans, msg)
 		n = 1
+		raw, _ = unkeyed(msg).(binaryData)
 
-		if err == nil {
+		if err == nil && raw == nil {
 
 		DrainLoop:
 			for n < c.sio.config.QueueLength {
 				select {
-				case msg = <-c.queue:
+				case msg, ok = <-c.queue:
+					if !ok {
+						break DrainLoop
+					}
+					if _, ok = unkeyed(msg).(binaryData); ok {
+						next = msg
+						break DrainLoop
+					}
+
 					n++
-					if err = c.enc.Encode(buf, msg); err != nil {
+					if err = c.encode(buf, &spans, msg); err != nil {
 						break DrainLoop
 					}
 
@@ -311,28 +523,55 @@ func (c *Conn) flusher() {
 				}
 			}
 		}
+
+		c.mutex.Lock()
+		c.signalDequeued()
+		c.mutex.Unlock()
+
 		if err != nil {
-			c.sio.Logf("sio/conn: flusher/encode: lost %d messages (%d bytes): %s %s", n, buf.Len(), err, c)
+			c.log(LogError, "sio/conn: unable to encode", "encode", "messages", n, "bytes", buf.Len(), LogKeyError, err)
+			c.sio.metrics.MessagesDropped(DropReasonEncode, n)
+			c.mutex.Lock()
+			c.flushing = next != nil
+			c.mutex.Unlock()
 			continue
 		}
 
-	FlushLoop:
+		size = buf.Len()
+
+		// the messages are recorded and written at once, so that a
+		// reconnect never replays them before they are written
+		c.mutex.Lock()
+		prev = c.seq
+		c.record(buf.Bytes(), spans)
+		c.labelEvents()
+
 		for {
-			for {
-				c.mutex.Lock()
+			if bs, ok := c.socket.(binarySocket); ok && raw != nil && bs.supportsBinary() {
+				_, err = bs.WriteBinary(raw)
+			} else {
 				_, err = buf.WriteTo(c.socket)
-				c.mutex.Unlock()
+			}
 
-				if err == nil {
-					break FlushLoop
-				} else if err != os.EAGAIN {
-					break
+			if err == nil {
+				c.flushing = next != nil
+				if c.written == prev {
+					c.written = c.seq
 				}
+				c.sio.metrics.MessagesSent(c.socket.Transport().Resource(), n, size, time.Since(start))
+			} else if c.sio.replay != nil {
+				c.flushing = next != nil
+			}
+			c.mutex.Unlock()
+
+			if err == nil || c.sio.replay != nil {
+				break
 			}
 
 			if _, ok := <-c.wakeupFlusher; !ok {
 				return
 			}
+			c.mutex.Lock()
 		}
 	}
 }
@@ -343,6 +582,8 @@ func (c *Conn) flusher() {
 // call the c.disconnect method and start waiting for the next event on the
 // c.wakeupReader channel.
 func (c *Conn) reader() {
+	defer c.sio.wg.Done()
+
 	buf := make([]byte, c.sio.config.ReadBufferSize)
 
 	for {
@@ -351,32 +592,48 @@ func (c *Conn) reader() {
 		c.mutex.Unlock()
 
 		for {
-			nr, err := socket.Read(buf)
+			var err error
+			if bs, ok := socket.(binarySocket); ok {
+				var p []byte
+				var binary bool
+				if p, binary, err = bs.ReadFrame(); err == nil && binary {
+					c.receiveBinary(socket.Transport().Resource(), p)
+				} else if err == nil && len(p) > 0 {
+					c.receive(socket.Transport().Resource(), p)
+				}
+			} else {
+				var nr int
+				if nr, err = socket.Read(buf); err == nil && nr > 0 {
+					c.receive(socket.Transport().Resource(), buf[0:nr])
+				}
+			}
+
 			if err != nil {
-				if err != os.EAGAIN {
-					if neterr, ok := err.(*net.OpError); ok && neterr.Timeout() {
-						c.sio.Log("sio/conn: lost connection (timeout):", c)
-						socket.Write(emptyResponse)
-					} else {
-						c.sio.Log("sio/conn: lost connection:", c)
-					}
-					break
+				if neterr, ok := err.(net.Error); ok && neterr.Timeout() {
+					c.logSocket(socket, LogDebug, "sio/conn: lost connection", "lost_connection", LogKeyError, err)
+					socket.Write(emptyResponse)
+				} else {
+					c.logSocket(socket, LogInfo, "sio/conn: lost connection", "lost_connection", LogKeyError, err)
 				}
-			} else if nr < 0 {
 				break
-			} else if nr > 0 {
-				c.receive(buf[0:nr])
 			}
 		}
 
 		c.mutex.Lock()
-		c.lastDisconnected = time.Nanoseconds()
+		c.lastDisconnected = time.Now()
 		socket.Close()
+		// the socket may have been replaced already, e.g. by an upgrade
+		replaced := c.socket != socket && c.online
 		if c.socket == socket {
 			c.online = false
 		}
 		c.mutex.Unlock()
 
+		c.sio.metrics.SocketClosed(socket.Transport().Resource())
+
+		if replaced {
+			continue
+		}
 		if _, ok := <-c.wakeupReader; !ok {
 			break
 		}
@@ -0,0 +1,202 @@
+package socketio
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSPolicy describes the headers sent to the cross-origin requests of an
+// allowed origin.
+type CORSPolicy struct {
+	// Whether the credentials, e.g. the cookies, may be sent along with the
+	// requests. If true, Access-Control-Allow-Credentials: true is sent.
+	AllowCredentials bool
+
+	// The methods listed to a preflight request. If empty, GET and POST are.
+	AllowMethods []string
+
+	// The request headers listed to a preflight request.
+	AllowHeaders []string
+
+	// The response headers the client may read.
+	ExposeHeaders []string
+
+	// How long a preflight result may be cached. Zero leaves it to the client.
+	MaxAge time.Duration
+}
+
+// DefaultCORSPolicy allows the credentials and the GET and POST methods.
+var DefaultCORSPolicy = CORSPolicy{
+	AllowCredentials: true,
+	AllowMethods:     []string{"GET", "POST"},
+}
+
+// OriginRule allows the cross-origin requests of the origins it matches. Only
+// one of Pattern, Regexp and Check should be set.
+type OriginRule struct {
+	// Pattern matches the origins by their scheme, host and port. It is of
+	// the form [scheme://]host[:port], where the host is a name, "*" for any
+	// host or "*.example.com" for any subdomain of example.com, and the port
+	// is a number or "*" for any port. Without the scheme any scheme is
+	// allowed and a missing port allows any port, e.g. "example.com" or
+	// "localhost:8080". With the scheme the missing port is the default port
+	// of the scheme, so e.g. "https://*.example.com" allows exactly the
+	// origins https://<subdomain>.example.com:443.
+	Pattern string
+
+	// Regexp matches the whole origin, e.g. https://app.example.com:8443. It
+	// need not be anchored: it is matched as if it were wrapped in ^(?:...)$,
+	// so that e.g. app\.example\.com does not allow
+	// https://app.example.com.evil.test.
+	Regexp *regexp.Regexp
+
+	// Check is invoked with the origin and the request. It should return true
+	// if the origin is allowed.
+	Check func(origin string, req *http.Request) bool
+
+	// Policy for the origins matched. If nil, the Config.CORS is used.
+	Policy *CORSPolicy
+}
+
+// Match reports whether the rule allows the origin. The u is nil if the origin
+// is not a URL, e.g. "null".
+func (r *OriginRule) match(origin string, u *url.URL, req *http.Request) bool {
+	switch {
+	case r.Check != nil:
+		return r.Check(origin, req)
+	case r.Regexp != nil:
+		return r.Regexp.MatchString(origin)
+	case u != nil:
+		return matchOriginPattern(r.Pattern, u)
+	}
+	return false
+}
+
+// MatchOriginPattern reports whether the pattern of an OriginRule matches u.
+func matchOriginPattern(pattern string, u *url.URL) bool {
+	scheme, hostport, ok := strings.Cut(pattern, "://")
+	if !ok {
+		scheme, hostport = "", pattern
+	} else if !strings.EqualFold(scheme, u.Scheme) {
+		return false
+	}
+
+	host, port, _ := strings.Cut(hostport, ":")
+	if port == "" && scheme != "" {
+		port = defaultPort(scheme)
+	}
+
+	if !matchOriginHost(host, u.Hostname()) {
+		return false
+	}
+
+	if port == "" || port == "*" {
+		return true
+	}
+	if p := u.Port(); p != "" {
+		return p == port
+	}
+	return defaultPort(u.Scheme) == port
+}
+
+// MatchOriginHost matches a host of a pattern, which may be a wildcard, with
+// the host of an origin.
+func matchOriginHost(pattern, host string) bool {
+	if pattern == "*" {
+		return true
+	}
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return len(host) > len(suffix)+1 && strings.HasSuffix(strings.ToLower(host), "."+strings.ToLower(suffix))
+	}
+	return strings.EqualFold(pattern, host)
+}
+
+func defaultPort(scheme string) string {
+	switch strings.ToLower(scheme) {
+	case "http", "ws":
+		return "80"
+	case "https", "wss":
+		return "443"
+	}
+	return ""
+}
+
+// OriginRules returns the rules of the Config.Origins followed by the
+// Config.OriginRules, whose regexps are anchored.
+func (sio *SocketIO) originRules() []OriginRule {
+	rules := make([]OriginRule, 0, len(sio.config.Origins)+len(sio.config.OriginRules))
+	for _, o := range sio.config.Origins {
+		rules = append(rules, OriginRule{Pattern: o})
+	}
+	for _, r := range sio.config.OriginRules {
+		if r.Regexp != nil {
+			r.Regexp = sio.anchoredRegexp(r.Regexp)
+		}
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+// AnchoredRegexp returns re wrapped in ^(?:...)$, so that it only matches a
+// whole string. The wrapped regexps are compiled once.
+func (sio *SocketIO) anchoredRegexp(re *regexp.Regexp) *regexp.Regexp {
+	if anchored, ok := sio.anchored.Load(re); ok {
+		return anchored.(*regexp.Regexp)
+	}
+	anchored, _ := sio.anchored.LoadOrStore(re, regexp.MustCompile(`^(?:`+re.String()+`)$`))
+	return anchored.(*regexp.Regexp)
+}
+
+// VerifyOrigin returns the CORS policy of the first rule allowing the origin of
+// req, or false if none does.
+func (sio *SocketIO) verifyOrigin(origin string, req *http.Request) (*CORSPolicy, bool) {
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		u = nil
+	}
+
+	for _, r := range sio.originRules() {
+		if r.match(origin, u, req) {
+			if r.Policy != nil {
+				return r.Policy, true
+			}
+			return &sio.config.CORS, true
+		}
+	}
+
+	return nil, false
+}
+
+// Apply sets the CORS headers of the response to a request from the allowed
+// origin. The preflight requests are answered with the allowed methods and
+// headers too.
+func (p *CORSPolicy) apply(h http.Header, origin string, req *http.Request) {
+	h.Set("Access-Control-Allow-Origin", origin)
+	h.Add("Vary", "Origin")
+	if p.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if len(p.ExposeHeaders) > 0 {
+		h.Set("Access-Control-Expose-Headers", strings.Join(p.ExposeHeaders, ", "))
+	}
+
+	if req.Method != "OPTIONS" || req.Header.Get("Access-Control-Request-Method") == "" {
+		return
+	}
+
+	methods := p.AllowMethods
+	if len(methods) == 0 {
+		methods = DefaultCORSPolicy.AllowMethods
+	}
+	h.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+	if len(p.AllowHeaders) > 0 {
+		h.Set("Access-Control-Allow-Headers", strings.Join(p.AllowHeaders, ", "))
+	}
+	if p.MaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(int(p.MaxAge/time.Second)))
+	}
+}
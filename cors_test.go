@@ -0,0 +1,148 @@
+package socketio
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestOriginPatterns(t *testing.T) {
+	for _, tc := range []struct {
+		pattern string
+		origin  string
+		allowed bool
+	}{
+		{"example.com", "http://example.com", true},
+		{"example.com", "https://example.com:8443", true},
+		{"example.com", "http://www.example.com", false},
+		{"example.com:80", "http://example.com", true},
+		{"example.com:443", "http://example.com", false},
+		{"example.com:443", "https://example.com", true},
+		{"*:8080", "http://anything.test:8080", true},
+		{"*.example.com", "https://a.b.example.com", true},
+		{"*.example.com", "https://example.com", false},
+		{"*.example.com", "https://badexample.com", false},
+		{"https://*.example.com", "https://app.EXAMPLE.com", true},
+		{"https://*.example.com", "http://app.example.com", false},
+		{"https://*.example.com", "https://app.example.com:8443", false},
+		{"https://example.com:*", "https://example.com:8443", true},
+		{"http://localhost:3000", "http://localhost:3000", true},
+	} {
+		config := DefaultConfig
+		config.Origins = []string{tc.pattern}
+		sio := &SocketIO{config: config}
+
+		req := httptest.NewRequest("GET", "/socket.io/xhr-polling", nil)
+		if _, ok := sio.verifyOrigin(tc.origin, req); ok != tc.allowed {
+			t.Errorf("%q with %q: expected %v", tc.pattern, tc.origin, tc.allowed)
+		}
+	}
+}
+
+func TestOriginRegexp(t *testing.T) {
+	for _, tc := range []struct {
+		re      string
+		origin  string
+		allowed bool
+	}{
+		{`https://app\.example\.com`, "https://app.example.com", true},
+		{`https://app\.example\.com`, "https://app.example.com.evil.test", false},
+		{`https://app\.example\.com`, "http://evil.test/https://app.example.com", false},
+		{`https://[a-z]+\.example\.com(:\d+)?`, "https://app.example.com:8443", true},
+		{`^https://app\.example\.com$`, "https://app.example.com", true},
+		{`a\.com|a\.com\.evil`, "a.com.evil", true},
+		{`(?i)https://APP\.example\.com`, "https://app.example.com", true},
+	} {
+		config := DefaultConfig
+		config.OriginRules = []OriginRule{{Regexp: regexp.MustCompile(tc.re)}}
+		sio := &SocketIO{config: config}
+
+		req := httptest.NewRequest("GET", "/socket.io/xhr-polling", nil)
+		if _, ok := sio.verifyOrigin(tc.origin, req); ok != tc.allowed {
+			t.Errorf("%q with %q: expected %v", tc.re, tc.origin, tc.allowed)
+		}
+	}
+}
+
+func TestCORSPolicy(t *testing.T) {
+	public := &CORSPolicy{AllowMethods: []string{"GET"}}
+
+	config := DefaultConfig
+	config.Logger = NOPLogger
+	config.Origins = []string{"https://app.example.com"}
+	config.OriginRules = []OriginRule{
+		{Regexp: regexp.MustCompile(`^https://[a-z]+\.preview\.example\.com$`)},
+		{Check: func(origin string, req *http.Request) bool { return origin == "null" }, Policy: public},
+	}
+	config.CORS.AllowHeaders = []string{"X-Token"}
+	config.CORS.ExposeHeaders = []string{"X-Server"}
+	config.CORS.MaxAge = 10 * time.Minute
+	sio := NewSocketIO(&config)
+
+	preflight := func(origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("OPTIONS", "/socket.io/xhr-polling", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		w := httptest.NewRecorder()
+		sio.ServeMux().ServeHTTP(w, req)
+		return w
+	}
+
+	w := preflight("https://app.example.com")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected the preflight to succeed but got %d", w.Code)
+	}
+	for header, value := range map[string]string{
+		"Access-Control-Allow-Origin":      "https://app.example.com",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Allow-Methods":     "GET, POST",
+		"Access-Control-Allow-Headers":     "X-Token",
+		"Access-Control-Expose-Headers":    "X-Server",
+		"Access-Control-Max-Age":           "600",
+		"Vary":                             "Origin",
+	} {
+		if got := w.Header().Get(header); got != value {
+			t.Errorf("Expected %s: %s but got %q", header, value, got)
+		}
+	}
+
+	if w = preflight("https://feature.preview.example.com"); w.Code != http.StatusOK {
+		t.Fatalf("Expected the regexp to allow the origin but got %d", w.Code)
+	}
+
+	w = preflight("null")
+	if w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Credentials") != "" || w.Header().Get("Access-Control-Allow-Methods") != "GET" {
+		t.Fatalf("Expected the policy of the rule but got %d %v", w.Code, w.Header())
+	}
+
+	if w = preflight("https://evil.example.com"); w.Code != http.StatusForbidden || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("Expected the origin to be refused but got %d %v", w.Code, w.Header())
+	}
+}
+
+func TestCORSHijacked(t *testing.T) {
+	_, server, _ := testServer(t, func(config *Config) {
+		config.Origins = []string{"https://app.example.com"}
+		config.CORS.AllowCredentials = false
+	})
+
+	for _, transport := range []string{"htmlfile", "xhr-multipart", "eventsource"} {
+		req, err := http.NewRequest("GET", server.URL+"/socket.io/"+transport, nil)
+		if err != nil {
+			t.Fatal("NewRequest:", err)
+		}
+		req.Header.Set("Origin", "https://app.example.com")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal("Do:", err)
+		}
+		resp.Body.Close()
+
+		if resp.Header.Get("Access-Control-Allow-Origin") != "https://app.example.com" || resp.Header.Get("Access-Control-Allow-Credentials") != "" {
+			t.Fatalf("%s: expected the CORS headers of the policy but got %v", transport, resp.Header)
+		}
+	}
+}
@@ -1,72 +1,114 @@
 /*
-	The socketio package is a simple abstraction layer for different web browser-
-	supported transport mechanisms. It is fully compatible with the
-	Socket.IO client side JavaScript socket API library by LearnBoost Labs
-	(http://socket.io/), but through custom codecs it might fit other client
-	implementations too.
-
-	It (together with the LearnBoost's client-side libraries) provides an easy way for
-	developers to access the most popular browser transport mechanism today:
-	multipart- and long-polling XMLHttpRequests, HTML5 WebSockets and
-	forever-frames. The socketio package works hand-in-hand with the standard
-	http package by plugging itself into a configurable ServeMux. It has an callback-style
-	API for handling connection events. The callbacks are:
-
-	- SocketIO.OnConnect
-	- SocketIO.OnDisconnect
-	- SocketIO.OnMessage
-
-	Other utility-methods include:
-
-	- SocketIO.ServeMux
-	- SocketIO.Broadcast
-	- SocketIO.BroadcastExcept
-	- SocketIO.GetConn
-	- Conn.Send
-
-	Each new connection will be automatically assigned an unique session id and
-	using those the clients can reconnect without losing messages: the server
-	persists clients' pending messages (until some configurable point) if they can't
-	be immediately delivered. All writes through Conn.Send by design asynchronous.
-
-	Finally, the actual format on the wire is described by a separate Codec.
-	The default codecs (SIOCodec and SIOStreamingCodec) are compatible with the
-	LearnBoost's Socket.IO client.
-
-	For example, here is a simple chat server:
-
-		package main
-
-		import (
-			"http"
-			"log"
-			"socketio"
-		)
-
-		func main() {
-			sio := socketio.NewSocketIO(nil)
-
-			sio.OnConnect(func(c *socketio.Conn) {
-				sio.Broadcast(struct{ announcement string }{"connected: " + c.String()})
-			})
-
-			sio.OnDisconnect(func(c *socketio.Conn) {
-				sio.BroadcastExcept(c,
-					struct{ announcement string }{"disconnected: " + c.String()})
-			})
-
-			sio.OnMessage(func(c *socketio.Conn, msg socketio.Message) {
-				sio.BroadcastExcept(c,
-					struct{ message []string }{[]string{c.String(), msg.Data()}})
-			})
-
-			mux := sio.ServeMux()
-			mux.Handle("/", http.FileServer("www/", "/"))
-
-			if err := http.ListenAndServe(":8080", mux); err != nil {
-				log.Fatal("ListenAndServe:", err)
-			}
+The socketio package is a simple abstraction layer for different web browser-
+supported transport mechanisms. It is fully compatible with the
+Socket.IO client side JavaScript socket API library by LearnBoost Labs
+(http://socket.io/), but through custom codecs it might fit other client
+implementations too.
+
+It (together with the LearnBoost's client-side libraries) provides an easy way for
+developers to access the most popular browser transport mechanism today:
+multipart- and long-polling XMLHttpRequests, HTML5 WebSockets,
+forever-frames and Server-Sent Events. The socketio package works hand-in-hand with the standard
+net/http package by plugging itself into a configurable ServeMux. It has an callback-style
+API for handling connection events. The callbacks are:
+
+- SocketIO.OnConnect
+- SocketIO.OnDisconnect
+- SocketIO.OnMessage
+- SocketIO.On
+- SocketIO.OnUnknownEvent
+- SocketIO.OnConnectionRefused
+- SocketIO.OnLimitExceeded
+- SocketIO.OnMessageDropped
+- SocketIO.SetAuthorizer
+
+Other utility-methods include:
+
+- SocketIO.ServeMux
+- SocketIO.Broadcast
+- SocketIO.BroadcastExcept
+- SocketIO.BroadcastTo
+- SocketIO.GetConn
+- SocketIO.Of
+- SocketIO.Shutdown
+- Conn.Send
+- Conn.SendContext
+- Conn.SendKey
+- Conn.SendBinary
+- Conn.Emit
+- Conn.SendWithAck
+- Conn.Ack
+- Conn.Join
+- Conn.Leave
+
+Each new connection will be automatically assigned an unique session id and
+using those the clients can reconnect without losing messages: the server
+persists clients' pending messages (until some configurable point) if they can't
+be immediately delivered. All writes through Conn.Send by design asynchronous.
+With the replay enabled (see Config.ReplayBufferSize and ReplayStorage), the
+sent messages are numbered and kept in a replay buffer, so a client that
+reconnects with the sequence number of the latest message it has seen gets
+exactly the messages it missed.
+
+The websocket transport speaks RFC 6455, including the permessage-deflate
+compression. The legacy hixie handshakes can be enabled for old clients with
+a WebsocketConfig given to NewWebsocketTransportConfig.
+
+A session that starts with a polling transport can be upgraded to a websocket
+without losing or duplicating messages: the client probes the websocket with
+the upgrade query parameter and the server switches the connection over once
+the client commits the upgrade.
+
+The session ids can be made unusable to anyone who merely observes them by
+requiring signed session tokens with a SessionTokenConfig.
+
+For Go programs, ClientConn dials a server through the websocket or the
+xhr-polling transport and resumes the session with an exponential backoff
+when the connection fails.
+
+The server reports its events to a leveled Logger with key/value fields,
+e.g. the session id and the transport. NewStdLogger and NewSlogLogger adapt
+the standard library's log and log/slog packages.
+
+Finally, the actual format on the wire is described by a separate Codec.
+The default codecs (SIOCodec and SIOStreamingCodec) are compatible with the
+LearnBoost's Socket.IO client. The SIO07Codec is a 0.7 packet codec only: it
+speaks the packet format of the 0.7 protocol, but not its HTTP handshake.
+
+For example, here is a simple chat server:
+
+	package main
+
+	import (
+		"log"
+		"net/http"
+
+		socketio "github.com/madari/go-socket.io"
+	)
+
+	func main() {
+		sio := socketio.NewSocketIO(nil)
+
+		sio.OnConnect(func(c *socketio.Conn) {
+			sio.Broadcast(struct{ announcement string }{"connected: " + c.String()})
+		})
+
+		sio.OnDisconnect(func(c *socketio.Conn) {
+			sio.BroadcastExcept(c,
+				struct{ announcement string }{"disconnected: " + c.String()})
+		})
+
+		sio.OnMessage(func(c *socketio.Conn, msg socketio.Message) {
+			sio.BroadcastExcept(c,
+				struct{ message []string }{[]string{c.String(), msg.Data()}})
+		})
+
+		mux := sio.ServeMux()
+		mux.Handle("/", http.FileServer(http.Dir("www/")))
+
+		if err := http.ListenAndServe(":8080", mux); err != nil {
+			log.Fatal("ListenAndServe:", err)
 		}
-
+	}
 */
 package socketio
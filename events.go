@@ -0,0 +1,160 @@
+package socketio
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+)
+
+var (
+	errInvalidEventHandler = errors.New("event handler must be a non-variadic func with *Conn as its first parameter")
+
+	connType = reflect.TypeOf((*Conn)(nil))
+)
+
+// Event is a named event with arguments. It is encoded as a JSON object
+// {"name": name, "args": [args...]}, which is what the Socket.IO clients use
+// for their events. Codecs that support events natively (e.g. the SIO07Codec)
+// encode it as an event packet.
+type event struct {
+	Name string        `json:"name"`
+	Args []interface{} `json:"args"`
+}
+
+// Emit queues a named event with the given arguments for a delivery. The
+// arguments must be marshallable by the standard json package. The errors
+// are the same as with Send.
+func (c *Conn) Emit(name string, args ...interface{}) error {
+	if args == nil {
+		args = []interface{}{}
+	}
+	return c.Send(event{name, args})
+}
+
+// On sets f to be invoked when an event with the given name arrives. The f
+// must be a func with *Conn as its first parameter. The arguments of the event
+// are decoded with the standard json package into the rest of the parameters:
+// missing arguments are passed as zero values and the extra ones are ignored.
+// If the client requested an acknowledgement with data, the return values of f
+// are sent back as the arguments of the acknowledgement. Handled events are not
+// passed to the OnMessage callback.
+//
+// For example:
+//
+//	sio.On("move", func(c *socketio.Conn, x, y int, opts map[string]string) {
+//		...
+//	})
+func (sio *SocketIO) On(name string, f interface{}) error {
+	return sio.callbacks.on(name, f)
+}
+
+// OnUnknownEvent sets f to be invoked when an event arrives that has no handler
+// set with On. It passes the connection, the name and the raw JSON encoded
+// arguments of the event as arguments to the callback. If this callback has not
+// been set, the unknown events are passed to the OnMessage callback.
+func (sio *SocketIO) OnUnknownEvent(f func(*Conn, string, []json.RawMessage)) error {
+	sio.callbacks.onUnknownEvent = f
+	return nil
+}
+
+// On validates f and sets it as the handler of the named event.
+func (cb *endpointCallbacks) on(name string, f interface{}) error {
+	t := reflect.TypeOf(f)
+	if t == nil || t.Kind() != reflect.Func || t.IsVariadic() || t.NumIn() < 1 || t.In(0) != connType {
+		return errInvalidEventHandler
+	}
+
+	if cb.onEvent == nil {
+		cb.onEvent = make(map[string]reflect.Value)
+	}
+	cb.onEvent[name] = reflect.ValueOf(f)
+	return nil
+}
+
+// Dispatch passes msg to the event handlers of cb, or to the OnMessage callback
+// of cb if the message is not an event or the event is not handled.
+func (sio *SocketIO) dispatch(cb *endpointCallbacks, c *Conn, msg Message) {
+	if name, args, ok := decodeEvent(msg); ok && sio.onEvent(cb, c, msg, name, args) {
+		return
+	}
+
+	if cb.onMessage != nil {
+		cb.onMessage(c, msg)
+	}
+}
+
+// OnEvent dispatches the event to its handler in cb and acknowledges the event
+// with the return values of the handler if the client requested so. It returns
+// false if the event was not handled at all.
+func (sio *SocketIO) onEvent(cb *endpointCallbacks, c *Conn, msg Message, name string, args []json.RawMessage) bool {
+	f, ok := cb.onEvent[name]
+	if !ok {
+		if cb.onUnknownEvent == nil {
+			return false
+		}
+		cb.onUnknownEvent(c, name, args)
+		return true
+	}
+
+	t := f.Type()
+	in := make([]reflect.Value, t.NumIn())
+	in[0] = reflect.ValueOf(c)
+
+	for i := 1; i < len(in); i++ {
+		if i > len(args) {
+			in[i] = reflect.Zero(t.In(i))
+			continue
+		}
+
+		v := reflect.New(t.In(i))
+		if err := json.Unmarshal(args[i-1], v.Interface()); err != nil {
+			c.log(LogWarn, "sio/event: unable to decode an argument", "event_decode", "name", name, "argument", i, LogKeyError, err)
+			return true
+		}
+		in[i] = v.Elem()
+	}
+
+	out := f.Call(in)
+
+	if id, ok := ackRequested(msg); ok && sio.supportsPackets() {
+		reply := make([]interface{}, len(out))
+		for i, v := range out {
+			reply[i] = v.Interface()
+		}
+		c.Send(replyTo(msg, ackReply{id, reply}))
+	}
+
+	return true
+}
+
+// DecodeEvent extracts the name and the raw arguments of an event from the
+// message. Messages of type MessageEvent must have a name, whereas messages of
+// type MessageJSON are considered to be events only if they consist of exactly
+// the name and the args fields.
+func decodeEvent(msg Message) (name string, args []json.RawMessage, ok bool) {
+	typ := msg.Type()
+	if typ != MessageEvent && typ != MessageJSON {
+		return
+	}
+
+	data, _ := msg.JSON()
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(data, &fields) != nil {
+		return
+	}
+
+	rawName, hasName := fields["name"]
+	rawArgs, hasArgs := fields["args"]
+	if !hasName || (typ == MessageJSON && (!hasArgs || len(fields) != 2)) {
+		return
+	}
+
+	if json.Unmarshal(rawName, &name) != nil {
+		return
+	}
+	if hasArgs && json.Unmarshal(rawArgs, &args) != nil {
+		return
+	}
+
+	return name, args, true
+}
@@ -0,0 +1,106 @@
+package socketio
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func decodeOne(t *testing.T, codec Codec, data string) Message {
+	buf := bytes.NewBufferString(data)
+	messages, err := codec.NewDecoder(buf).Decode()
+	if err != nil {
+		t.Fatal("Decode:", err)
+	}
+	if len(messages) != 1 {
+		t.Fatalf("Expected 1 message, but got %d", len(messages))
+	}
+	return messages[0]
+}
+
+func TestEvents(t *testing.T) {
+	config := DefaultConfig
+	config.Logger = NOPLogger
+	sio := NewSocketIO(&config)
+	c := connectedConn(t, sio)
+
+	type point struct {
+		X, Y int
+	}
+
+	var gotConn *Conn
+	var gotName string
+	var gotPoint point
+	var gotMissing []string
+	if err := sio.On("move", func(c *Conn, name string, p point, missing []string) {
+		gotConn, gotName, gotPoint, gotMissing = c, name, p, missing
+	}); err != nil {
+		t.Fatal("On:", err)
+	}
+
+	var unknown string
+	sio.OnUnknownEvent(func(c *Conn, name string, args []json.RawMessage) {
+		unknown = name
+	})
+
+	var messages int
+	sio.OnMessage(func(c *Conn, msg Message) {
+		messages++
+	})
+
+	sio.onMessage(c, decodeOne(t, SIO07Codec{}, `5:::{"name":"move","args":["a",{"X":1,"Y":2}]}`))
+	if gotConn != c || gotName != "a" || gotPoint.X != 1 || gotPoint.Y != 2 || gotMissing != nil {
+		t.Fatalf("Unexpected handler arguments: %v %q %v %v", gotConn, gotName, gotPoint, gotMissing)
+	}
+
+	sio.onMessage(c, decodeOne(t, SIOStreamingCodec{}, streamingFrame(`{"name":"move","args":["b"]}`, 1, true)))
+	if gotName != "b" {
+		t.Fatalf("Expected the JSON message to be handled as an event, got %q", gotName)
+	}
+
+	sio.onMessage(c, decodeOne(t, SIO07Codec{}, `5:::{"name":"jump","args":[]}`))
+	if unknown != "jump" {
+		t.Fatalf("Expected unknown event jump, got %q", unknown)
+	}
+
+	sio.onMessage(c, decodeOne(t, SIOStreamingCodec{}, streamingFrame(`{"name":"move","args":[],"x":1}`, 1, true)))
+	sio.onMessage(c, decodeOne(t, SIO07Codec{}, "3:::hello"))
+	if messages != 2 {
+		t.Fatalf("Expected 2 messages passed to OnMessage, got %d", messages)
+	}
+
+	if err := sio.On("bad", func(s string) {}); err == nil {
+		t.Fatal("Expected an error for a handler without *Conn")
+	}
+}
+
+func TestEmit(t *testing.T) {
+	config := DefaultConfig
+	config.Logger = NOPLogger
+	sio := NewSocketIO(&config)
+	c := connectedConn(t, sio)
+
+	if err := c.Emit("tweet", "hello", 1); err != nil {
+		t.Fatal("Emit:", err)
+	}
+	if err := c.Emit("ping"); err != nil {
+		t.Fatal("Emit:", err)
+	}
+
+	expect := []string{
+		sio07Frame(`5:::{"name":"tweet","args":["hello",1]}`),
+		sio07Frame(`5:::{"name":"ping","args":[]}`),
+	}
+
+	enc := SIO07Codec{}.NewEncoder()
+	buf := new(bytes.Buffer)
+	for _, e := range expect {
+		buf.Reset()
+		if err := enc.Encode(buf, <-c.queue); err != nil {
+			t.Fatal("Encode:", err)
+		}
+		if buf.String() != e {
+			t.Fatalf("Expected %q but got %q", e, buf.String())
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package socketio
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ReadEvent reads the next event of an event stream. It returns the id and the
+// data of the event, and the number of the comments before it.
+func readEvent(t *testing.T, br *bufio.Reader) (id, data string, comments int) {
+	var lines []string
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatal("ReadString:", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+
+		switch {
+		case line == "":
+			if lines != nil {
+				return id, strings.Join(lines, "\n"), comments
+			}
+		case strings.HasPrefix(line, ":"):
+			comments++
+		case strings.HasPrefix(line, "id: "):
+			id = line[4:]
+		case strings.HasPrefix(line, "data: "):
+			lines = append(lines, line[6:])
+		}
+	}
+}
+
+func openEventStream(t *testing.T, url, lastEventID string) (*http.Response, *bufio.Reader) {
+	req, _ := http.NewRequest("GET", url, nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal("Do:", err)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected an event stream but got %q", ct)
+	}
+	return resp, bufio.NewReader(resp.Body)
+}
+
+func TestEventSource(t *testing.T) {
+	sio, server, connected := testServer(t, func(config *Config) {
+		config.Transports = []Transport{NewEventSourceTransport(0, time.Second, 20*time.Millisecond)}
+		config.ReplayBufferSize = 100
+	})
+
+	received := make(chan string, 1)
+	sio.OnMessage(func(c *Conn, msg Message) {
+		received <- msg.Data()
+	})
+
+	resource := server.URL + "/socket.io/eventsource"
+
+	resp, br := openEventStream(t, resource, "")
+	c := <-connected
+	sid := string(c.sessionid)
+
+	if id, data, _ := readEvent(t, br); id != sid+":0" || !strings.Contains(data, sid) {
+		t.Fatalf("Expected a handshake with the id %s:0 but got %q %q", sid, id, data)
+	}
+
+	c.Send("a\nb")
+	id, data, _ := readEvent(t, br)
+	if id != sid+":1" || !strings.Contains(data, "3:::a\nb") {
+		t.Fatalf("Expected the message with the id %s:1 but got %q %q", sid, id, data)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	c.Send("c")
+	id, data, comments := readEvent(t, br)
+	if id != sid+":2" || !strings.Contains(data, "3:::c") {
+		t.Fatalf("Expected the message with the id %s:2 but got %q %q", sid, id, data)
+	}
+	if comments == 0 {
+		t.Fatal("Expected keepalive comments between the events")
+	}
+	resp.Body.Close()
+
+	// the client sends its messages with POST
+	form := url.Values{"data": {"3:::up"}}
+	if resp, err := http.PostForm(resource+"/"+sid, form); err != nil {
+		t.Fatal("PostForm:", err)
+	} else {
+		resp.Body.Close()
+	}
+	if msg := <-received; msg != "up" {
+		t.Fatalf("Expected the server to receive up but got %q", msg)
+	}
+
+	// the EventSource reconnects to the same url with the id of the latest
+	// event it has seen
+	resp, br = openEventStream(t, resource, sid+":1")
+	defer resp.Body.Close()
+
+	if id, data, _ = readEvent(t, br); id != sid+":2" || !strings.Contains(data, "3:::c") || strings.Contains(data, "3:::a") {
+		t.Fatalf("Expected the missed messages to be replayed but got %q %q", id, data)
+	}
+
+	select {
+	case <-connected:
+		t.Fatal("Expected the reconnect to use the existing session")
+	default:
+	}
+}
+
+func TestEventSourceHTTP2(t *testing.T) {
+	config := DefaultConfig
+	config.Logger = NOPLogger
+	config.Codec = SIO07Codec{}
+	config.Transports = []Transport{NewEventSourceTransport(0, time.Second, 0)}
+	sio := NewSocketIO(&config)
+
+	connected := make(chan *Conn, 1)
+	sio.OnConnect(func(c *Conn) {
+		connected <- c
+	})
+
+	server := httptest.NewUnstartedServer(sio.ServeMux())
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL + "/socket.io/eventsource")
+	if err != nil {
+		t.Fatal("Get:", err)
+	}
+	defer resp.Body.Close()
+	if resp.ProtoMajor != 2 || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Expected an event stream over HTTP/2 but got %s %v", resp.Proto, resp.Header)
+	}
+	br := bufio.NewReader(resp.Body)
+
+	c := <-connected
+	readEvent(t, br)
+	c.Send("a")
+	if _, data, _ := readEvent(t, br); !strings.Contains(data, "3:::a") {
+		t.Fatalf("Expected the message to be streamed but got %q", data)
+	}
+
+	// a ResponseWriter that can not flush is refused before anything is
+	// written
+	s := NewEventSourceTransport(0, 0, 0).newSocket()
+	w := struct{ http.ResponseWriter }{httptest.NewRecorder()}
+	req := httptest.NewRequest("GET", "/socket.io/eventsource", nil)
+	if err := s.accept(w, req, func() { t.Fatal("Expected the socket not to proceed") }); err != http.ErrNotSupported {
+		t.Fatalf("Expected http.ErrNotSupported but got %v", err)
+	}
+}
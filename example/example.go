@@ -1,11 +1,11 @@
 package main
 
 import (
-	"container/vector"
-	"http"
 	"log"
-	"socketio"
+	"net/http"
 	"sync"
+
+	socketio "github.com/madari/go-socket.io"
 )
 
 type Announcement struct {
@@ -22,7 +22,7 @@ type Message struct {
 
 // A very simple chat server
 func main() {
-	buffer := new(vector.Vector)
+	var buffer []interface{}
 	mutex := new(sync.Mutex)
 
 	// create the socket.io server and mux it to /socket.io/
@@ -39,7 +39,7 @@ func main() {
 	// when a client connects - send it the buffer and broadcasta an announcement
 	sio.OnConnect(func(c *socketio.Conn) {
 		mutex.Lock()
-		c.Send(Buffer{buffer.Copy()})
+		c.Send(Buffer{append([]interface{}(nil), buffer...)})
 		mutex.Unlock()
 		sio.Broadcast(Announcement{"connected: " + c.String()})
 	})
@@ -53,7 +53,7 @@ func main() {
 	sio.OnMessage(func(c *socketio.Conn, msg socketio.Message) {
 		payload := Message{[]string{c.String(), msg.Data()}}
 		mutex.Lock()
-		buffer.Push(payload)
+		buffer = append(buffer, payload)
 		mutex.Unlock()
 		sio.Broadcast(payload)
 	})
@@ -0,0 +1,3 @@
+module github.com/madari/go-socket.io
+
+go 1.26.0
@@ -0,0 +1,274 @@
+package socketio
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrTooManyConnections is used when a new connection is refused because
+	// the server has Config.MaxConnections connections.
+	ErrTooManyConnections = errors.New("too many connections")
+
+	// ErrTooManyConnectionsFromIP is used when a new connection is refused
+	// because its remote IP has Config.MaxConnectionsPerIP connections.
+	ErrTooManyConnectionsFromIP = errors.New("too many connections from the remote IP")
+)
+
+// LimitPolicy tells what to do with a new connection when the server has
+// Config.MaxConnections connections.
+type LimitPolicy int
+
+const (
+	// LimitPolicyReject refuses the new connection.
+	LimitPolicyReject LimitPolicy = iota
+
+	// LimitPolicyEvictIdle closes the session that has been offline the
+	// longest to make room for the new connection. If no session is offline,
+	// the new connection is refused.
+	LimitPolicyEvictIdle
+
+	// LimitPolicyQueue lets the new connection wait for a free slot for
+	// Config.ConnectionQueueTimeout before it is refused.
+	LimitPolicyQueue
+)
+
+// The interval between the checks for a free slot with LimitPolicyQueue.
+const admitPollInterval = 10 * time.Millisecond
+
+// OnConnectionRefused sets f to be invoked when a new connection is refused
+// because of the connection limits. It passes the request and the reason, i.e.
+// ErrTooManyConnections or ErrTooManyConnectionsFromIP, as arguments to the
+// callback.
+func (sio *SocketIO) OnConnectionRefused(f func(*http.Request, error)) error {
+	sio.callbacks.onConnectionRefused = f
+	return nil
+}
+
+// Admit reserves a slot for a new connection from req according to the
+// connection limits and the limit policy. It returns the remote IP the slot
+// was reserved for.
+func (sio *SocketIO) admit(req *http.Request) (ip string, err error) {
+	ip = remoteIP(req)
+	evicted := false
+	var deadline time.Time
+
+	for {
+		if err = sio.reserve(ip); err != ErrTooManyConnections {
+			return
+		}
+
+		switch sio.config.ConnectionLimitPolicy {
+		case LimitPolicyEvictIdle:
+			if evicted {
+				return
+			}
+			evicted = true
+			if c := sio.oldestOffline(); c != nil {
+				c.log(LogInfo, "sio/admit: evicting an idle session", "evicted")
+				c.Close()
+				continue
+			}
+
+		case LimitPolicyQueue:
+			if deadline.IsZero() {
+				deadline = time.Now().Add(sio.config.ConnectionQueueTimeout)
+			}
+			if time.Now().Before(deadline) {
+				select {
+				case <-time.After(admitPollInterval):
+					continue
+				case <-req.Context().Done():
+				}
+			}
+		}
+
+		return
+	}
+}
+
+// Reserve reserves a slot for a connection from ip if the limits allow it.
+func (sio *SocketIO) reserve(ip string) error {
+	sio.limitLock.Lock()
+	defer sio.limitLock.Unlock()
+
+	if max := sio.config.MaxConnectionsPerIP; max > 0 && sio.ipConns[ip] >= max {
+		return ErrTooManyConnectionsFromIP
+	}
+	if max := sio.config.MaxConnections; max > 0 && sio.numConns >= max {
+		return ErrTooManyConnections
+	}
+
+	sio.numConns++
+	sio.ipConns[ip]++
+	return nil
+}
+
+// Bind makes c the holder of the slot reserved for ip.
+func (sio *SocketIO) bind(c *Conn, ip string) {
+	sio.limitLock.Lock()
+	c.ip = ip
+	c.admitted = true
+	sio.limitLock.Unlock()
+}
+
+// Unreserve frees a slot reserved for ip.
+func (sio *SocketIO) unreserve(ip string) {
+	sio.limitLock.Lock()
+	defer sio.limitLock.Unlock()
+
+	sio.numConns--
+	if sio.ipConns[ip]--; sio.ipConns[ip] <= 0 {
+		delete(sio.ipConns, ip)
+	}
+}
+
+// Release frees the slot held by c, if any.
+func (sio *SocketIO) release(c *Conn) {
+	sio.limitLock.Lock()
+	admitted := c.admitted
+	c.admitted = false
+	sio.limitLock.Unlock()
+
+	if admitted {
+		sio.unreserve(c.ip)
+	}
+}
+
+// OldestOffline returns the session that has been offline the longest, or nil
+// if every session is online.
+func (sio *SocketIO) oldestOffline() (oldest *Conn) {
+	sio.sessionsLock.RLock()
+	defer sio.sessionsLock.RUnlock()
+
+	var since time.Time
+	for _, c := range sio.sessions {
+		c.mutex.Lock()
+		if !c.online && !c.disconnected && (oldest == nil || c.lastDisconnected.Before(since)) {
+			oldest, since = c, c.lastDisconnected
+		}
+		c.mutex.Unlock()
+	}
+
+	return
+}
+
+// Refuse answers a request refused because of the connection limits and
+// invokes the user's OnConnectionRefused callback.
+func (sio *SocketIO) refuse(t Transport, w http.ResponseWriter, req *http.Request, reason error) {
+	sio.log(LogWarn, "sio/handle: refused a connection", "refused", LogKeyTransport, t.Resource(), LogKeyRemoteAddr, req.RemoteAddr, "reason", reason)
+
+	if retry := sio.config.RetryAfter; retry > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int((retry+time.Second-1)/time.Second)))
+	}
+
+	if reason == ErrTooManyConnectionsFromIP {
+		sio.reject(t, w, http.StatusTooManyRequests)
+	} else {
+		sio.reject(t, w, http.StatusServiceUnavailable)
+	}
+
+	if sio.callbacks.onConnectionRefused != nil {
+		sio.callbacks.onConnectionRefused(req, reason)
+	}
+}
+
+// RemoteIP returns the IP part of the remote address of req.
+func remoteIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+var (
+	// ErrMessageTooLarge is used when a received message exceeds the
+	// Config.MaxMessageSize.
+	ErrMessageTooLarge = errors.New("message too large")
+
+	// ErrBufferOverflow is used when the received data exceeds the
+	// Config.MaxBufferedBytes.
+	ErrBufferOverflow = errors.New("receive buffer overflow")
+
+	// ErrRateLimited is used when a connection sends messages faster than the
+	// Config.MessageRate allows.
+	ErrRateLimited = errors.New("message rate exceeded")
+)
+
+// ViolationAction tells what to do when a connection exceeds the inbound
+// limits.
+type ViolationAction int
+
+const (
+	// ViolationDrop drops the offending messages or data.
+	ViolationDrop ViolationAction = iota
+
+	// ViolationWarn only logs the violation and invokes the
+	// OnLimitExceeded callback, the messages are handled as usual. The
+	// POSTed request bodies over the Config.MaxBufferedBytes are still
+	// refused, since they are not read in full.
+	ViolationWarn
+
+	// ViolationDisconnect disconnects the connection.
+	ViolationDisconnect
+)
+
+// OnLimitExceeded sets f to be invoked when a connection exceeds the inbound
+// limits. It passes the connection and the reason, i.e. ErrMessageTooLarge,
+// ErrBufferOverflow or ErrRateLimited, as arguments to the callback. The
+// callback is invoked before the Config.ViolationAction is carried out.
+func (sio *SocketIO) OnLimitExceeded(f func(*Conn, error)) error {
+	sio.callbacks.onLimitExceeded = f
+	return nil
+}
+
+// Violate reports that c exceeded an inbound limit and carries out the
+// configured action, which it returns.
+func (c *Conn) violate(reason error) ViolationAction {
+	c.log(LogWarn, "sio/conn: inbound limit exceeded", "limit_exceeded", "reason", reason)
+
+	if c.sio.callbacks.onLimitExceeded != nil {
+		c.sio.callbacks.onLimitExceeded(c, reason)
+	}
+
+	action := c.sio.config.ViolationAction
+	if action == ViolationDisconnect {
+		c.close(DisconnectReasonLimit)
+	}
+	return action
+}
+
+// AllowMessage takes a token from the message rate bucket of c. It reports
+// whether there was one.
+func (c *Conn) allowMessage() bool {
+	rate := c.sio.config.MessageRate
+	if rate <= 0 {
+		return true
+	}
+
+	burst := float64(c.sio.config.MessageBurst)
+	if burst < 1 {
+		burst = 1
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	if c.lastRefill.IsZero() {
+		c.tokens = burst
+	} else if c.tokens += now.Sub(c.lastRefill).Seconds() * rate; c.tokens > burst {
+		c.tokens = burst
+	}
+	c.lastRefill = now
+
+	if c.tokens < 1 {
+		return false
+	}
+	c.tokens--
+	return true
+}
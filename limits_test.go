@@ -0,0 +1,202 @@
+package socketio
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newRequest(t *testing.T, remoteAddr string) *http.Request {
+	req, err := http.NewRequest("GET", "http://localhost/socket.io/xhr-polling", nil)
+	if err != nil {
+		t.Fatal("NewRequest:", err)
+	}
+	req.RemoteAddr = remoteAddr
+	return req
+}
+
+func admittedConn(t *testing.T, sio *SocketIO, remoteAddr string) *Conn {
+	ip, err := sio.admit(newRequest(t, remoteAddr))
+	if err != nil {
+		t.Fatal("admit:", err)
+	}
+	c := connectedConn(t, sio)
+	sio.bind(c, ip)
+	return c
+}
+
+func TestMaxConnections(t *testing.T) {
+	config := DefaultConfig
+	config.Logger = NOPLogger
+	config.MaxConnections = 2
+	config.MaxConnectionsPerIP = 1
+	sio := NewSocketIO(&config)
+
+	var refused []error
+	sio.OnConnectionRefused(func(req *http.Request, reason error) {
+		refused = append(refused, reason)
+	})
+
+	a := admittedConn(t, sio, "10.0.0.1:1000")
+
+	w := httptest.NewRecorder()
+	sio.handle(sio.transportLookup["xhr-polling"], w, newRequest(t, "10.0.0.1:1001"))
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "5" {
+		t.Fatalf("Expected the second connection from the IP to be refused, got %d", w.Code)
+	}
+
+	admittedConn(t, sio, "10.0.0.2:1000")
+
+	w = httptest.NewRecorder()
+	sio.handle(sio.transportLookup["xhr-polling"], w, newRequest(t, "10.0.0.3:1000"))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "5" {
+		t.Fatalf("Expected the connection over the limit to be refused, got %d", w.Code)
+	}
+
+	if len(refused) != 2 || refused[0] != ErrTooManyConnectionsFromIP || refused[1] != ErrTooManyConnections {
+		t.Fatalf("Expected the refusals to be reported, got %v", refused)
+	}
+
+	a.Close()
+	admittedConn(t, sio, "10.0.0.3:1000")
+}
+
+func TestLimitPolicyEvictIdle(t *testing.T) {
+	config := DefaultConfig
+	config.Logger = NOPLogger
+	config.MaxConnections = 2
+	config.ConnectionLimitPolicy = LimitPolicyEvictIdle
+	sio := NewSocketIO(&config)
+
+	a := admittedConn(t, sio, "10.0.0.1:1000")
+	b := admittedConn(t, sio, "10.0.0.2:1000")
+
+	a.mutex.Lock()
+	a.online, a.lastDisconnected = false, time.Now()
+	a.mutex.Unlock()
+	b.mutex.Lock()
+	b.online, b.lastDisconnected = false, time.Now().Add(-time.Minute)
+	b.mutex.Unlock()
+
+	c := admittedConn(t, sio, "10.0.0.3:1000")
+	c.mutex.Lock()
+	c.online = true
+	c.mutex.Unlock()
+	if sio.GetConn(b.sessionid) != nil || sio.GetConn(a.sessionid) != a {
+		t.Fatal("Expected the longest offline session to be evicted")
+	}
+
+	if _, err := sio.admit(newRequest(t, "10.0.0.4:1000")); err != nil {
+		t.Fatal("Expected the other offline session to be evicted, got", err)
+	}
+
+	if _, err := sio.admit(newRequest(t, "10.0.0.5:1000")); err != ErrTooManyConnections {
+		t.Fatal("Expected ErrTooManyConnections without offline sessions, got", err)
+	}
+}
+
+func TestLimitPolicyQueue(t *testing.T) {
+	config := DefaultConfig
+	config.Logger = NOPLogger
+	config.MaxConnections = 1
+	config.ConnectionLimitPolicy = LimitPolicyQueue
+	config.ConnectionQueueTimeout = 500 * time.Millisecond
+	sio := NewSocketIO(&config)
+
+	a := admittedConn(t, sio, "10.0.0.1:1000")
+	time.AfterFunc(50*time.Millisecond, func() {
+		a.Close()
+	})
+
+	if _, err := sio.admit(newRequest(t, "10.0.0.2:1000")); err != nil {
+		t.Fatal("Expected the queued connection to be admitted, got", err)
+	}
+
+	sio.config.ConnectionQueueTimeout = 50 * time.Millisecond
+	start := time.Now()
+	if _, err := sio.admit(newRequest(t, "10.0.0.3:1000")); err != ErrTooManyConnections {
+		t.Fatal("Expected ErrTooManyConnections, got", err)
+	}
+	if time.Since(start) < 50*time.Millisecond {
+		t.Fatal("Expected the connection to wait for the timeout")
+	}
+}
+
+func TestInboundLimits(t *testing.T) {
+	config := DefaultConfig
+	config.Logger = NOPLogger
+	config.Codec = SIO07Codec{}
+	config.MaxMessageSize = 5
+	config.MaxBufferedBytes = 32
+	config.MessageRate = 1
+	config.MessageBurst = 2
+	sio := NewSocketIO(&config)
+	c := connectedConn(t, sio)
+
+	var messages []string
+	sio.OnMessage(func(c *Conn, msg Message) {
+		messages = append(messages, msg.Data())
+	})
+	var violations []error
+	sio.OnLimitExceeded(func(c *Conn, reason error) {
+		violations = append(violations, reason)
+	})
+
+	c.receive("", []byte("3:::toolong"))
+	c.receive("", []byte(sio07Frame("3:::"+strings.Repeat("x", 40))))
+	c.receive("", []byte("3:::a"))
+	c.receive("", []byte("3:::b"))
+	c.receive("", []byte("3:::c"))
+
+	if len(messages) != 2 || messages[0] != "a" || messages[1] != "b" {
+		t.Fatalf("Expected only a and b to be delivered, got %v", messages)
+	}
+	if len(violations) != 3 || violations[0] != ErrMessageTooLarge ||
+		violations[1] != ErrBufferOverflow || violations[2] != ErrRateLimited {
+		t.Fatalf("Expected the violations to be reported, got %v", violations)
+	}
+	if c.decBuf.Len() != 0 {
+		t.Fatal("Expected the overflowing data to be dropped")
+	}
+
+	sio.config.ViolationAction = ViolationDisconnect
+	c.receive("", []byte("3:::d"))
+	if sio.GetConn(c.sessionid) != nil || len(messages) != 2 {
+		t.Fatal("Expected the connection to be disconnected")
+	}
+}
+
+func TestInboundLimitsPost(t *testing.T) {
+	for _, action := range []ViolationAction{ViolationDrop, ViolationWarn} {
+		config := DefaultConfig
+		config.Logger = NOPLogger
+		config.Codec = SIO07Codec{}
+		config.MaxBufferedBytes = 16
+		config.ViolationAction = action
+		sio := NewSocketIO(&config)
+		c := connectedConn(t, sio)
+
+		var violations []error
+		sio.OnLimitExceeded(func(c *Conn, reason error) {
+			violations = append(violations, reason)
+		})
+
+		body := "data=" + strings.Repeat("x", 32)
+		req, err := http.NewRequest("POST", "http://localhost/socket.io/xhr-polling/"+string(c.sessionid), strings.NewReader(body))
+		if err != nil {
+			t.Fatal("NewRequest:", err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		w := httptest.NewRecorder()
+		sio.handle(sio.transportLookup["xhr-polling"], w, req)
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("%d: expected the oversized POST to be refused, got %d", action, w.Code)
+		}
+		if len(violations) != 1 || violations[0] != ErrBufferOverflow {
+			t.Fatalf("%d: expected the violation to be reported, got %v", action, violations)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package socketio
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+// LogLevel is the severity of a logged event.
+type LogLevel int
+
+const (
+	// LogDebug is used for the events that are only useful when debugging,
+	// e.g. replayed messages.
+	LogDebug LogLevel = iota
+
+	// LogInfo is used for the lifecycle of the sessions, e.g. connects and
+	// disconnects.
+	LogInfo
+
+	// LogWarn is used for the misbehaving clients and the refused requests.
+	LogWarn
+
+	// LogError is used for the failures of the server, e.g. an unavailable
+	// session store.
+	LogError
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LogDebug:
+		return "DEBUG"
+	case LogInfo:
+		return "INFO"
+	case LogWarn:
+		return "WARN"
+	case LogError:
+		return "ERROR"
+	}
+	return "LEVEL(" + strconv.Itoa(int(l)) + ")"
+}
+
+// The keys of the fields passed to the Logger.
+const (
+	LogKeyEvent      = "event"       // A short identifier of the event, e.g. "connected".
+	LogKeySessionID  = "sessionid"   // The id of the session.
+	LogKeyTransport  = "transport"   // The resource of the transport, e.g. "websocket".
+	LogKeyRemoteAddr = "remote_addr" // The remote address of the client.
+	LogKeyError      = "error"       // The error that caused the event.
+)
+
+// Logger receives the events of the server. The fields are alternating keys
+// and values, like with the log/slog package, and start with the LogKeyEvent.
+// The events of a connection carry the LogKeySessionID, LogKeyTransport and
+// LogKeyRemoteAddr fields too. Only the free-form messages of SocketIO.Log and
+// SocketIO.Logf come without fields.
+//
+// Log may be invoked concurrently from multiple goroutines.
+type Logger interface {
+	Log(level LogLevel, msg string, fields ...interface{})
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Log(level LogLevel, msg string, fields ...interface{}) {}
+
+type stdLogger struct {
+	logger *log.Logger
+	level  LogLevel
+}
+
+// NewStdLogger returns a Logger that prints the events of the given level and
+// above to l, one line per event, e.g.
+//
+//	INFO sio/conn: connected event=connected sessionid=... transport=websocket
+func NewStdLogger(l *log.Logger, level LogLevel) Logger {
+	return &stdLogger{l, level}
+}
+
+func (sl *stdLogger) Log(level LogLevel, msg string, fields ...interface{}) {
+	if level < sl.level {
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString(level.String())
+	b.WriteByte(' ')
+	b.WriteString(msg)
+	for i := 0; i < len(fields); i += 2 {
+		b.WriteByte(' ')
+		if i+1 == len(fields) {
+			b.WriteString("!BADKEY=")
+			b.WriteString(logValue(fields[i]))
+			break
+		}
+		fmt.Fprint(&b, fields[i])
+		b.WriteByte('=')
+		b.WriteString(logValue(fields[i+1]))
+	}
+	sl.logger.Print(b.String())
+}
+
+// LogValue formats v and quotes it if it would be ambiguous on a log line.
+func logValue(v interface{}) string {
+	s := fmt.Sprint(v)
+	if s == "" || strings.ContainsAny(s, " \t\r\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+// NewSlogLogger returns a Logger that passes the events to l. The levels map
+// to slog.LevelDebug, slog.LevelInfo, slog.LevelWarn and slog.LevelError, and
+// the fields become the attributes of the record.
+func NewSlogLogger(l *slog.Logger) Logger {
+	return &slogLogger{l}
+}
+
+func (sl *slogLogger) Log(level LogLevel, msg string, fields ...interface{}) {
+	var lvl slog.Level
+	switch level {
+	case LogDebug:
+		lvl = slog.LevelDebug
+	case LogInfo:
+		lvl = slog.LevelInfo
+	case LogWarn:
+		lvl = slog.LevelWarn
+	default:
+		lvl = slog.LevelError
+	}
+	sl.logger.Log(context.Background(), lvl, msg, fields...)
+}
+
+// Log passes an event to the configured Logger.
+func (sio *SocketIO) log(level LogLevel, msg, event string, fields ...interface{}) {
+	if sio.config.Logger == nil {
+		return
+	}
+	sio.config.Logger.Log(level, msg, append([]interface{}{LogKeyEvent, event}, fields...)...)
+}
+
+// Log passes an event of the connection to the configured Logger.
+func (c *Conn) log(level LogLevel, msg, event string, fields ...interface{}) {
+	var transport string
+	if a := c.logAddr.Load(); a != nil {
+		transport = a.transport
+	}
+	c.logTransport(transport, level, msg, event, fields...)
+}
+
+// LogSocket is like log, but takes the transport from s instead of the latest
+// socket of the connection, e.g. when s has been replaced already.
+func (c *Conn) logSocket(s socket, level LogLevel, msg, event string, fields ...interface{}) {
+	var transport string
+	if s != nil {
+		transport = s.Transport().Resource()
+	}
+	c.logTransport(transport, level, msg, event, fields...)
+}
+
+// LogTransport logs an event of the connection with the given transport.
+func (c *Conn) logTransport(transport string, level LogLevel, msg, event string, fields ...interface{}) {
+	if c.sio.config.Logger == nil {
+		return
+	}
+	var raddr string
+	if a := c.logAddr.Load(); a != nil {
+		raddr = a.raddr
+	}
+	c.sio.log(level, msg, event, append([]interface{}{
+		LogKeySessionID, c.sessionid,
+		LogKeyTransport, transport,
+		LogKeyRemoteAddr, raddr,
+	}, fields...)...)
+}
+
+// ConnLogAddr is the transport of the latest socket and the remote address of
+// a connection, which the logs read without c.mutex.
+type connLogAddr struct {
+	transport string
+	raddr     string
+}
+
+// PublishLogAddr stores the transport of c.socket and c.raddr for the logs.
+// The caller holds c.mutex.
+func (c *Conn) publishLogAddr() {
+	var transport string
+	if c.socket != nil {
+		transport = c.socket.Transport().Resource()
+	}
+	c.logAddr.Store(&connLogAddr{transport, c.raddr})
+}
@@ -0,0 +1,123 @@
+package socketio
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type logEvent struct {
+	level  LogLevel
+	msg    string
+	fields map[string]interface{}
+}
+
+type recordingLogger struct {
+	mutex  sync.Mutex
+	events []logEvent
+}
+
+func (rl *recordingLogger) Log(level LogLevel, msg string, fields ...interface{}) {
+	ev := logEvent{level, msg, make(map[string]interface{})}
+	for i := 0; i+1 < len(fields); i += 2 {
+		ev.fields[fields[i].(string)] = fields[i+1]
+	}
+	rl.mutex.Lock()
+	rl.events = append(rl.events, ev)
+	rl.mutex.Unlock()
+}
+
+func (rl *recordingLogger) find(event string) *logEvent {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	for i := range rl.events {
+		if rl.events[i].fields[LogKeyEvent] == event {
+			return &rl.events[i]
+		}
+	}
+	return nil
+}
+
+func TestLoggerEvents(t *testing.T) {
+	logger := new(recordingLogger)
+
+	_, server, connected := testServer(t, func(config *Config) {
+		config.Logger = logger
+	})
+
+	poll(t, server.URL+"/socket.io/xhr-polling")
+	c := <-connected
+	c.Close()
+
+	ev := logger.find("connected")
+	if ev == nil {
+		t.Fatal("Expected a connected event")
+	}
+	if ev.level != LogInfo || ev.fields[LogKeySessionID] != c.sessionid || ev.fields[LogKeyTransport] != "xhr-polling" || ev.fields[LogKeyRemoteAddr] != c.RemoteAddr() {
+		t.Fatalf("Expected the fields of the connection but got %v %v", ev.level, ev.fields)
+	}
+
+	if ev = logger.find("disconnected"); ev == nil || ev.fields["reason"] != DisconnectReasonClosed {
+		t.Fatalf("Expected a disconnected event with the reason but got %v", ev)
+	}
+}
+
+func TestLoggerConcurrentSockets(t *testing.T) {
+	_, server, connected := testServer(t, func(config *Config) {
+		config.Logger = new(recordingLogger)
+	})
+
+	poll(t, server.URL+"/socket.io/xhr-polling")
+	c := <-connected
+	defer c.Close()
+
+	// the logs of the connection do not race with the sockets being
+	// replaced by the polls
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			c.log(LogDebug, "test", "test")
+		}
+	}()
+	for i := 0; i < 5; i++ {
+		c.Send("a")
+		poll(t, server.URL+"/socket.io/xhr-polling/"+string(c.sessionid))
+	}
+	<-done
+}
+
+func TestStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewStdLogger(log.New(&buf, "", 0), LogInfo)
+
+	logger.Log(LogDebug, "hidden", LogKeyEvent, "debug")
+	logger.Log(LogWarn, "sio/conn: unable to decode", LogKeyEvent, "decode", LogKeySessionID, SessionID("abc"), LogKeyError, "bad frame")
+
+	if s := buf.String(); s != "WARN sio/conn: unable to decode event=decode sessionid=abc error=\"bad frame\"\n" {
+		t.Fatalf("Unexpected output %q", s)
+	}
+}
+
+func TestSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewSlogLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo})))
+
+	logger.Log(LogDebug, "hidden", LogKeyEvent, "debug")
+	logger.Log(LogError, "sio/conn: unable to record", LogKeyEvent, "record", LogKeyTransport, "websocket")
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("Expected a single record but got %q: %v", buf.String(), err)
+	}
+	if record["level"] != "ERROR" || record["msg"] != "sio/conn: unable to record" || record[LogKeyEvent] != "record" || record[LogKeyTransport] != "websocket" {
+		t.Fatalf("Unexpected record %v", record)
+	}
+	if strings.Contains(buf.String(), "hidden") {
+		t.Fatal("Expected the debug event to be filtered")
+	}
+}
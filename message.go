@@ -16,6 +16,24 @@ const (
 
 	// MessageDisconnect is interpreted as a forced disconnection.
 	MessageDisconnect
+
+	// MessageConnect is interpreted as a connection to an endpoint.
+	MessageConnect
+
+	// MessageEvent is interpreted as a JSON encoded named event.
+	MessageEvent
+
+	// MessageAck is interpreted as an acknowledgement of a message.
+	MessageAck
+
+	// MessageError is interpreted as an error reported by the peer.
+	MessageError
+
+	// MessageNoop is interpreted as a no-op and should be ignored.
+	MessageNoop
+
+	// MessageBinary is interpreted as arbitrary binary data.
+	MessageBinary
 )
 
 // Heartbeat is a server-invoked keep-alive strategy, where
@@ -0,0 +1,297 @@
+package socketio
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The reasons passed to Metrics.SessionClosed.
+const (
+	// DisconnectReasonClosed is used when the connection was closed by the server.
+	DisconnectReasonClosed = "closed"
+
+	// DisconnectReasonHeartbeat is used when a heartbeat was not answered in time.
+	DisconnectReasonHeartbeat = "heartbeat"
+
+	// DisconnectReasonReconnectTimeout is used when the client did not reconnect
+	// within the ReconnectTimeout.
+	DisconnectReasonReconnectTimeout = "reconnect_timeout"
+
+	// DisconnectReasonQueueFull is used when a heartbeat could not be queued.
+	DisconnectReasonQueueFull = "queue_full"
+
+	// DisconnectReasonLimit is used when the client exceeded the inbound limits.
+	DisconnectReasonLimit = "limit"
+
+	// DisconnectReasonSlowConsumer is used when the send queue was full with
+	// the OverflowDisconnect policy.
+	DisconnectReasonSlowConsumer = "slow_consumer"
+)
+
+// The reasons passed to Metrics.MessagesDropped.
+const (
+	// DropReasonQueueFull is used when Send fails with ErrQueueFull.
+	DropReasonQueueFull = "queue_full"
+
+	// DropReasonEvicted is used when the oldest queued message is dropped
+	// with the OverflowDropOldest policy.
+	DropReasonEvicted = "evicted"
+
+	// DropReasonCoalesced is used when a queued message is replaced with the
+	// OverflowCoalesce policy.
+	DropReasonCoalesced = "coalesced"
+
+	// DropReasonEncode is used when the flusher fails to encode the messages.
+	DropReasonEncode = "encode"
+
+	// DropReasonTooLarge is used when a received message exceeds the
+	// Config.MaxMessageSize.
+	DropReasonTooLarge = "too_large"
+
+	// DropReasonOverflow is used when received data exceeds the
+	// Config.MaxBufferedBytes.
+	DropReasonOverflow = "overflow"
+
+	// DropReasonRateLimited is used when a received message exceeds the
+	// Config.MessageRate.
+	DropReasonRateLimited = "rate_limited"
+
+	// DropReasonReplayGap is used when a reconnected client has missed
+	// messages that are no longer in the replay buffer.
+	DropReasonReplayGap = "replay_gap"
+)
+
+// Metrics is the interface of the instrumentation hooks of the server. The
+// transport arguments are the resource names of the transports, e.g.
+// "websocket". The methods are invoked synchronously from the goroutines of
+// the server and the connections, so they must be safe for concurrent use and
+// they should return quickly.
+//
+// RequestRejected is invoked when an http request is answered with an error
+// status. SessionOpened and SessionClosed are invoked when a session is
+// established and when it is disconnected. SocketOpened and SocketClosed are
+// invoked when a transport connection of a session is accepted and when it is
+// lost; reconnect tells if the session had a transport connection before.
+// MessagesReceived is invoked with the number of the decoded messages and the
+// bytes they were decoded from. MessagesSent is invoked when the flusher has
+// written the messages to a socket, along with the time elapsed since it took
+// the first one from the queue. MessagesDropped is invoked with the number of
+// messages that were lost.
+type Metrics interface {
+	RequestRejected(transport string, status int)
+	SessionOpened()
+	SessionClosed(reason string)
+	SocketOpened(transport string, reconnect bool)
+	SocketClosed(transport string)
+	MessagesReceived(transport string, messages, bytes int)
+	MessagesSent(transport string, messages, bytes int, latency time.Duration)
+	MessagesDropped(reason string, messages int)
+}
+
+// NopMetrics discards everything. It is used when Config.Metrics is nil.
+type nopMetrics struct{}
+
+func (nopMetrics) RequestRejected(transport string, status int)                        {}
+func (nopMetrics) SessionOpened()                                                      {}
+func (nopMetrics) SessionClosed(reason string)                                         {}
+func (nopMetrics) SocketOpened(transport string, reconnect bool)                       {}
+func (nopMetrics) SocketClosed(transport string)                                       {}
+func (nopMetrics) MessagesReceived(transport string, messages, bytes int)              {}
+func (nopMetrics) MessagesSent(transport string, messages, bytes int, d time.Duration) {}
+func (nopMetrics) MessagesDropped(reason string, messages int)                         {}
+
+// FlushLatencyBuckets are the upper bounds in seconds of the buckets of the
+// flush latency histogram of MemoryMetrics.
+var flushLatencyBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+// MemoryMetrics is a Metrics implementation that keeps the counters, gauges
+// and histograms in memory. It is an http.Handler that exposes them in the
+// Prometheus text format. It is safe for concurrent use.
+type MemoryMetrics struct {
+	mutex            sync.Mutex
+	rejected         map[string]int64 // Rejected requests by transport and status.
+	sessionsActive   int64
+	sessionsOpened   int64
+	sessionsClosed   map[string]int64 // Closed sessions by reason.
+	socketsActive    map[string]int64 // Active sockets by transport.
+	reconnects       map[string]int64 // Reconnects by transport.
+	messagesReceived map[string]int64 // Received messages by transport.
+	bytesReceived    map[string]int64 // Received bytes by transport.
+	messagesSent     map[string]int64 // Sent messages by transport.
+	bytesSent        map[string]int64 // Sent bytes by transport.
+	dropped          map[string]int64 // Dropped messages by reason.
+	flushBuckets     []int64          // Cumulative counts of the flushLatencyBuckets.
+	flushCount       int64
+	flushSum         float64
+}
+
+// NewMemoryMetrics creates a new MemoryMetrics with everything set to zero.
+func NewMemoryMetrics() *MemoryMetrics {
+	return &MemoryMetrics{
+		rejected:         make(map[string]int64),
+		sessionsClosed:   make(map[string]int64),
+		socketsActive:    make(map[string]int64),
+		reconnects:       make(map[string]int64),
+		messagesReceived: make(map[string]int64),
+		bytesReceived:    make(map[string]int64),
+		messagesSent:     make(map[string]int64),
+		bytesSent:        make(map[string]int64),
+		dropped:          make(map[string]int64),
+		flushBuckets:     make([]int64, len(flushLatencyBuckets)),
+	}
+}
+
+// Labels formats label pairs, e.g. labels("transport", "websocket").
+func labels(kv ...string) string {
+	pairs := make([]string, 0, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		pairs = append(pairs, kv[i]+"="+strconv.Quote(kv[i+1]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func (mm *MemoryMetrics) RequestRejected(transport string, status int) {
+	mm.mutex.Lock()
+	mm.rejected[labels("transport", transport, "code", strconv.Itoa(status))]++
+	mm.mutex.Unlock()
+}
+
+func (mm *MemoryMetrics) SessionOpened() {
+	mm.mutex.Lock()
+	mm.sessionsActive++
+	mm.sessionsOpened++
+	mm.mutex.Unlock()
+}
+
+func (mm *MemoryMetrics) SessionClosed(reason string) {
+	mm.mutex.Lock()
+	mm.sessionsActive--
+	mm.sessionsClosed[labels("reason", reason)]++
+	mm.mutex.Unlock()
+}
+
+func (mm *MemoryMetrics) SocketOpened(transport string, reconnect bool) {
+	mm.mutex.Lock()
+	mm.socketsActive[labels("transport", transport)]++
+	if reconnect {
+		mm.reconnects[labels("transport", transport)]++
+	}
+	mm.mutex.Unlock()
+}
+
+func (mm *MemoryMetrics) SocketClosed(transport string) {
+	mm.mutex.Lock()
+	mm.socketsActive[labels("transport", transport)]--
+	mm.mutex.Unlock()
+}
+
+func (mm *MemoryMetrics) MessagesReceived(transport string, messages, bytes int) {
+	mm.mutex.Lock()
+	mm.messagesReceived[labels("transport", transport)] += int64(messages)
+	mm.bytesReceived[labels("transport", transport)] += int64(bytes)
+	mm.mutex.Unlock()
+}
+
+func (mm *MemoryMetrics) MessagesSent(transport string, messages, bytes int, latency time.Duration) {
+	mm.mutex.Lock()
+	defer mm.mutex.Unlock()
+
+	mm.messagesSent[labels("transport", transport)] += int64(messages)
+	mm.bytesSent[labels("transport", transport)] += int64(bytes)
+
+	s := latency.Seconds()
+	for i, le := range flushLatencyBuckets {
+		if s <= le {
+			mm.flushBuckets[i]++
+		}
+	}
+	mm.flushCount++
+	mm.flushSum += s
+}
+
+func (mm *MemoryMetrics) MessagesDropped(reason string, messages int) {
+	mm.mutex.Lock()
+	mm.dropped[labels("reason", reason)] += int64(messages)
+	mm.mutex.Unlock()
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format.
+func (mm *MemoryMetrics) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	mm.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the Prometheus text format to w.
+func (mm *MemoryMetrics) WriteTo(w io.Writer) (int64, error) {
+	mm.mutex.Lock()
+	defer mm.mutex.Unlock()
+
+	pw := &promWriter{w: w}
+
+	pw.vec("socketio_requests_rejected_total", "counter", "The http requests answered with an error status.", mm.rejected)
+	pw.single("socketio_sessions_active", "gauge", "The established sessions.", float64(mm.sessionsActive))
+	pw.single("socketio_sessions_opened_total", "counter", "The sessions established.", float64(mm.sessionsOpened))
+	pw.vec("socketio_sessions_closed_total", "counter", "The sessions disconnected.", mm.sessionsClosed)
+	pw.vec("socketio_sockets_active", "gauge", "The active transport connections.", mm.socketsActive)
+	pw.vec("socketio_reconnects_total", "counter", "The transport connections of already connected sessions.", mm.reconnects)
+	pw.vec("socketio_messages_received_total", "counter", "The messages received.", mm.messagesReceived)
+	pw.vec("socketio_received_bytes_total", "counter", "The bytes received.", mm.bytesReceived)
+	pw.vec("socketio_messages_sent_total", "counter", "The messages sent.", mm.messagesSent)
+	pw.vec("socketio_sent_bytes_total", "counter", "The bytes sent.", mm.bytesSent)
+	pw.vec("socketio_messages_dropped_total", "counter", "The messages dropped.", mm.dropped)
+
+	pw.header("socketio_flush_duration_seconds", "histogram", "The time from dequeuing messages to writing them to a socket.")
+	for i, le := range flushLatencyBuckets {
+		pw.printf("socketio_flush_duration_seconds_bucket{le=%q} %d\n", strconv.FormatFloat(le, 'g', -1, 64), mm.flushBuckets[i])
+	}
+	pw.printf("socketio_flush_duration_seconds_bucket{le=\"+Inf\"} %d\n", mm.flushCount)
+	pw.printf("socketio_flush_duration_seconds_sum %g\n", mm.flushSum)
+	pw.printf("socketio_flush_duration_seconds_count %d\n", mm.flushCount)
+
+	return pw.n, pw.err
+}
+
+// PromWriter writes the Prometheus text format and remembers the first error.
+type promWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (pw *promWriter) printf(format string, v ...interface{}) {
+	if pw.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(pw.w, format, v...)
+	pw.n += int64(n)
+	pw.err = err
+}
+
+func (pw *promWriter) header(name, typ, help string) {
+	pw.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func (pw *promWriter) single(name, typ, help string, value float64) {
+	pw.header(name, typ, help)
+	pw.printf("%s %g\n", name, value)
+}
+
+func (pw *promWriter) vec(name, typ, help string, values map[string]int64) {
+	pw.header(name, typ, help)
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		pw.printf("%s%s %d\n", name, k, values[k])
+	}
+}
@@ -0,0 +1,83 @@
+package socketio
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestMemoryMetrics(t *testing.T) {
+	metrics := NewMemoryMetrics()
+
+	sio, server, connected := testServer(t, func(config *Config) {
+		config.QueueLength = 1
+		config.Metrics = metrics
+	})
+	sio.SetAuthorization(func(req *http.Request) bool {
+		return req.FormValue("token") == "secret"
+	})
+
+	received := make(chan string, 2)
+	sio.OnMessage(func(c *Conn, msg Message) {
+		received <- msg.Data()
+	})
+
+	resource := server.URL + "/socket.io/xhr-polling"
+
+	poll(t, resource+"?token=secret")
+	a := <-connected
+	b := connectedConn(t, sio)
+
+	b.Send("one")
+	if err := b.Send("two"); err != ErrQueueFull {
+		t.Fatalf("Expected ErrQueueFull, got %v", err)
+	}
+	// without the replay, the flusher writes the message to the next poll
+	a.Send("one")
+	poll(t, resource+"/"+string(a.sessionid)+"?token=secret")
+	// the flusher records the write before it releases c.mutex
+	a.drained()
+
+	form := url.Values{"data": {sio07Frame("3:::hello") + sio07Frame("3:::world")}}
+	resp, err := http.PostForm(resource+"/"+string(a.sessionid)+"?token=secret", form)
+	if err != nil {
+		t.Fatal("PostForm:", err)
+	}
+	resp.Body.Close()
+	<-received
+	<-received
+
+	b.Close()
+
+	if resp, err = http.Get(resource); err != nil {
+		t.Fatal("Get:", err)
+	}
+	resp.Body.Close()
+
+	w := httptest.NewRecorder()
+	metrics.ServeHTTP(w, nil)
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Fatalf("Expected a text/plain content type, got %q", ct)
+	}
+
+	out := w.Body.String()
+	for _, line := range []string{
+		"# TYPE socketio_sessions_active gauge",
+		"socketio_sessions_active 1",
+		"socketio_sessions_opened_total 2",
+		`socketio_sessions_closed_total{reason="closed"} 1`,
+		`socketio_messages_dropped_total{reason="queue_full"} 1`,
+		`socketio_requests_rejected_total{transport="xhr-polling",code="401"} 1`,
+		`socketio_messages_received_total{transport="xhr-polling"} 2`,
+		`socketio_reconnects_total{transport="xhr-polling"} 1`,
+		`socketio_messages_sent_total{transport="xhr-polling"} 1`,
+		"# TYPE socketio_flush_duration_seconds histogram",
+		"socketio_flush_duration_seconds_count 1",
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("Expected %q in the output:\n%s", line, out)
+		}
+	}
+}
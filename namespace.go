@@ -0,0 +1,234 @@
+package socketio
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrEndpointsNotSupported is used when the codec can not carry endpoints.
+var ErrEndpointsNotSupported = errors.New("codec does not support endpoints")
+
+// Endpointed is a message that is sent to the endpoint instead of the
+// default one.
+type endpointed struct {
+	endpoint string
+	data     interface{}
+}
+
+// Namespace is an endpoint that is multiplexed over the sessions of the server.
+// A client connects to a namespace by sending a connect message carrying the name
+// of the namespace as its endpoint, after which the messages of the endpoint are
+// routed to the callbacks of the namespace instead of the ones of the server.
+// Namespaces require a codec that supports endpoints, such as the SIO07Codec.
+type Namespace struct {
+	sio      *SocketIO
+	endpoint string
+
+	// The callbacks set by the user
+	callbacks struct {
+		endpointCallbacks
+		isAuthorized func(*Conn, url.Values) bool // Auth test during a connect to the namespace
+	}
+}
+
+// Of returns the namespace with the given name (e.g. "/chat"), creating it if
+// it does not exist yet.
+func (sio *SocketIO) Of(name string) *Namespace {
+	sio.sessionsLock.Lock()
+	defer sio.sessionsLock.Unlock()
+
+	ns, ok := sio.namespaces[name]
+	if !ok {
+		ns = &Namespace{sio: sio, endpoint: name}
+		sio.namespaces[name] = ns
+	}
+
+	return ns
+}
+
+// Name returns the name of the namespace.
+func (ns *Namespace) Name() string {
+	return ns.endpoint
+}
+
+// OnConnect sets f to be invoked when a connection connects to the namespace.
+func (ns *Namespace) OnConnect(f func(*Conn)) error {
+	ns.callbacks.onConnect = f
+	return nil
+}
+
+// OnDisconnect sets f to be invoked when a connection disconnects from the
+// namespace or the whole session is considered to be lost.
+func (ns *Namespace) OnDisconnect(f func(*Conn)) error {
+	ns.callbacks.onDisconnect = f
+	return nil
+}
+
+// OnMessage sets f to be invoked when a message arrives to the namespace.
+func (ns *Namespace) OnMessage(f func(*Conn, Message)) error {
+	ns.callbacks.onMessage = f
+	return nil
+}
+
+// On sets f to be invoked when an event with the given name arrives to the
+// namespace. See SocketIO.On for the details.
+func (ns *Namespace) On(name string, f interface{}) error {
+	return ns.callbacks.on(name, f)
+}
+
+// OnUnknownEvent sets f to be invoked when an event without a handler arrives
+// to the namespace. See SocketIO.OnUnknownEvent for the details.
+func (ns *Namespace) OnUnknownEvent(f func(*Conn, string, []json.RawMessage)) error {
+	ns.callbacks.onUnknownEvent = f
+	return nil
+}
+
+// SetAuthorization sets f to be invoked when a connection tries to connect to
+// the namespace. It passes the connection and the query parameters of the connect
+// message as arguments to the callback. The callback should return true if the
+// connection is authorized or false if it should be refused. Not setting this
+// callback results in a default pass-through.
+func (ns *Namespace) SetAuthorization(f func(*Conn, url.Values) bool) error {
+	ns.callbacks.isAuthorized = f
+	return nil
+}
+
+// Send queues data for a delivery to c through the namespace. The data and
+// the errors are the same as with Conn.Send.
+func (ns *Namespace) Send(c *Conn, data interface{}) error {
+	if !ns.sio.supportsPackets() {
+		return ErrEndpointsNotSupported
+	}
+	return c.Send(endpointed{ns.endpoint, data})
+}
+
+// Emit queues a named event for a delivery to c through the namespace.
+// See Conn.Emit for the details.
+func (ns *Namespace) Emit(c *Conn, name string, args ...interface{}) error {
+	if args == nil {
+		args = []interface{}{}
+	}
+	return ns.Send(c, event{name, args})
+}
+
+// SendWithAck queues data for a delivery to c through the namespace and
+// requests an acknowledgement. See Conn.SendWithAck for the details.
+func (ns *Namespace) SendWithAck(c *Conn, data interface{}, f func(reply Message, err error), timeout time.Duration) error {
+	if !ns.sio.supportsPackets() {
+		return ErrEndpointsNotSupported
+	}
+	return c.SendWithAck(endpointed{ns.endpoint, data}, f, timeout)
+}
+
+// Broadcast schedules data to be sent to each connection of the namespace.
+func (ns *Namespace) Broadcast(data interface{}) {
+	ns.BroadcastExcept(nil, data)
+}
+
+// BroadcastExcept schedules data to be sent to each connection of the
+// namespace except c.
+func (ns *Namespace) BroadcastExcept(c *Conn, data interface{}) {
+	ns.sio.broadcast(&Broadcast{Endpoint: ns.endpoint, Except: sessionIDOf(c), Data: data})
+}
+
+// Connect handles a connect message from c to the namespace. Authorized
+// connections are added to the namespace and the connect is confirmed to the
+// client, whereas the others are sent an error.
+func (ns *Namespace) connect(c *Conn, query url.Values) {
+	if ns.callbacks.isAuthorized != nil && !ns.callbacks.isAuthorized(c, query) {
+		c.log(LogWarn, "sio/namespace: unauthorized connect", "namespace_unauthorized", "endpoint", ns.endpoint)
+		c.Send(SIO07Packet{Type: SIO07PacketError, Endpoint: ns.endpoint, Data: []byte("unauthorized")})
+		return
+	}
+
+	ns.sio.sessionsLock.Lock()
+	if ns.sio.sessions[c.sessionid] != c || c.namespaces[ns.endpoint] {
+		ns.sio.sessionsLock.Unlock()
+		return
+	}
+	if c.namespaces == nil {
+		c.namespaces = make(map[string]bool)
+	}
+	c.namespaces[ns.endpoint] = true
+	ns.sio.sessionsLock.Unlock()
+
+	c.Send(SIO07Packet{Type: SIO07PacketConnect, Endpoint: ns.endpoint})
+
+	if ns.callbacks.onConnect != nil {
+		ns.callbacks.onConnect(c)
+	}
+}
+
+// Disconnect handles a disconnect message from c to the namespace.
+func (ns *Namespace) disconnect(c *Conn) {
+	ns.sio.sessionsLock.Lock()
+	if !c.namespaces[ns.endpoint] {
+		ns.sio.sessionsLock.Unlock()
+		return
+	}
+	delete(c.namespaces, ns.endpoint)
+	ns.sio.sessionsLock.Unlock()
+
+	if ns.callbacks.onDisconnect != nil {
+		ns.callbacks.onDisconnect(c)
+	}
+}
+
+// OnEndpointMessage routes a message with an endpoint to its namespace.
+func (sio *SocketIO) onEndpointMessage(c *Conn, endpoint string, msg Message) {
+	var query url.Values
+	if i := strings.Index(endpoint, "?"); i >= 0 {
+		query, _ = url.ParseQuery(endpoint[i+1:])
+		endpoint = endpoint[:i]
+	}
+
+	sio.sessionsLock.RLock()
+	ns := sio.namespaces[endpoint]
+	connected := c.namespaces[endpoint]
+	sio.sessionsLock.RUnlock()
+
+	if ns == nil {
+		c.log(LogWarn, "sio/namespace: unknown endpoint", "namespace_unknown", "endpoint", endpoint)
+		c.Send(SIO07Packet{Type: SIO07PacketError, Endpoint: endpoint, Data: []byte("unknown endpoint")})
+		return
+	}
+
+	switch msg.Type() {
+	case MessageConnect:
+		ns.connect(c, query)
+
+	case MessageDisconnect:
+		ns.disconnect(c)
+
+	default:
+		if !connected {
+			c.log(LogWarn, "sio/namespace: message to an unconnected endpoint", "namespace_unconnected", "endpoint", endpoint)
+			return
+		}
+		sio.dispatch(&ns.callbacks.endpointCallbacks, c, msg)
+	}
+}
+
+// LeaveNamespaces removes c from all of its namespaces and returns them.
+// The caller must hold sio.sessionsLock for writing.
+func (sio *SocketIO) leaveNamespaces(c *Conn) []*Namespace {
+	namespaces := make([]*Namespace, 0, len(c.namespaces))
+	for endpoint := range c.namespaces {
+		if ns, ok := sio.namespaces[endpoint]; ok {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	c.namespaces = nil
+	return namespaces
+}
+
+// ReplyTo wraps data so that it is sent to the endpoint msg came from.
+func replyTo(msg Message, data interface{}) interface{} {
+	if endpoint, ok := msg.Annotation(SIO07AnnotationEndpoint); ok {
+		return endpointed{endpoint, data}
+	}
+	return data
+}
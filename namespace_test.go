@@ -0,0 +1,88 @@
+package socketio
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestNamespace(t *testing.T) {
+	config := DefaultConfig
+	config.Logger = NOPLogger
+	config.Codec = SIO07Codec{}
+	sio := NewSocketIO(&config)
+	a := connectedConn(t, sio)
+	b := connectedConn(t, sio)
+
+	var defaultMessages int
+	sio.OnMessage(func(c *Conn, msg Message) {
+		defaultMessages++
+	})
+
+	chat := sio.Of("/chat")
+	if sio.Of("/chat") != chat {
+		t.Fatal("Expected Of to return the same namespace")
+	}
+
+	var connected, disconnected []*Conn
+	var messages []string
+	chat.SetAuthorization(func(c *Conn, query url.Values) bool {
+		return query.Get("token") == "secret"
+	})
+	chat.OnConnect(func(c *Conn) {
+		connected = append(connected, c)
+	})
+	chat.OnDisconnect(func(c *Conn) {
+		disconnected = append(disconnected, c)
+	})
+	chat.OnMessage(func(c *Conn, msg Message) {
+		messages = append(messages, msg.Data())
+	})
+	chat.On("echo", func(c *Conn, s string) string {
+		return s
+	})
+
+	a.receive("", []byte("1::/chat?token=wrong"))
+	expectQueued(t, a, "7::/chat:unauthorized")
+
+	a.receive("", []byte("3::/chat:ignored"))
+	if len(messages) != 0 {
+		t.Fatalf("Did not expect messages from an unconnected endpoint, got %v", messages)
+	}
+
+	a.receive("", []byte("1::/chat?token=secret"))
+	expectQueued(t, a, "1::/chat")
+	b.receive("", []byte("1::/chat?token=secret"))
+	expectQueued(t, b, "1::/chat")
+	if len(connected) != 2 || connected[0] != a || connected[1] != b {
+		t.Fatalf("Expected a and b to be connected, got %v", connected)
+	}
+
+	a.receive("", []byte("3::/chat:hello"))
+	a.receive("", []byte("3:::hello"))
+	if len(messages) != 1 || messages[0] != "hello" || defaultMessages != 1 {
+		t.Fatalf("Expected the messages to be routed by endpoint, got %v and %d", messages, defaultMessages)
+	}
+
+	a.receive("", []byte(`5:1+:/chat:{"name":"echo","args":["x"]}`))
+	expectQueued(t, a, `6::/chat:1+["x"]`)
+
+	if err := chat.Emit(a, "tweet", "hi"); err != nil {
+		t.Fatal("Emit:", err)
+	}
+	expectQueued(t, a, `5::/chat:{"name":"tweet","args":["hi"]}`)
+
+	chat.BroadcastExcept(a, "hey")
+	expectQueued(t, b, "3::/chat:hey")
+	if len(a.queue) != 0 {
+		t.Fatal("Did not expect a broadcast to the excepted connection")
+	}
+
+	a.receive("", []byte("0::/chat"))
+	sio.onDisconnect(b)
+	if len(disconnected) != 2 || disconnected[0] != a || disconnected[1] != b {
+		t.Fatalf("Expected a and b to be disconnected, got %v", disconnected)
+	}
+
+	a.receive("", []byte("1::/unknown"))
+	expectQueued(t, a, "7::/unknown:unknown endpoint")
+}
@@ -0,0 +1,276 @@
+package socketio
+
+import (
+	"context"
+)
+
+// OverflowPolicy tells what Send does when the send queue of a connection is
+// full.
+type OverflowPolicy int
+
+const (
+	// OverflowDropNewest drops the message being sent and Send returns
+	// ErrQueueFull.
+	OverflowDropNewest OverflowPolicy = iota
+
+	// OverflowDropOldest drops the oldest queued message to make room for
+	// the message being sent. The control messages, e.g. the heartbeats and
+	// the acknowledgements, are never dropped to make room, so Send returns ErrQueueFull
+	// if the queue holds nothing else.
+	OverflowDropOldest
+
+	// OverflowDisconnect disconnects the slow connection and Send returns
+	// ErrQueueFull.
+	OverflowDisconnect
+
+	// OverflowCoalesce replaces the latest queued message sent with the same
+	// key by SendKey. Other messages are dropped as with OverflowDropNewest.
+	OverflowCoalesce
+)
+
+// Keyed is a message sent with SendKey.
+type keyed struct {
+	key  string
+	data interface{}
+}
+
+// Unkeyed returns the data of a message sent with SendKey or msg itself.
+func unkeyed(msg interface{}) interface{} {
+	if k, ok := msg.(keyed); ok {
+		return k.data
+	}
+	return msg
+}
+
+// Control reports whether msg is one of the messages that keep the session
+// and its namespaces going, which are never evicted or coalesced.
+func control(msg interface{}) bool {
+	switch m := msg.(type) {
+	case heartbeat, disconnect, ackReply:
+		return true
+	case SIO07Packet:
+		return m.Type != SIO07PacketMessage && m.Type != SIO07PacketJSON && m.Type != SIO07PacketEvent && m.Type != SIO07PacketBinary
+	case endpointed:
+		return control(m.data)
+	case keyed:
+		return control(m.data)
+	}
+	return false
+}
+
+// OnMessageDropped sets f to be invoked when a message is dropped because the
+// send queue of a connection is full. It passes the connection, the dropped
+// data and the reason, i.e. DropReasonQueueFull, DropReasonEvicted or
+// DropReasonCoalesced, as arguments to the callback. The callback is invoked
+// from the goroutine that sent the message. The dropped control messages, e.g.
+// the heartbeats and the acknowledgements, are only counted in the metrics.
+func (sio *SocketIO) OnMessageDropped(f func(*Conn, interface{}, string)) error {
+	sio.callbacks.onMessageDropped = f
+	return nil
+}
+
+// SendKey queues data just like Send, but it tags the data with key. When the
+// send queue is full and the Config.OverflowPolicy is OverflowCoalesce, data
+// replaces the latest queued message with the same key, e.g. an older position
+// update of the same object.
+func (c *Conn) SendKey(key string, data interface{}) error {
+	return c.send(keyed{key, data})
+}
+
+// SendContext queues data for a delivery just like Send, but when the send
+// queue is full it waits for room instead of applying the
+// Config.OverflowPolicy. It returns the error of ctx if ctx is done before the
+// data can be queued, or ErrDestroyed if the connection gets disconnected.
+func (c *Conn) SendContext(ctx context.Context, data interface{}) error {
+	for {
+		c.mutex.Lock()
+
+		if c.disconnected {
+			c.mutex.Unlock()
+			return ErrDestroyed
+		}
+
+		select {
+		case c.queue <- data:
+			c.mutex.Unlock()
+			return nil
+		default:
+		}
+
+		dequeued := c.dequeued
+		c.mutex.Unlock()
+
+		select {
+		case <-dequeued:
+		case <-c.closed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Send queues data and applies the Config.OverflowPolicy if the send queue is
+// full. The dropped messages are reported after the lock is released.
+func (c *Conn) send(data interface{}) error {
+	return c.sendQueued(data, nil)
+}
+
+// SendQueued sends data like send and invokes queued, if not nil, with c.mutex
+// held once data is in the queue, i.e. before the flusher can take it.
+func (c *Conn) sendQueued(data interface{}, queued func()) error {
+	c.mutex.Lock()
+
+	if c.disconnected {
+		c.mutex.Unlock()
+		return ErrDestroyed
+	}
+
+	if queued == nil {
+		queued = func() {}
+	}
+
+	select {
+	case c.queue <- data:
+		queued()
+		c.mutex.Unlock()
+		return nil
+	default:
+	}
+
+	var dropped interface{}
+	var reason string
+	err := ErrQueueFull
+	disconnect := false
+
+	switch c.sio.config.OverflowPolicy {
+	case OverflowDropOldest:
+		var ok bool
+		if dropped, ok = c.evict(data); ok {
+			reason, err = DropReasonEvicted, nil
+		}
+
+	case OverflowCoalesce:
+		if k, ok := data.(keyed); ok {
+			if dropped, ok = c.coalesce(k); ok {
+				reason, err = DropReasonCoalesced, nil
+			}
+		}
+
+	case OverflowDisconnect:
+		c.disconnect(DisconnectReasonSlowConsumer)
+		disconnect = true
+	}
+
+	if err != nil {
+		dropped, reason = data, DropReasonQueueFull
+	} else {
+		queued()
+	}
+
+	c.mutex.Unlock()
+
+	c.dropped(dropped, reason)
+	if disconnect {
+		c.sio.onDisconnect(c)
+	}
+
+	return err
+}
+
+// Evict drops the oldest queued message that is not a control message and
+// queues data in its place at the end of the queue. It reports whether there
+// was one and returns it. The caller holds c.mutex.
+func (c *Conn) evict(data interface{}) (interface{}, bool) {
+	queued := c.drain()
+
+	var old interface{}
+	found := false
+	for i, q := range queued {
+		if !control(q) {
+			old, found = q, true
+			queued = append(append(queued[:i], queued[i+1:]...), data)
+			break
+		}
+	}
+
+	c.requeue(queued)
+	return old, found
+}
+
+// Coalesce replaces the latest queued message with the key of k. It reports
+// whether there was one and returns it. The caller holds c.mutex.
+func (c *Conn) coalesce(k keyed) (interface{}, bool) {
+	queued := c.drain()
+
+	var old interface{}
+	found := false
+	for i := len(queued) - 1; i >= 0; i-- {
+		if q, ok := queued[i].(keyed); ok && q.key == k.key && !control(q) {
+			old, queued[i], found = q, k, true
+			break
+		}
+	}
+
+	c.requeue(queued)
+	return old, found
+}
+
+// Drain empties the send queue and returns the messages in their order. The
+// caller holds c.mutex and puts them back with requeue.
+func (c *Conn) drain() []interface{} {
+	queued := make([]interface{}, 0, len(c.queue))
+	for {
+		select {
+		case q := <-c.queue:
+			queued = append(queued, q)
+		default:
+			return queued
+		}
+	}
+}
+
+// Requeue queues the drained messages again. The caller holds c.mutex.
+func (c *Conn) requeue(queued []interface{}) {
+	for _, q := range queued {
+		c.queue <- q
+	}
+}
+
+// Dropped reports data dropped from the send queue. A message requesting an
+// acknowledgement that was dropped after it was queued fails its callback.
+func (c *Conn) dropped(data interface{}, reason string) {
+	c.sio.metrics.MessagesDropped(reason, 1)
+
+	if r, ok := data.(ackRequest); ok {
+		if a := c.popAck(r.id); a != nil {
+			a.callback(nil, ErrQueueFull)
+		}
+	}
+
+	if f := c.sio.callbacks.onMessageDropped; f != nil && !control(data) {
+		f(c, userData(data), reason)
+	}
+}
+
+// UserData returns the data of a queued message as it was given to the
+// sending method, without the wrapping of the keys and the namespaces.
+func userData(msg interface{}) interface{} {
+	switch m := msg.(type) {
+	case keyed:
+		return userData(m.data)
+	case endpointed:
+		return userData(m.data)
+	case ackRequest:
+		return userData(m.data)
+	case binaryData:
+		return []byte(m)
+	}
+	return msg
+}
+
+// SignalDequeued wakes up the senders waiting for room in the send queue. The
+// caller holds c.mutex.
+func (c *Conn) signalDequeued() {
+	close(c.dequeued)
+	c.dequeued = make(chan struct{})
+}
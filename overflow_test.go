@@ -0,0 +1,194 @@
+package socketio
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// OverflowConn returns a connection with a send queue of length 2 that is
+// already full with "a" and "b".
+func overflowConn(t *testing.T, policy OverflowPolicy, keys ...string) (*Conn, *[]string) {
+	config := DefaultConfig
+	config.Logger = NOPLogger
+	config.Codec = SIO07Codec{}
+	config.QueueLength = 2
+	config.OverflowPolicy = policy
+	sio := NewSocketIO(&config)
+
+	var dropped []string
+	sio.OnMessageDropped(func(c *Conn, data interface{}, reason string) {
+		dropped = append(dropped, data.(string)+":"+reason)
+	})
+
+	c := connectedConn(t, sio)
+	for len(c.queue) > 0 {
+		<-c.queue
+	}
+
+	for i, data := range []string{"a", "b"} {
+		var err error
+		if i < len(keys) {
+			err = c.SendKey(keys[i], data)
+		} else {
+			err = c.Send(data)
+		}
+		if err != nil {
+			t.Fatal("Send:", err)
+		}
+	}
+
+	return c, &dropped
+}
+
+func expectDropped(t *testing.T, dropped *[]string, expect ...string) {
+	if len(*dropped) != len(expect) {
+		t.Fatalf("Expected %q to be dropped but got %q", expect, *dropped)
+	}
+	for i := range expect {
+		if (*dropped)[i] != expect[i] {
+			t.Fatalf("Expected %q to be dropped but got %q", expect, *dropped)
+		}
+	}
+}
+
+func TestOverflowDropNewest(t *testing.T) {
+	c, dropped := overflowConn(t, OverflowDropNewest)
+
+	if err := c.Send("c"); err != ErrQueueFull {
+		t.Fatalf("Expected ErrQueueFull but got %v", err)
+	}
+	expectDropped(t, dropped, "c:"+DropReasonQueueFull)
+	expectQueued(t, c, "3:::a")
+	expectQueued(t, c, "3:::b")
+}
+
+func TestOverflowDropOldest(t *testing.T) {
+	c, dropped := overflowConn(t, OverflowDropOldest)
+
+	if err := c.Send("c"); err != nil {
+		t.Fatal("Send:", err)
+	}
+	expectDropped(t, dropped, "a:"+DropReasonEvicted)
+	expectQueued(t, c, "3:::b")
+	expectQueued(t, c, "3:::c")
+}
+
+func TestOverflowCoalesce(t *testing.T) {
+	c, dropped := overflowConn(t, OverflowCoalesce, "x", "y")
+
+	if err := c.SendKey("x", "c"); err != nil {
+		t.Fatal("SendKey:", err)
+	}
+	if err := c.SendKey("z", "d"); err != ErrQueueFull {
+		t.Fatalf("Expected ErrQueueFull for a new key but got %v", err)
+	}
+	if err := c.Send("e"); err != ErrQueueFull {
+		t.Fatalf("Expected ErrQueueFull for an unkeyed message but got %v", err)
+	}
+	expectDropped(t, dropped, "a:"+DropReasonCoalesced, "d:"+DropReasonQueueFull, "e:"+DropReasonQueueFull)
+	expectQueued(t, c, "3:::c")
+	expectQueued(t, c, "3:::b")
+}
+
+func TestOverflowDisconnect(t *testing.T) {
+	c, dropped := overflowConn(t, OverflowDisconnect)
+
+	if err := c.Send("c"); err != ErrQueueFull {
+		t.Fatalf("Expected ErrQueueFull but got %v", err)
+	}
+	expectDropped(t, dropped, "c:"+DropReasonQueueFull)
+	if !c.disconnected {
+		t.Fatal("Expected the slow connection to be disconnected")
+	}
+	if err := c.Send("d"); err != ErrDestroyed {
+		t.Fatalf("Expected ErrDestroyed but got %v", err)
+	}
+}
+
+func TestSendContext(t *testing.T) {
+	c, dropped := overflowConn(t, OverflowDropNewest)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := c.SendContext(ctx, "c"); err != context.DeadlineExceeded {
+		t.Fatalf("Expected context.DeadlineExceeded but got %v", err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- c.SendContext(context.Background(), "d")
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("Expected SendContext to block but it returned %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// Act as the flusher.
+	<-c.queue
+	c.mutex.Lock()
+	c.signalDequeued()
+	c.mutex.Unlock()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal("SendContext:", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected SendContext to return after the queue was drained")
+	}
+
+	expectDropped(t, dropped)
+	expectQueued(t, c, "3:::b")
+	expectQueued(t, c, "3:::d")
+
+	go func() {
+		c.Send("e")
+		c.Send("f")
+		done <- c.SendContext(context.Background(), "g")
+	}()
+	time.Sleep(20 * time.Millisecond)
+	c.Close()
+
+	select {
+	case err := <-done:
+		if err != ErrDestroyed {
+			t.Fatalf("Expected ErrDestroyed but got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected SendContext to return after the connection was closed")
+	}
+}
+
+func TestOverflowControlMessages(t *testing.T) {
+	c, dropped := overflowConn(t, OverflowDropOldest)
+	<-c.queue
+	<-c.queue
+
+	c.queue <- heartbeat(1)
+	if err := c.Send("b"); err != nil {
+		t.Fatal("Send:", err)
+	}
+
+	// the heartbeat is older, but only the user's messages are evicted
+	if err := c.Send("c"); err != nil {
+		t.Fatal("Send:", err)
+	}
+	if err := c.Send(ackReply{1, nil}); err != nil {
+		t.Fatal("Send:", err)
+	}
+	if err := c.Send("d"); err != ErrQueueFull {
+		t.Fatalf("Expected ErrQueueFull but got %v", err)
+	}
+	if err := c.Send(disconnect(0)); err != ErrQueueFull {
+		t.Fatalf("Expected ErrQueueFull but got %v", err)
+	}
+
+	// the dropped disconnect is not reported to the callback
+	expectDropped(t, dropped, "b:"+DropReasonEvicted, "c:"+DropReasonEvicted, "d:"+DropReasonQueueFull)
+	expectQueued(t, c, "2::")
+	expectQueued(t, c, "6:::1")
+}
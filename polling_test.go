@@ -0,0 +1,126 @@
+package socketio
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPollingKeepAlive(t *testing.T) {
+	config := DefaultConfig
+	config.Logger = NOPLogger
+	config.Codec = SIO07Codec{}
+	config.Transports = []Transport{
+		NewXHRPollingTransport(100*time.Millisecond, time.Second),
+		NewJSONPPollingTransport(100*time.Millisecond, time.Second),
+	}
+	sio := NewSocketIO(&config)
+
+	connected := make(chan *Conn, 2)
+	sio.OnConnect(func(c *Conn) {
+		connected <- c
+	})
+	received := make(chan string, 1)
+	sio.OnMessage(func(c *Conn, msg Message) {
+		received <- msg.Data()
+	})
+
+	var conns int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("X-Middleware", "yes")
+		sio.ServeMux().ServeHTTP(w, req)
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	get := func(url string) *http.Response {
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatal("Get:", err)
+		}
+		return resp
+	}
+	read := func(resp *http.Response) string {
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal("ReadAll:", err)
+		}
+		return string(body)
+	}
+
+	resp := get(server.URL + "/socket.io/xhr-polling")
+	if resp.Header.Get("X-Middleware") != "yes" || resp.ProtoMajor != 1 || resp.Close {
+		t.Fatalf("Expected a kept-alive response with the middleware headers but got %v", resp.Header)
+	}
+	read(resp)
+	c := <-connected
+	resource := server.URL + "/socket.io/xhr-polling/" + string(c.sessionid)
+
+	c.Send("a")
+	if body := read(get(resource)); !strings.Contains(body, "3:::a") {
+		t.Fatalf("Expected the message to be polled but got %q", body)
+	}
+
+	form := url.Values{"data": {"3:::up"}}
+	if resp, err := http.PostForm(resource, form); err != nil {
+		t.Fatal("PostForm:", err)
+	} else {
+		read(resp)
+	}
+	if msg := <-received; msg != "up" {
+		t.Fatalf("Expected the server to receive up but got %q", msg)
+	}
+
+	// a poll that times out is answered with an empty response
+	resp = get(resource)
+	if body := read(resp); resp.StatusCode != http.StatusOK || body != "" {
+		t.Fatalf("Expected an empty response but got %d %q", resp.StatusCode, body)
+	}
+
+	if body := read(get(server.URL + "/socket.io/jsonp-polling?t=3")); !strings.HasPrefix(body, "io.JSONP[3]._(") {
+		t.Fatalf("Expected a jsonp handshake but got %q", body)
+	}
+	<-connected
+
+	if n := atomic.LoadInt32(&conns); n != 1 {
+		t.Fatalf("Expected the polls to reuse a single connection but there were %d", n)
+	}
+}
+
+func TestPollingHTTP2(t *testing.T) {
+	config := DefaultConfig
+	config.Logger = NOPLogger
+	config.Codec = SIO07Codec{}
+	sio := NewSocketIO(&config)
+
+	server := httptest.NewUnstartedServer(sio.ServeMux())
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL + "/socket.io/xhr-polling")
+	if err != nil {
+		t.Fatal("Get:", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal("ReadAll:", err)
+	}
+	if resp.ProtoMajor != 2 || !strings.Contains(string(body), "1::") {
+		t.Fatalf("Expected a handshake over HTTP/2 but got %s %q", resp.Proto, body)
+	}
+}
@@ -0,0 +1,791 @@
+package socketio
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrReplayNotFound is used when a replay storage has no messages of a session.
+var ErrReplayNotFound = errors.New("replay buffer not found")
+
+// ReplayStorage keeps the sent messages of the sessions, so that they can be
+// replayed to a client that reconnects after missing some of them.
+//
+// Every message written to a session, except for the heartbeats, has a
+// sequence number: the first one has 1 and each following one has the number
+// of the previous one plus one. A client keeps count of the messages it has
+// decoded after the handshake and reconnects with the number of the latest one
+// in the seq query parameter, e.g. GET /socket.io/websocket/<sessionid>?seq=42.
+//
+// Append stores the encoded frame of the message seq of the session. It may
+// discard the oldest messages to stay within its capacity. Since returns the
+// frames of the messages after seq in order, along with the sequence number of
+// the first one, or the number of the next message to append if there are no
+// such messages. It returns ErrReplayNotFound if it has no messages of the
+// session. Exists tells if there are messages of the session without reading
+// them. Trim discards the messages up to and including seq. Remove discards
+// all the messages of the session.
+type ReplayStorage interface {
+	Append(sid SessionID, seq uint64, frame []byte) error
+	Since(sid SessionID, seq uint64) (frames [][]byte, first uint64, err error)
+	Exists(sid SessionID) (bool, error)
+	Trim(sid SessionID, seq uint64) error
+	Remove(sid SessionID) error
+}
+
+// MemoryReplayStorage is the default replay storage that keeps the messages in
+// memory. It is safe for concurrent use.
+type MemoryReplayStorage struct {
+	mutex    sync.Mutex
+	capacity int
+	buffers  map[SessionID]*memoryReplayBuffer
+}
+
+type memoryReplayBuffer struct {
+	first  uint64 // The sequence number of frames[0].
+	frames [][]byte
+}
+
+// NewMemoryReplayStorage creates a new empty memory replay storage that keeps
+// at most capacity messages of each session. A capacity of zero or less means
+// no limit.
+func NewMemoryReplayStorage(capacity int) *MemoryReplayStorage {
+	return &MemoryReplayStorage{
+		capacity: capacity,
+		buffers:  make(map[SessionID]*memoryReplayBuffer),
+	}
+}
+
+func (ms *MemoryReplayStorage) Append(sid SessionID, seq uint64, frame []byte) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	b, ok := ms.buffers[sid]
+	if !ok {
+		b = new(memoryReplayBuffer)
+		ms.buffers[sid] = b
+	}
+
+	if len(b.frames) == 0 {
+		b.first = seq
+	}
+	b.frames = append(b.frames, append([]byte(nil), frame...))
+
+	if ms.capacity > 0 && len(b.frames) > ms.capacity {
+		n := len(b.frames) - ms.capacity
+		b.frames = append(b.frames[:0:0], b.frames[n:]...)
+		b.first += uint64(n)
+	}
+
+	return nil
+}
+
+func (ms *MemoryReplayStorage) Since(sid SessionID, seq uint64) ([][]byte, uint64, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	b, ok := ms.buffers[sid]
+	if !ok {
+		return nil, 0, ErrReplayNotFound
+	}
+
+	next := b.first + uint64(len(b.frames))
+	if seq >= next {
+		return nil, next, nil
+	}
+
+	skip := 0
+	if seq >= b.first {
+		skip = int(seq - b.first + 1)
+	}
+
+	return append([][]byte(nil), b.frames[skip:]...), b.first + uint64(skip), nil
+}
+
+func (ms *MemoryReplayStorage) Exists(sid SessionID) (bool, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	_, ok := ms.buffers[sid]
+	return ok, nil
+}
+
+func (ms *MemoryReplayStorage) Trim(sid SessionID, seq uint64) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	b, ok := ms.buffers[sid]
+	if !ok || seq < b.first {
+		return nil
+	}
+
+	next := b.first + uint64(len(b.frames))
+	if seq >= next {
+		seq = next - 1
+	}
+
+	b.frames = append(b.frames[:0:0], b.frames[seq-b.first+1:]...)
+	b.first = seq + 1
+	return nil
+}
+
+func (ms *MemoryReplayStorage) Remove(sid SessionID) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	delete(ms.buffers, sid)
+	return nil
+}
+
+// The minimum number of records in a replay file before it is compacted.
+const replayCompactMin = 64
+
+// FileReplayStorage is a replay storage that appends the messages of each
+// session to a file in a directory, so that they survive the restarts of the
+// server. The file of a session is kept open for appending until the session
+// is removed and the files are not synced to the disk after every message. It
+// is safe for concurrent use, and the sessions do not wait for each other.
+//
+// The retention timers of the server do not survive a restart, so the files
+// left over from before the start of the storage expire once they have not
+// been modified for the maxAge given to NewFileReplayStorage. A directory must
+// therefore not be shared by the servers running at the same time.
+type FileReplayStorage struct {
+	mutex    sync.Mutex // Protects files.
+	dir      string
+	capacity int
+	maxAge   time.Duration
+	files    map[SessionID]*replayFile
+}
+
+// ReplayFile tracks the records of a replay file.
+type replayFile struct {
+	mutex   sync.Mutex // Serializes the use of the file.
+	path    string
+	file    *os.File // The file opened for appending, if any.
+	loaded  bool     // Indicates if the records have been read from the disk.
+	removed bool     // Indicates if the file has been dropped from the storage.
+	first   uint64   // The sequence number of the first message kept.
+	next    uint64   // The sequence number of the next message.
+	records int      // The number of records in the file, including the discarded ones.
+}
+
+// NewFileReplayStorage creates a new file replay storage that keeps the files
+// in dir and at most capacity messages of each session. A capacity of zero or
+// less means no limit. The files left over in dir expire after maxAge, which is
+// usually the Config.ReplayRetention. A maxAge of zero or less keeps them until
+// they are resumed. The directory is created if it does not exist.
+func NewFileReplayStorage(dir string, capacity int, maxAge time.Duration) (*FileReplayStorage, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	fs := &FileReplayStorage{
+		dir:      dir,
+		capacity: capacity,
+		maxAge:   maxAge,
+		files:    make(map[SessionID]*replayFile),
+	}
+	if err := fs.expireLeftovers(); err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+// ExpireLeftovers removes the files left over from a previous server that
+// have expired, and the temporary files of an interrupted compaction. The
+// files that have not expired yet are removed once they do, unless they are
+// in use by then.
+func (fs *FileReplayStorage) expireLeftovers() error {
+	entries, err := os.ReadDir(fs.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".compact-") {
+			os.Remove(filepath.Join(fs.dir, name))
+			continue
+		}
+
+		if fs.maxAge <= 0 || !strings.HasSuffix(name, ".replay") {
+			continue
+		}
+		b, err := hex.DecodeString(strings.TrimSuffix(name, ".replay"))
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		sid := SessionID(b)
+		if age := time.Since(info.ModTime()); age >= fs.maxAge {
+			os.Remove(filepath.Join(fs.dir, name))
+		} else {
+			time.AfterFunc(fs.maxAge-age, func() { fs.expire(sid) })
+		}
+	}
+	return nil
+}
+
+// Expire removes the left over file of sid, unless the file has been used
+// since the start of the storage.
+func (fs *FileReplayStorage) expire(sid SessionID) {
+	p, err := fs.path(sid)
+	if err != nil {
+		return
+	}
+
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	if _, ok := fs.files[sid]; !ok {
+		os.Remove(p)
+	}
+}
+
+// Expired tells if the file at p is a left over that has not been modified for
+// the maxAge.
+func (fs *FileReplayStorage) expired(p string) bool {
+	if fs.maxAge <= 0 {
+		return false
+	}
+	info, err := os.Stat(p)
+	return err == nil && time.Since(info.ModTime()) >= fs.maxAge
+}
+
+// Path returns the path of the file of sid. The session id is hex encoded in
+// the name of the file, so that any id, including the ones coming from the
+// clients, maps to its own file in the directory.
+func (fs *FileReplayStorage) path(sid SessionID) (string, error) {
+	if sid == "" {
+		return "", ErrReplayNotFound
+	}
+	return filepath.Join(fs.dir, hex.EncodeToString([]byte(sid))+".replay"), nil
+}
+
+// Acquire returns the file of sid with its mutex locked, reading its records
+// from the disk if it has not been seen since the start of the server. Unless
+// create is set, it returns ErrReplayNotFound if there is no file on the disk.
+// The caller unlocks f.mutex.
+func (fs *FileReplayStorage) acquire(sid SessionID, create bool) (*replayFile, error) {
+	p, err := fs.path(sid)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		f := fs.entry(sid, p)
+		f.mutex.Lock()
+
+		if f.removed {
+			// the file was removed while waiting for it
+			f.mutex.Unlock()
+			continue
+		}
+		if f.loaded {
+			return f, nil
+		}
+
+		if fs.expired(f.path) {
+			os.Remove(f.path)
+		}
+		if err = f.load(fs.capacity); err == nil || err == ErrReplayNotFound && create {
+			f.loaded = true
+			return f, nil
+		}
+
+		fs.forget(sid, f)
+		f.mutex.Unlock()
+		return nil, err
+	}
+}
+
+// Entry returns the file of sid, adding it to the storage if needed.
+func (fs *FileReplayStorage) entry(sid SessionID, p string) *replayFile {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	f, ok := fs.files[sid]
+	if !ok {
+		f = &replayFile{path: p}
+		fs.files[sid] = f
+	}
+	return f
+}
+
+// Forget drops f from the storage. The caller holds f.mutex.
+func (fs *FileReplayStorage) forget(sid SessionID, f *replayFile) {
+	f.removed = true
+
+	fs.mutex.Lock()
+	if fs.files[sid] == f {
+		delete(fs.files, sid)
+	}
+	fs.mutex.Unlock()
+}
+
+// Load reads the records of the file from the disk. It returns
+// ErrReplayNotFound if the file does not exist. The caller holds f.mutex.
+func (f *replayFile) load(capacity int) error {
+	err := readReplayFile(f.path, func(seq uint64, frame []byte) {
+		if f.records == 0 {
+			f.first = seq
+		}
+		f.next = seq + 1
+		f.records++
+	})
+	if os.IsNotExist(err) {
+		return ErrReplayNotFound
+	} else if err != nil {
+		return err
+	}
+
+	if capacity > 0 && f.next-f.first > uint64(capacity) {
+		f.first = f.next - uint64(capacity)
+	}
+	return nil
+}
+
+// Close closes the file opened for appending, if any. The caller holds
+// f.mutex.
+func (f *replayFile) close() error {
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+func (fs *FileReplayStorage) Append(sid SessionID, seq uint64, frame []byte) error {
+	f, err := fs.acquire(sid, true)
+	if err != nil {
+		return err
+	}
+	defer f.mutex.Unlock()
+
+	if f.file == nil {
+		if f.file, err = os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600); err != nil {
+			return err
+		}
+	}
+	if err = writeReplayRecord(f.file, seq, frame); err != nil {
+		return err
+	}
+
+	if f.first == f.next {
+		f.first = seq
+	}
+	f.next = seq + 1
+	f.records++
+
+	if fs.capacity > 0 && f.next-f.first > uint64(fs.capacity) {
+		f.first = f.next - uint64(fs.capacity)
+	}
+
+	if f.records >= replayCompactMin && uint64(f.records) > 2*(f.next-f.first) {
+		return fs.compact(f)
+	}
+	return nil
+}
+
+// Compact rewrites the file without the discarded records. The caller holds
+// f.mutex.
+func (fs *FileReplayStorage) compact(f *replayFile) error {
+	tmp, err := os.CreateTemp(fs.dir, ".compact-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	records := 0
+	var werr error
+	err = readReplayFile(f.path, func(seq uint64, frame []byte) {
+		if seq >= f.first && werr == nil {
+			werr = writeReplayRecord(w, seq, frame)
+			records++
+		}
+	})
+	if err == nil {
+		err = werr
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	// the file opened for appending is replaced, so it is reopened by the
+	// next Append
+	f.close()
+	if err = os.Rename(tmp.Name(), f.path); err != nil {
+		return err
+	}
+	f.records = records
+	return nil
+}
+
+func (fs *FileReplayStorage) Since(sid SessionID, seq uint64) ([][]byte, uint64, error) {
+	f, err := fs.acquire(sid, false)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.mutex.Unlock()
+
+	if f.first == f.next || seq >= f.next-1 {
+		return nil, f.next, nil
+	}
+
+	var frames [][]byte
+	var first uint64
+	err = readReplayFile(f.path, func(s uint64, frame []byte) {
+		if s > seq && s >= f.first {
+			if frames == nil {
+				first = s
+			}
+			frames = append(frames, frame)
+		}
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	if frames == nil {
+		first = f.next
+	}
+
+	return frames, first, nil
+}
+
+func (fs *FileReplayStorage) Exists(sid SessionID) (bool, error) {
+	p, err := fs.path(sid)
+	if err != nil {
+		return false, nil
+	}
+
+	fs.mutex.Lock()
+	f, ok := fs.files[sid]
+	fs.mutex.Unlock()
+	if ok {
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+		if f.loaded && !f.removed {
+			return true, nil
+		}
+	}
+
+	if _, err = os.Stat(p); os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return !fs.expired(p), nil
+}
+
+func (fs *FileReplayStorage) Trim(sid SessionID, seq uint64) error {
+	f, err := fs.acquire(sid, false)
+	if err == ErrReplayNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.mutex.Unlock()
+
+	if seq >= f.first {
+		f.first = seq + 1
+		if f.first > f.next {
+			f.first = f.next
+		}
+	}
+	return nil
+}
+
+func (fs *FileReplayStorage) Remove(sid SessionID) error {
+	p, err := fs.path(sid)
+	if err != nil {
+		return nil
+	}
+
+	// the file stays in the storage until it is removed from the disk, so
+	// that a concurrent Append does not recreate it in between
+	f := fs.entry(sid, p)
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.close()
+	fs.forget(sid, f)
+
+	if err = os.Remove(p); os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Close closes the files kept open for appending. The storage can still be
+// used after, in which case the files are opened again.
+func (fs *FileReplayStorage) Close() error {
+	fs.mutex.Lock()
+	files := make([]*replayFile, 0, len(fs.files))
+	for _, f := range fs.files {
+		files = append(files, f)
+	}
+	fs.mutex.Unlock()
+
+	var err error
+	for _, f := range files {
+		f.mutex.Lock()
+		if cerr := f.close(); err == nil {
+			err = cerr
+		}
+		f.mutex.Unlock()
+	}
+	return err
+}
+
+// WriteReplayRecord writes a record of a replay file: the sequence number and
+// the length of the frame followed by the frame itself. The record is written
+// at once, so that the records appended to a file are not interleaved.
+func writeReplayRecord(w io.Writer, seq uint64, frame []byte) error {
+	b := make([]byte, 12, 12+len(frame))
+	binary.BigEndian.PutUint64(b[:8], seq)
+	binary.BigEndian.PutUint32(b[8:], uint32(len(frame)))
+
+	_, err := w.Write(append(b, frame...))
+	return err
+}
+
+// ReadReplayFile calls f for each record of the replay file at p. A truncated
+// record at the end of the file, e.g. after a crash, is ignored.
+func readReplayFile(p string, f func(seq uint64, frame []byte)) error {
+	file, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	var header [12]byte
+
+	for {
+		if _, err = io.ReadFull(r, header[:]); err != nil {
+			break
+		}
+
+		frame := make([]byte, binary.BigEndian.Uint32(header[8:]))
+		if _, err = io.ReadFull(r, frame); err != nil {
+			break
+		}
+
+		f(binary.BigEndian.Uint64(header[:8]), frame)
+	}
+
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil
+	}
+	return err
+}
+
+// Encode encodes msg to buf. Unless msg is a heartbeat, it records the start
+// and the end of its frame to spans, so that the frame can be stored for a
+// replay.
+func (c *Conn) encode(buf *bytes.Buffer, spans *[][2]int, msg interface{}) error {
+	start := buf.Len()
+	if err := c.enc.Encode(buf, unkeyed(msg)); err != nil {
+		return err
+	}
+
+	// a message encoded to nothing never reaches the client, so it is not
+	// numbered either
+	if _, ok := msg.(heartbeat); !ok && buf.Len() > start {
+		*spans = append(*spans, [2]int{start, buf.Len()})
+	}
+	return nil
+}
+
+// Record numbers the frames encoded to p and stores them for a replay. The
+// spans are the ones recorded by encode. The caller holds c.mutex.
+func (c *Conn) record(p []byte, spans [][2]int) {
+	for _, span := range spans {
+		c.seq++
+
+		if c.sio.replay != nil {
+			if err := c.sio.replay.Append(c.sessionid, c.seq, p[span[0]:span[1]]); err != nil {
+				c.log(LogError, "sio/conn: unable to record", "record", LogKeyError, err)
+			}
+		}
+	}
+}
+
+// Replay writes the messages the client has missed to the socket. The client
+// tells the sequence number of the latest message it has seen with the seq
+// query parameter of req, or an EventSource with its Last-Event-ID header.
+// Without either, the messages after the latest succesful write are replayed. The caller holds c.mutex.
+func (c *Conn) replay(req *http.Request) {
+	if c.sio.replay == nil {
+		return
+	}
+
+	s := req.URL.Query().Get("seq")
+	if sid, seq := lastEventID(req); s == "" && string(sid) == c.publicID() {
+		s = seq
+	}
+
+	seen := c.written
+	if s != "" {
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil || n > c.seq {
+			c.log(LogWarn, "sio/conn: invalid replay seq", "replay", "seq", s)
+		} else {
+			seen = n
+			if err = c.sio.replay.Trim(c.sessionid, seen); err != nil {
+				c.log(LogError, "sio/conn: unable to trim the replay buffer", "replay", LogKeyError, err)
+			}
+		}
+	}
+
+	if seen >= c.seq {
+		c.written = c.seq
+		return
+	}
+
+	frames, first, err := c.sio.replay.Since(c.sessionid, seen)
+	if err == ErrReplayNotFound {
+		first = c.seq + 1
+	} else if err != nil {
+		c.log(LogError, "sio/conn: unable to replay", "replay", LogKeyError, err)
+		return
+	}
+
+	if missing := first - seen - 1; missing > 0 {
+		c.log(LogWarn, "sio/conn: lost messages to replay", "replay", "messages", missing)
+		c.sio.metrics.MessagesDropped(DropReasonReplayGap, int(missing))
+	}
+
+	if len(frames) > 0 {
+		c.labelEvents()
+		if _, err = c.socket.Write(bytes.Join(frames, nil)); err != nil {
+			c.log(LogInfo, "sio/conn: unable to write the replay", "replay", LogKeyError, err)
+			return
+		}
+		c.log(LogDebug, "sio/conn: replayed messages", "replay", "messages", len(frames))
+	}
+
+	c.written = c.seq
+}
+
+// ReplayRetained tells if the replay buffer of a session disconnected for the
+// given reason is kept for a resume.
+func replayRetained(reason string) bool {
+	return reason == DisconnectReasonReconnectTimeout || reason == DisconnectReasonHeartbeat
+}
+
+// ReleaseReplay discards the replay buffer of a disconnected session, or
+// schedules it to be discarded after the Config.ReplayRetention.
+func (sio *SocketIO) releaseReplay(sid SessionID, reason string) {
+	if sio.replay == nil {
+		return
+	}
+
+	retention := sio.config.ReplayRetention
+	if retention <= 0 || !replayRetained(reason) {
+		if err := sio.replay.Remove(sid); err != nil {
+			sio.log(LogError, "sio/releaseReplay: unable to remove the replay buffer", "replay", LogKeySessionID, sid, LogKeyError, err)
+		}
+		return
+	}
+
+	sio.replayLock.Lock()
+	defer sio.replayLock.Unlock()
+
+	if t, ok := sio.retained[sid]; ok {
+		t.Stop()
+	}
+
+	// Shutdown stops the timers, so no new ones are started after it
+	if sio.isShuttingDown() {
+		delete(sio.retained, sid)
+		return
+	}
+
+	var t *time.Timer
+	t = time.AfterFunc(retention, func() {
+		sio.replayLock.Lock()
+		if sio.retained[sid] != t {
+			sio.replayLock.Unlock()
+			return
+		}
+		delete(sio.retained, sid)
+		sio.replayLock.Unlock()
+
+		if err := sio.replay.Remove(sid); err != nil {
+			sio.log(LogError, "sio/releaseReplay: unable to remove the replay buffer", "replay", LogKeySessionID, sid, LogKeyError, err)
+		}
+	})
+	sio.retained[sid] = t
+}
+
+// StopRetention stops the timers discarding the retained replay buffers.
+func (sio *SocketIO) stopRetention() {
+	sio.replayLock.Lock()
+	defer sio.replayLock.Unlock()
+
+	for sid, t := range sio.retained {
+		t.Stop()
+		delete(sio.retained, sid)
+	}
+}
+
+// Resumable tells if a GET request with an unknown session id resumes a
+// session: the request has the seq parameter and the replay buffer of the
+// session is still retained.
+func (sio *SocketIO) resumable(sid SessionID, req *http.Request) bool {
+	if sio.replay == nil || sio.config.ReplayRetention <= 0 || req.Method != "GET" {
+		return false
+	}
+	if req.URL.Query().Get("seq") == "" {
+		return false
+	}
+
+	ok, err := sio.replay.Exists(sid)
+	if err != nil {
+		sio.log(LogError, "sio/resumable: unable to look up the replay buffer", "replay", LogKeySessionID, sid, LogKeyError, err)
+	}
+	return ok
+}
+
+// Resume turns the new connection c into the resumed session sid. The client
+// already has the session id, so it does not get a handshake.
+func (sio *SocketIO) resume(c *Conn, sid SessionID) {
+	sio.replayLock.Lock()
+	if t, ok := sio.retained[sid]; ok {
+		t.Stop()
+		delete(sio.retained, sid)
+	}
+	sio.replayLock.Unlock()
+
+	frames, first, _ := sio.replay.Since(sid, 0)
+
+	c.sessionid = sid
+	c.resumed = true
+	c.seq = first + uint64(len(frames)) - 1
+	c.written = c.seq
+}
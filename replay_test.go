@@ -0,0 +1,305 @@
+package socketio
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testReplayStorage(t *testing.T, rs ReplayStorage) {
+	if _, _, err := rs.Since("A", 0); err != ErrReplayNotFound {
+		t.Fatalf("Expected ErrReplayNotFound but got %v", err)
+	}
+	if ok, err := rs.Exists("A"); ok || err != nil {
+		t.Fatalf("Expected A not to exist but got %v %v", ok, err)
+	}
+
+	for i, frame := range []string{"a", "b", "c", "d"} {
+		if err := rs.Append("A", uint64(i+1), []byte(frame)); err != nil {
+			t.Fatal("Append:", err)
+		}
+	}
+
+	expect := func(seq uint64, first uint64, frames string) {
+		f, n, err := rs.Since("A", seq)
+		if err != nil {
+			t.Fatal("Since:", err)
+		}
+		var got []string
+		for _, frame := range f {
+			got = append(got, string(frame))
+		}
+		if n != first || strings.Join(got, "") != frames {
+			t.Fatalf("Since(%d): expected %d %q but got %d %q", seq, first, frames, n, got)
+		}
+	}
+
+	if ok, err := rs.Exists("A"); !ok || err != nil {
+		t.Fatalf("Expected A to exist but got %v %v", ok, err)
+	}
+
+	// the capacity is 3, so "a" has been discarded
+	expect(0, 2, "bcd")
+	expect(2, 3, "cd")
+	expect(4, 5, "")
+
+	if err := rs.Trim("A", 3); err != nil {
+		t.Fatal("Trim:", err)
+	}
+	expect(0, 4, "d")
+
+	if err := rs.Append("A", 5, []byte("e")); err != nil {
+		t.Fatal("Append:", err)
+	}
+	expect(3, 4, "de")
+
+	if err := rs.Remove("A"); err != nil {
+		t.Fatal("Remove:", err)
+	}
+	if _, _, err := rs.Since("A", 0); err != ErrReplayNotFound {
+		t.Fatalf("Expected ErrReplayNotFound after Remove but got %v", err)
+	}
+	if ok, err := rs.Exists("A"); ok || err != nil {
+		t.Fatalf("Expected A not to exist after Remove but got %v %v", ok, err)
+	}
+}
+
+func TestMemoryReplayStorage(t *testing.T) {
+	testReplayStorage(t, NewMemoryReplayStorage(3))
+}
+
+func TestFileReplayStorage(t *testing.T) {
+	dir := t.TempDir()
+
+	fs, err := NewFileReplayStorage(dir, 3, 0)
+	if err != nil {
+		t.Fatal("NewFileReplayStorage:", err)
+	}
+	testReplayStorage(t, fs)
+
+	for i := 1; i <= 2*replayCompactMin; i++ {
+		if err = fs.Append("B", uint64(i), []byte{byte(i)}); err != nil {
+			t.Fatal("Append:", err)
+		}
+	}
+
+	// a new storage reads the messages from the disk
+	if err = fs.Close(); err != nil {
+		t.Fatal("Close:", err)
+	}
+	if fs, err = NewFileReplayStorage(dir, 3, 0); err != nil {
+		t.Fatal("NewFileReplayStorage:", err)
+	}
+	frames, first, err := fs.Since("B", 0)
+	if err != nil {
+		t.Fatal("Since:", err)
+	}
+	if first != 2*replayCompactMin-2 || len(frames) != 3 || frames[2][0] != 2*replayCompactMin {
+		t.Fatalf("Expected the latest 3 messages after a restart but got %d %v", first, frames)
+	}
+
+	// any session id gets its own file in the directory, next to the one of B
+	sids := []SessionID{"../C", "node1-01ARZ3NDEKTSV4RRFFQ69G5FAV", "0b9e8d4e-5e6b-4f6e-8e2c-3c1f0d5a7b9c", "é/\\:*"}
+	for i, sid := range sids {
+		if err = fs.Append(sid, 1, []byte{byte(i)}); err != nil {
+			t.Fatalf("Append %q: %v", sid, err)
+		}
+	}
+	for i, sid := range sids {
+		if frames, _, err := fs.Since(sid, 0); err != nil || len(frames) != 1 || frames[0][0] != byte(i) {
+			t.Fatalf("Expected the message of %q but got %v %v", sid, frames, err)
+		}
+	}
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 1+len(sids) {
+		t.Fatalf("Expected a file per session in the directory but got %d %v", len(entries), err)
+	}
+}
+
+func TestFileReplayStorageSessions(t *testing.T) {
+	fs, err := NewFileReplayStorage(t.TempDir(), 0, 0)
+	if err != nil {
+		t.Fatal("NewFileReplayStorage:", err)
+	}
+	defer fs.Close()
+
+	// the sessions append to their own files concurrently
+	var wg sync.WaitGroup
+	for _, sid := range []SessionID{"A", "B", "C", "D"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 1; i <= 100; i++ {
+				if err := fs.Append(sid, uint64(i), []byte(sid)); err != nil {
+					t.Error("Append:", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, sid := range []SessionID{"A", "B", "C", "D"} {
+		frames, first, err := fs.Since(sid, 90)
+		if err != nil {
+			t.Fatal("Since:", err)
+		}
+		if first != 91 || len(frames) != 10 || string(frames[9]) != string(sid) {
+			t.Fatalf("Expected the latest 10 messages of %s but got %d %q", sid, first, frames)
+		}
+	}
+
+	// a removed session starts over
+	if err = fs.Remove("A"); err != nil {
+		t.Fatal("Remove:", err)
+	}
+	if _, _, err = fs.Since("A", 0); err != ErrReplayNotFound {
+		t.Fatalf("Expected ErrReplayNotFound after Remove but got %v", err)
+	}
+	if err = fs.Append("A", 1, []byte("a")); err != nil {
+		t.Fatal("Append:", err)
+	}
+	if frames, first, err := fs.Since("A", 0); err != nil || first != 1 || len(frames) != 1 {
+		t.Fatalf("Expected a single message after Remove but got %d %q %v", first, frames, err)
+	}
+}
+
+func TestFileReplayStorageExpiry(t *testing.T) {
+	dir := t.TempDir()
+
+	fs, err := NewFileReplayStorage(dir, 0, 0)
+	if err != nil {
+		t.Fatal("NewFileReplayStorage:", err)
+	}
+	for _, sid := range []SessionID{"A", "B", "C"} {
+		if err = fs.Append(sid, 1, []byte(sid)); err != nil {
+			t.Fatal("Append:", err)
+		}
+	}
+	if err = fs.Close(); err != nil {
+		t.Fatal("Close:", err)
+	}
+
+	age := func(sid SessionID, d time.Duration) {
+		p, _ := fs.path(sid)
+		if err := os.Chtimes(p, time.Now().Add(-d), time.Now().Add(-d)); err != nil {
+			t.Fatal("Chtimes:", err)
+		}
+	}
+
+	// A has expired before the start, B expires while it is left over and C
+	// is removed once its time is up
+	age("A", 2*time.Hour)
+	age("B", time.Minute)
+	age("C", time.Hour-100*time.Millisecond)
+	if fs, err = NewFileReplayStorage(dir, 0, time.Hour); err != nil {
+		t.Fatal("NewFileReplayStorage:", err)
+	}
+	defer fs.Close()
+
+	if p, _ := fs.path("A"); !os.IsNotExist(statErr(p)) {
+		t.Fatal("Expected the expired file to be removed at the start")
+	}
+	if ok, err := fs.Exists("B"); !ok || err != nil {
+		t.Fatalf("Expected B to exist but got %v %v", ok, err)
+	}
+	age("B", 2*time.Hour)
+	if ok, _ := fs.Exists("B"); ok {
+		t.Fatal("Expected B to have expired")
+	}
+	if _, _, err = fs.Since("B", 0); err != ErrReplayNotFound {
+		t.Fatalf("Expected ErrReplayNotFound for the expired file but got %v", err)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+	if p, _ := fs.path("C"); !os.IsNotExist(statErr(p)) {
+		t.Fatal("Expected the file to be removed once it expired")
+	}
+}
+
+// StatErr returns the error of os.Stat.
+func statErr(p string) error {
+	_, err := os.Stat(p)
+	return err
+}
+
+func TestReplay(t *testing.T) {
+	_, server, connected := testServer(t, func(config *Config) {
+		config.ReplayBufferSize = 100
+		config.ReplayRetention = time.Minute
+	})
+	url := server.URL + "/socket.io/xhr-polling"
+
+	handshake := poll(t, url)
+	c := <-connected
+	if !strings.Contains(handshake, string(c.sessionid)) {
+		t.Fatalf("Expected a handshake but got %q", handshake)
+	}
+	url += "/" + string(c.sessionid)
+
+	// there is no poll waiting, so the writes fail
+	c.Send("a")
+	c.Send("b")
+	waitRecorded(t, c, 2)
+
+	if body := poll(t, url); body != sio07Frame("3:::a")+sio07Frame("3:::b") {
+		t.Fatalf("Expected the failed messages to be replayed but got %q", body)
+	}
+
+	// the client has seen only "a"
+	if body := poll(t, url+"?seq=1"); body != sio07Frame("3:::b") {
+		t.Fatalf("Expected the missed message to be replayed but got %q", body)
+	}
+
+	c.Send("c")
+	if body := poll(t, url+"?seq=2"); body != sio07Frame("3:::c") {
+		t.Fatalf("Expected the new message but got %q", body)
+	}
+
+	// the session times out, but it can be resumed within the retention
+	c.Send("d")
+	waitRecorded(t, c, 4)
+	c.close(DisconnectReasonReconnectTimeout)
+
+	if body := poll(t, url+"?seq=3"); body != sio07Frame("3:::d") {
+		t.Fatalf("Expected the resumed session to replay the missed message but got %q", body)
+	}
+
+	resumed := <-connected
+	if resumed == c || resumed.sessionid != c.sessionid {
+		t.Fatal("Expected the session to be resumed with the same session id")
+	}
+
+	resumed.Close()
+	if body := poll(t, url+"?seq=4"); body != "" {
+		t.Fatalf("Expected a closed session not to be resumed but got %q", body)
+	}
+}
+
+func TestReplayEmptyMessage(t *testing.T) {
+	_, server, connected := testServer(t, func(config *Config) {
+		config.ReplayBufferSize = 100
+	})
+	url := server.URL + "/socket.io/xhr-polling"
+
+	poll(t, url)
+	c := <-connected
+	url += "/" + string(c.sessionid)
+
+	// the empty message is encoded to nothing, so it is not numbered
+	c.Send("")
+	c.Send("x")
+	waitRecorded(t, c, 1)
+
+	if body := poll(t, url+"?seq=0"); body != sio07Frame("3:::x") {
+		t.Fatalf("Expected the missed message once but got %q", body)
+	}
+
+	// the client has seen one message, i.e. "x"
+	c.Send("y")
+	waitRecorded(t, c, 2)
+	if body := poll(t, url+"?seq=1"); body != sio07Frame("3:::y") {
+		t.Fatalf("Expected only the new message but got %q", body)
+	}
+}
@@ -0,0 +1,119 @@
+package socketio
+
+import "sort"
+
+// Join adds the connection to the given room. Rooms are created on demand and
+// they cease to exist when the last member leaves. A connection is removed from
+// all of its rooms automatically when it gets disconnected. Joining a room the
+// connection is already a member of is a no-op.
+func (c *Conn) Join(room string) error {
+	c.sio.sessionsLock.Lock()
+	defer c.sio.sessionsLock.Unlock()
+
+	if c.sio.sessions[c.sessionid] != c {
+		return ErrNotConnected
+	}
+
+	members, ok := c.sio.rooms[room]
+	if !ok {
+		members = make(map[*Conn]bool)
+		c.sio.rooms[room] = members
+	}
+	members[c] = true
+
+	if c.rooms == nil {
+		c.rooms = make(map[string]bool)
+	}
+	c.rooms[room] = true
+
+	return nil
+}
+
+// Leave removes the connection from the given room. Leaving a room the
+// connection is not a member of is a no-op.
+func (c *Conn) Leave(room string) error {
+	c.sio.sessionsLock.Lock()
+	defer c.sio.sessionsLock.Unlock()
+
+	if c.sio.sessions[c.sessionid] != c {
+		return ErrNotConnected
+	}
+
+	c.sio.leave(c, room)
+	return nil
+}
+
+// Rooms returns the sorted names of the rooms the connection is a member of.
+func (c *Conn) Rooms() []string {
+	c.sio.sessionsLock.RLock()
+	defer c.sio.sessionsLock.RUnlock()
+
+	rooms := make([]string, 0, len(c.rooms))
+	for room := range c.rooms {
+		rooms = append(rooms, room)
+	}
+	sort.Strings(rooms)
+
+	return rooms
+}
+
+// BroadcastTo schedules data to be sent to each member of the room.
+func (sio *SocketIO) BroadcastTo(room string, data interface{}) {
+	sio.BroadcastToExcept(room, nil, data)
+}
+
+// BroadcastToExcept schedules data to be sent to each member of the room
+// except c. The data is treated the same way as in BroadcastExcept.
+func (sio *SocketIO) BroadcastToExcept(room string, c *Conn, data interface{}) {
+	sio.broadcast(&Broadcast{Room: room, Except: sessionIDOf(c), Data: data})
+}
+
+// Rooms returns the sorted names of the rooms that have at least one member.
+func (sio *SocketIO) Rooms() []string {
+	sio.sessionsLock.RLock()
+	defer sio.sessionsLock.RUnlock()
+
+	rooms := make([]string, 0, len(sio.rooms))
+	for room := range sio.rooms {
+		rooms = append(rooms, room)
+	}
+	sort.Strings(rooms)
+
+	return rooms
+}
+
+// RoomMembers returns the connections that are members of the room. The order
+// of the returned connections is unspecified.
+func (sio *SocketIO) RoomMembers(room string) []*Conn {
+	sio.sessionsLock.RLock()
+	defer sio.sessionsLock.RUnlock()
+
+	members := make([]*Conn, 0, len(sio.rooms[room]))
+	for c := range sio.rooms[room] {
+		members = append(members, c)
+	}
+
+	return members
+}
+
+// Leave removes c from the room and drops the room if it became empty.
+// The caller must hold sio.sessionsLock for writing.
+func (sio *SocketIO) leave(c *Conn, room string) {
+	if members, ok := sio.rooms[room]; ok {
+		delete(members, c)
+		if len(members) == 0 {
+			delete(sio.rooms, room)
+		}
+	}
+	if c.rooms != nil {
+		delete(c.rooms, room)
+	}
+}
+
+// LeaveAll removes c from every room it is a member of.
+// The caller must hold sio.sessionsLock for writing.
+func (sio *SocketIO) leaveAll(c *Conn) {
+	for room := range c.rooms {
+		sio.leave(c, room)
+	}
+}
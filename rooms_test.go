@@ -0,0 +1,68 @@
+package socketio
+
+import "testing"
+
+func connectedConn(t *testing.T, sio *SocketIO) *Conn {
+	c, err := newConn(sio)
+	if err != nil {
+		t.Fatal("newConn:", err)
+	}
+	sio.onConnect(c)
+	return c
+}
+
+func TestRooms(t *testing.T) {
+	config := DefaultConfig
+	config.Logger = NOPLogger
+	sio := NewSocketIO(&config)
+
+	a := connectedConn(t, sio)
+	b := connectedConn(t, sio)
+
+	if err := a.Join("lobby"); err != nil {
+		t.Fatal("Join:", err)
+	}
+	if err := a.Join("games"); err != nil {
+		t.Fatal("Join:", err)
+	}
+	if err := b.Join("lobby"); err != nil {
+		t.Fatal("Join:", err)
+	}
+
+	if rooms := sio.Rooms(); len(rooms) != 2 || rooms[0] != "games" || rooms[1] != "lobby" {
+		t.Fatalf("Expected rooms [games lobby] but got %v", rooms)
+	}
+	if members := sio.RoomMembers("lobby"); len(members) != 2 {
+		t.Fatalf("Expected 2 members in lobby but got %d", len(members))
+	}
+
+	sio.BroadcastTo("games", "hello")
+	if len(a.queue) != 1 || len(b.queue) != 0 {
+		t.Fatalf("Expected queue lengths 1 and 0 but got %d and %d", len(a.queue), len(b.queue))
+	}
+
+	sio.BroadcastToExcept("lobby", a, "hello")
+	if len(a.queue) != 1 || len(b.queue) != 1 {
+		t.Fatalf("Expected queue lengths 1 and 1 but got %d and %d", len(a.queue), len(b.queue))
+	}
+
+	if err := a.Leave("games"); err != nil {
+		t.Fatal("Leave:", err)
+	}
+	if rooms := a.Rooms(); len(rooms) != 1 || rooms[0] != "lobby" {
+		t.Fatalf("Expected rooms [lobby] but got %v", rooms)
+	}
+
+	sio.onDisconnect(b)
+	if members := sio.RoomMembers("lobby"); len(members) != 1 || members[0] != a {
+		t.Fatalf("Expected only a in lobby but got %v", members)
+	}
+	if err := b.Join("lobby"); err != ErrNotConnected {
+		t.Fatalf("Expected ErrNotConnected but got %v", err)
+	}
+
+	sio.onDisconnect(a)
+	if rooms := sio.Rooms(); len(rooms) != 0 {
+		t.Fatalf("Expected no rooms but got %v", rooms)
+	}
+}
@@ -1,9 +1,15 @@
 package socketio
 
 import (
-	"io"
 	"crypto/rand"
-	"os"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 // SessionID is just a string for now.
@@ -17,19 +23,200 @@ const (
 	SessionIDCharset = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
 )
 
-// NewSessionID creates a new ~random session id that is SessionIDLength long and
-// consists of random characters from the SessionIDCharset.
-func NewSessionID() (sid SessionID, err os.Error) {
-	b := make([]byte, SessionIDLength)
+// SessionIDGenerator generates the ids of the new sessions. It also validates
+// the session ids the clients present, so that the malformed ones are refused
+// before they are looked up. The ids must be usable in a URL path and must not
+// contain a "." or a ":", which separate the session tokens and the sequence
+// numbers from the ids.
+type SessionIDGenerator interface {
+	// NewSessionID returns a new unique session id.
+	NewSessionID() (SessionID, error)
+
+	// Valid reports whether sid is of the format of the generated ids.
+	Valid(sid SessionID) bool
+}
+
+// CharsetSessionIDGenerator generates random session ids of Length characters
+// from the Charset, which must have 1 to 256 ASCII characters, or NewSocketIO
+// panics and NewSessionID returns an error.
+type CharsetSessionIDGenerator struct {
+	Length  int
+	Charset string
+}
+
+// DefaultSessionIDGenerator generates the ids like NewSessionID.
+var DefaultSessionIDGenerator SessionIDGenerator = CharsetSessionIDGenerator{SessionIDLength, SessionIDCharset}
+
+// Validate checks that each character of the charset can be picked with a
+// single random byte and takes a single byte in the ids.
+func (g CharsetSessionIDGenerator) validate() error {
+	if len(g.Charset) == 0 || len(g.Charset) > 256 {
+		return fmt.Errorf("socketio: CharsetSessionIDGenerator charset has %d characters, must have 1 to 256", len(g.Charset))
+	}
+	for i := 0; i < len(g.Charset); i++ {
+		if g.Charset[i] >= utf8.RuneSelf {
+			return errors.New("socketio: CharsetSessionIDGenerator charset is not ASCII")
+		}
+	}
+	return nil
+}
+
+// NewSessionID picks each character uniformly from the charset. The random
+// bytes that would bias the pick towards the start of the charset, i.e. the
+// ones of the incomplete last round of the charset, are rejected.
+func (g CharsetSessionIDGenerator) NewSessionID() (SessionID, error) {
+	if err := g.validate(); err != nil {
+		return "", err
+	}
+
+	n := len(g.Charset)
+	limit := 256 - 256%n
+
+	b := make([]byte, g.Length)
+	buf := make([]byte, g.Length)
+	for i := 0; i < g.Length; {
+		if _, err := io.ReadFull(rand.Reader, buf); err != nil {
+			return "", err
+		}
+		for _, r := range buf {
+			if int(r) >= limit {
+				continue
+			}
+			b[i] = g.Charset[int(r)%n]
+			if i++; i == g.Length {
+				break
+			}
+		}
+	}
+
+	return SessionID(b), nil
+}
+
+func (g CharsetSessionIDGenerator) Valid(sid SessionID) bool {
+	if len(sid) != g.Length {
+		return false
+	}
+	for i := 0; i < len(sid); i++ {
+		if strings.IndexByte(g.Charset, sid[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// UUIDSessionIDGenerator generates random (version 4) UUIDs in their canonical
+// lower case form, e.g. 0b9e8d4e-5e6b-4f6e-8e2c-3c1f0d5a7b9c.
+type UUIDSessionIDGenerator struct{}
+
+func (UUIDSessionIDGenerator) NewSessionID() (SessionID, error) {
+	var u [16]byte
+	if _, err := io.ReadFull(rand.Reader, u[:]); err != nil {
+		return "", err
+	}
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+
+	b := make([]byte, 36)
+	hex.Encode(b[0:8], u[0:4])
+	b[8] = '-'
+	hex.Encode(b[9:13], u[4:6])
+	b[13] = '-'
+	hex.Encode(b[14:18], u[6:8])
+	b[18] = '-'
+	hex.Encode(b[19:23], u[8:10])
+	b[23] = '-'
+	hex.Encode(b[24:], u[10:])
+	return SessionID(b), nil
+}
+
+func (UUIDSessionIDGenerator) Valid(sid SessionID) bool {
+	if len(sid) != 36 || sid[14] != '4' || strings.IndexByte("89ab", sid[19]) < 0 {
+		return false
+	}
+	for i := 0; i < len(sid); i++ {
+		switch i {
+		case 8, 13, 18, 23:
+			if sid[i] != '-' {
+				return false
+			}
+		default:
+			if strings.IndexByte("0123456789abcdef", sid[i]) < 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// The Crockford's base32 alphabet of the ULIDs.
+const ulidCharset = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULIDSessionIDGenerator generates ULIDs, i.e. 26 characters of a 48-bit
+// millisecond timestamp followed by 80 random bits, which sort by the time of
+// the handshake, e.g. 01ARZ3NDEKTSV4RRFFQ69G5FAV.
+type ULIDSessionIDGenerator struct{}
+
+func (ULIDSessionIDGenerator) NewSessionID() (SessionID, error) {
+	var u [16]byte
+	binary.BigEndian.PutUint64(u[:8], uint64(time.Now().UnixMilli())<<16)
+	if _, err := io.ReadFull(rand.Reader, u[6:]); err != nil {
+		return "", err
+	}
+
+	// 128 bits as 26 characters of 5 bits, the first one having only 3
+	hi, lo := binary.BigEndian.Uint64(u[:8]), binary.BigEndian.Uint64(u[8:])
+	b := make([]byte, 26)
+	for i := 25; i >= 0; i-- {
+		b[i] = ulidCharset[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return SessionID(b), nil
+}
 
-	if _, err = io.ReadFull(rand.Reader, b); err != nil {
-		return
+func (ULIDSessionIDGenerator) Valid(sid SessionID) bool {
+	if len(sid) != 26 || sid[0] > '7' {
+		return false
+	}
+	for i := 0; i < len(sid); i++ {
+		if strings.IndexByte(ulidCharset, sid[i]) < 0 {
+			return false
+		}
 	}
+	return true
+}
 
-	for i := 0; i < SessionIDLength; i++ {
-		b[i] = SessionIDCharset[b[i]%uint8(len(SessionIDCharset))]
+// PrefixedSessionIDGenerator prefixes the ids of the Generator with the
+// Prefix and a "-", e.g. with the name of the node for a load balancer to
+// route the requests of a session to the node that has it.
+type PrefixedSessionIDGenerator struct {
+	Prefix    string
+	Generator SessionIDGenerator
+}
+
+// Validate checks the wrapped Generator, if it can be checked.
+func (g PrefixedSessionIDGenerator) validate() error {
+	if v, ok := g.Generator.(interface{ validate() error }); ok {
+		return v.validate()
 	}
+	return nil
+}
 
-	sid = SessionID(b)
-	return
+func (g PrefixedSessionIDGenerator) NewSessionID() (SessionID, error) {
+	sid, err := g.Generator.NewSessionID()
+	if err != nil {
+		return "", err
+	}
+	return SessionID(g.Prefix+"-") + sid, nil
+}
+
+func (g PrefixedSessionIDGenerator) Valid(sid SessionID) bool {
+	rest, ok := strings.CutPrefix(string(sid), g.Prefix+"-")
+	return ok && g.Generator.Valid(SessionID(rest))
+}
+
+// NewSessionID creates a new ~random session id that is SessionIDLength long and
+// consists of random characters from the SessionIDCharset.
+func NewSessionID() (sid SessionID, err error) {
+	return CharsetSessionIDGenerator{SessionIDLength, SessionIDCharset}.NewSessionID()
 }
@@ -0,0 +1,128 @@
+package socketio
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSessionIDGenerators(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		gen     SessionIDGenerator
+		invalid []SessionID
+	}{
+		{"default", DefaultSessionIDGenerator, []SessionID{"", "abc", "0123456789abcde-", "0123456789abcdef0"}},
+		{"uuid", UUIDSessionIDGenerator{}, []SessionID{"0b9e8d4e-5e6b-3f6e-8e2c-3c1f0d5a7b9c", "0B9E8D4E-5E6B-4F6E-8E2C-3C1F0D5A7B9C", "0b9e8d4e5e6b4f6e8e2c3c1f0d5a7b9c"}},
+		{"ulid", ULIDSessionIDGenerator{}, []SessionID{"81ARZ3NDEKTSV4RRFFQ69G5FAV", "01ARZ3NDEKTSV4RRFFQ69G5FAU", "01arz3ndektsv4rrffq69g5fav"}},
+		{"prefixed", PrefixedSessionIDGenerator{"node1", UUIDSessionIDGenerator{}}, []SessionID{"node2-0b9e8d4e-5e6b-4f6e-8e2c-3c1f0d5a7b9c", "0b9e8d4e-5e6b-4f6e-8e2c-3c1f0d5a7b9c"}},
+	} {
+		seen := make(map[SessionID]bool)
+		for i := 0; i < 100; i++ {
+			sid, err := tc.gen.NewSessionID()
+			if err != nil {
+				t.Fatalf("%s: NewSessionID: %v", tc.name, err)
+			}
+			if !tc.gen.Valid(sid) {
+				t.Fatalf("%s: expected %q to be valid", tc.name, sid)
+			}
+			if strings.ContainsAny(string(sid), ".:/") {
+				t.Fatalf("%s: expected %q to be usable in the URLs", tc.name, sid)
+			}
+			if seen[sid] {
+				t.Fatalf("%s: %q generated twice", tc.name, sid)
+			}
+			seen[sid] = true
+		}
+		for _, sid := range tc.invalid {
+			if tc.gen.Valid(sid) {
+				t.Errorf("%s: expected %q to be invalid", tc.name, sid)
+			}
+		}
+	}
+
+	if !(UUIDSessionIDGenerator{}).Valid("0b9e8d4e-5e6b-4f6e-8e2c-3c1f0d5a7b9c") || !(ULIDSessionIDGenerator{}).Valid("01ARZ3NDEKTSV4RRFFQ69G5FAV") {
+		t.Fatal("Expected the canonical examples to be valid")
+	}
+}
+
+func TestCharsetSessionIDGenerator(t *testing.T) {
+	// with the 96 printable characters, the random bytes 192-255 would pick
+	// the first 64 characters a third time, i.e. 1.5 times as often as the
+	// rest, unless they are rejected
+	charset := make([]byte, 96)
+	for i := range charset {
+		charset[i] = byte(32 + i)
+	}
+	gen := CharsetSessionIDGenerator{Length: 200000, Charset: string(charset)}
+	sid, err := gen.NewSessionID()
+	if err != nil {
+		t.Fatal("NewSessionID:", err)
+	}
+
+	var counts [256]int
+	for i := 0; i < len(sid); i++ {
+		counts[sid[i]]++
+	}
+	var head, tail int
+	for i, c := range charset {
+		if i < 64 {
+			head += counts[c]
+		} else {
+			tail += counts[c]
+		}
+	}
+
+	// about 2000 of each character
+	if ratio := float64(head) / 64 / (float64(tail) / 32); ratio < 0.9 || ratio > 1.1 {
+		t.Fatalf("Expected the characters to be picked uniformly but the first 64 were picked %.2f times as often", ratio)
+	}
+}
+
+func TestInvalidCharset(t *testing.T) {
+	for _, charset := range []string{"", strings.Repeat("a", 257), "abcé"} {
+		gen := CharsetSessionIDGenerator{Length: 16, Charset: charset}
+		if _, err := gen.NewSessionID(); err == nil {
+			t.Errorf("Expected NewSessionID to refuse the charset %q", charset)
+		}
+
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected NewSocketIO to refuse the charset %q", charset)
+				}
+			}()
+
+			config := DefaultConfig
+			config.Logger = NOPLogger
+			config.SessionIDGenerator = PrefixedSessionIDGenerator{"node1", gen}
+			NewSocketIO(&config)
+		}()
+	}
+}
+
+func TestMalformedSessionID(t *testing.T) {
+	_, server, connected := testServer(t, func(config *Config) {
+		config.SessionIDGenerator = PrefixedSessionIDGenerator{"node1", ULIDSessionIDGenerator{}}
+	})
+
+	poll(t, server.URL+"/socket.io/xhr-polling")
+	c := <-connected
+	if !strings.HasPrefix(string(c.sessionid), "node1-") {
+		t.Fatalf("Expected a prefixed session id but got %q", c.sessionid)
+	}
+
+	resp, err := http.Get(server.URL + "/socket.io/xhr-polling/" + strings.Repeat("x", 1000))
+	if err != nil {
+		t.Fatal("Get:", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected the malformed session id to be refused but got %d", resp.StatusCode)
+	}
+
+	c.Send("a")
+	if body := poll(t, server.URL+"/socket.io/xhr-polling/"+string(c.sessionid)); !strings.Contains(body, "3:::a") {
+		t.Fatalf("Expected the message to be polled but got %q", body)
+	}
+}
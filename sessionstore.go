@@ -0,0 +1,181 @@
+package socketio
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// SessionInfo describes a session in a SessionStore: the node that owns it and
+// when and from where it was established. Since the connection of a session
+// only lives in the process of its node, the stores keep these instead, so
+// that a store can be backed by e.g. a database shared by the nodes.
+type SessionInfo struct {
+	ID          SessionID
+	Node        string // The Config.NodeID of the server that owns the session.
+	NodeURL     string // The Config.NodeURL of the server, if any.
+	RemoteAddr  string
+	Established time.Time
+}
+
+// SessionStore maps session ids to the nodes that own them. It is consulted
+// whenever a request carries a session id, so a store shared by several
+// servers tells a server that the session belongs to another node, e.g. when
+// a load balancer routes a request to the wrong one, and the request is
+// forwarded to the node. The connections themselves only live in the server
+// that owns them, where SocketIO.GetConn returns them.
+//
+// Lookup returns the session of the session id and whether there is one.
+// Register stores a newly established session. Remove removes the session if it
+// is still owned by the node. Touch is invoked when a heartbeat arrives from
+// the client and it marks the session of the node alive.
+type SessionStore interface {
+	Lookup(SessionID) (SessionInfo, bool)
+	Register(SessionInfo) error
+	Remove(sid SessionID, node string)
+	Touch(sid SessionID, node string)
+}
+
+// MemorySessionStore is the default session store that keeps the sessions in a
+// map. It is safe for concurrent use.
+type MemorySessionStore struct {
+	mutex    sync.RWMutex
+	sessions map[SessionID]SessionInfo
+}
+
+// NewMemorySessionStore creates a new empty memory session store.
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: make(map[SessionID]SessionInfo)}
+}
+
+func (ms *MemorySessionStore) Lookup(sessionid SessionID) (SessionInfo, bool) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	info, ok := ms.sessions[sessionid]
+	return info, ok
+}
+
+func (ms *MemorySessionStore) Register(info SessionInfo) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	ms.sessions[info.ID] = info
+	return nil
+}
+
+func (ms *MemorySessionStore) Remove(sessionid SessionID, node string) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	if ms.sessions[sessionid].Node == node {
+		delete(ms.sessions, sessionid)
+	}
+}
+
+// Touch is a no-op, because the memory store never expires its sessions.
+func (ms *MemorySessionStore) Touch(sessionid SessionID, node string) {}
+
+// SharedSessionStore is an in-memory session store meant to be shared by
+// several servers in the same process. It simulates the external store of a
+// multi-node deployment: it only knows which node owns a session, so a request
+// for the session that arrives at another server is forwarded to the
+// Config.NodeURL of the node, or refused with 421 Misdirected Request. The
+// sessions that have not been touched within the ttl are considered to be lost
+// along with their node and they are not returned by Lookup anymore.
+type SharedSessionStore struct {
+	mutex    sync.Mutex
+	ttl      time.Duration
+	sessions map[SessionID]*sharedSession
+}
+
+type sharedSession struct {
+	info      SessionInfo
+	lastTouch time.Time
+}
+
+// NewSharedSessionStore creates a new empty shared session store with the
+// given ttl. A ttl of zero or less disables the expiration.
+func NewSharedSessionStore(ttl time.Duration) *SharedSessionStore {
+	return &SharedSessionStore{
+		ttl:      ttl,
+		sessions: make(map[SessionID]*sharedSession),
+	}
+}
+
+func (ss *SharedSessionStore) Lookup(sessionid SessionID) (SessionInfo, bool) {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+
+	s, ok := ss.sessions[sessionid]
+	if !ok {
+		return SessionInfo{}, false
+	}
+
+	if ss.ttl > 0 && time.Since(s.lastTouch) > ss.ttl {
+		delete(ss.sessions, sessionid)
+		return SessionInfo{}, false
+	}
+
+	return s.info, true
+}
+
+func (ss *SharedSessionStore) Register(info SessionInfo) error {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+
+	ss.sessions[info.ID] = &sharedSession{info, time.Now()}
+	return nil
+}
+
+func (ss *SharedSessionStore) Remove(sessionid SessionID, node string) {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+
+	if s, ok := ss.sessions[sessionid]; ok && s.info.Node == node {
+		delete(ss.sessions, sessionid)
+	}
+}
+
+func (ss *SharedSessionStore) Touch(sessionid SessionID, node string) {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+
+	if s, ok := ss.sessions[sessionid]; ok && s.info.Node == node {
+		s.lastTouch = time.Now()
+	}
+}
+
+// Forward passes a request for a session of another node to the NodeURL of the
+// node, or refuses it with 421 Misdirected Request if the node has none. The
+// node applies its own CORS policy, so the headers set by this server are
+// dropped.
+func (sio *SocketIO) forward(t Transport, w http.ResponseWriter, req *http.Request, info SessionInfo) {
+	target, err := url.Parse(info.NodeURL)
+	if info.NodeURL == "" || err != nil {
+		sio.log(LogInfo, "sio/handle: session of another node", "misdirected", LogKeySessionID, info.ID, LogKeyTransport, t.Resource(), LogKeyRemoteAddr, req.RemoteAddr, "node", info.Node)
+		sio.reject(t, w, http.StatusMisdirectedRequest)
+		return
+	}
+
+	sio.log(LogDebug, "sio/handle: forwarding to the node of the session", "forwarded", LogKeySessionID, info.ID, LogKeyTransport, t.Resource(), LogKeyRemoteAddr, req.RemoteAddr, "node", info.Node)
+	for header := range w.Header() {
+		delete(w.Header(), header)
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(target)
+			r.SetXForwarded()
+		},
+		// the streaming transports write their messages as they come
+		FlushInterval: -1,
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			sio.log(LogWarn, "sio/handle: unable to forward to the node of the session", "forward_failed", LogKeySessionID, info.ID, "node", info.Node, LogKeyError, err)
+			sio.reject(t, w, http.StatusBadGateway)
+		},
+	}
+	proxy.ServeHTTP(w, req)
+}
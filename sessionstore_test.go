@@ -0,0 +1,152 @@
+package socketio
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSharedSessionStore(t *testing.T) {
+	store := NewSharedSessionStore(50 * time.Millisecond)
+
+	config := DefaultConfig
+	config.Logger = NOPLogger
+	config.Codec = SIO07Codec{}
+	config.SessionStore = store
+	config.NodeID = "node1"
+	node1 := NewSocketIO(&config)
+	config.NodeID = "node2"
+	node2 := NewSocketIO(&config)
+
+	connected := make(chan *Conn, 1)
+	node1.OnConnect(func(c *Conn) {
+		connected <- c
+	})
+
+	server1 := httptest.NewServer(node1.ServeMux())
+	defer server1.Close()
+	server2 := httptest.NewServer(node2.ServeMux())
+	defer server2.Close()
+
+	poll(t, server1.URL+"/socket.io/xhr-polling")
+	c := <-connected
+	if info, ok := store.Lookup(c.sessionid); !ok || info.Node != "node1" || info.RemoteAddr != c.RemoteAddr() {
+		t.Fatalf("Expected the session to be owned by node1 but got %+v", info)
+	}
+	if node2.GetConn(c.sessionid) != nil {
+		t.Fatal("Did not expect the connection to be available on the other node")
+	}
+
+	status := func(url string) int {
+		resp, err := http.Get(url + "/socket.io/xhr-polling/" + string(c.sessionid))
+		if err != nil {
+			t.Fatal("Get:", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := status(server2.URL); code != http.StatusMisdirectedRequest {
+		t.Fatalf("Expected the other node to refuse the session with 421 but got %d", code)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	store.Touch(c.sessionid, "node2")
+	store.Touch(c.sessionid, "node1")
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := store.Lookup(c.sessionid); !ok {
+		t.Fatal("Expected the touched session to be alive")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if _, ok := store.Lookup(c.sessionid); ok {
+		t.Fatal("Expected the untouched session to expire")
+	}
+	if code := status(server2.URL); code != http.StatusBadRequest {
+		t.Fatalf("Expected the expired session to be unknown to the other node but got %d", code)
+	}
+
+	d := connectedConn(t, node2)
+	node1.store.Remove(d.sessionid, "node1")
+	if _, ok := store.Lookup(d.sessionid); !ok {
+		t.Fatal("Expected only the owner to remove the session")
+	}
+	node2.onDisconnect(d)
+	if _, ok := store.Lookup(d.sessionid); ok {
+		t.Fatal("Expected the disconnected session to be removed")
+	}
+}
+
+func TestDefaultSessionStore(t *testing.T) {
+	config := DefaultConfig
+	config.Logger = NOPLogger
+	node1 := NewSocketIO(&config)
+	node2 := NewSocketIO(&config)
+
+	c := connectedConn(t, node1)
+	if node1.GetConn(c.sessionid) != c {
+		t.Fatal("Expected the session to be found")
+	}
+	if _, ok := node2.store.Lookup(c.sessionid); ok || node2.GetConn(c.sessionid) != nil {
+		t.Fatal("Did not expect the servers to share the default store")
+	}
+
+	node1.onDisconnect(c)
+	if _, ok := node1.store.Lookup(c.sessionid); ok || node1.GetConn(c.sessionid) != nil {
+		t.Fatal("Expected the disconnected session to be removed")
+	}
+}
+
+func TestSessionStoreForward(t *testing.T) {
+	store := NewSharedSessionStore(0)
+
+	config := DefaultConfig
+	config.Logger = NOPLogger
+	config.Codec = SIO07Codec{}
+	config.SessionStore = store
+	config.NodeID = "node1"
+	node1 := NewSocketIO(&config)
+	config.NodeID = "node2"
+	node2 := NewSocketIO(&config)
+
+	connected := make(chan *Conn, 1)
+	node1.OnConnect(func(c *Conn) {
+		connected <- c
+	})
+	received := make(chan string, 1)
+	node1.OnMessage(func(c *Conn, msg Message) {
+		received <- msg.Data()
+	})
+
+	server1 := httptest.NewServer(node1.ServeMux())
+	defer server1.Close()
+	server2 := httptest.NewServer(node2.ServeMux())
+	defer server2.Close()
+	node1.config.NodeURL = server1.URL
+
+	poll(t, server1.URL+"/socket.io/xhr-polling")
+	c := <-connected
+	resource := server2.URL + "/socket.io/xhr-polling/" + string(c.sessionid)
+
+	// the requests that land on node2 reach the session on node1
+	c.Send("a")
+	if body := poll(t, resource); !strings.Contains(body, "3:::a") {
+		t.Fatalf("Expected the message to be polled through node2 but got %q", body)
+	}
+	resp, err := http.PostForm(resource, url.Values{"data": {sio07Frame("3:::b")}})
+	if err != nil {
+		t.Fatal("PostForm:", err)
+	}
+	resp.Body.Close()
+	if got := <-received; got != "b" {
+		t.Fatalf("Expected the message to be posted through node2 but got %q", got)
+	}
+
+	// the store decides who owns the session
+	store.Register(SessionInfo{ID: c.sessionid, Node: "node2"})
+	if node1.GetConn(c.sessionid) != nil {
+		t.Fatal("Did not expect the connection of a session owned by another node")
+	}
+}
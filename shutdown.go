@@ -0,0 +1,106 @@
+package socketio
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrShutdown is returned when the server is shutting down.
+var ErrShutdown = errors.New("server is shutting down")
+
+// The interval between the checks of the send queues while draining.
+const shutdownPollInterval = 10 * time.Millisecond
+
+// Shutdown gracefully shuts down the server. It stops accepting new sessions,
+// closes the flash policy listener and sends a disconnect message to every
+// connection. It then waits for the send queues of the connections to drain,
+// closes the connections and waits for their goroutines to exit. If ctx is
+// done before that, the remaining connections are closed right away and the
+// error of ctx is returned. The replay buffers retained for a resume are left
+// in the ReplayStorage, but they are no longer discarded after the
+// Config.ReplayRetention.
+func (sio *SocketIO) Shutdown(ctx context.Context) error {
+	sio.shutdownLock.Lock()
+	if sio.shuttingDown {
+		sio.shutdownLock.Unlock()
+		return ErrShutdown
+	}
+	sio.shuttingDown = true
+	listener := sio.policyListener
+	sio.policyListener = nil
+	sio.shutdownLock.Unlock()
+
+	if listener != nil {
+		listener.Close()
+	}
+
+	sio.sessionsLock.RLock()
+	conns := make([]*Conn, 0, len(sio.sessions))
+	for _, c := range sio.sessions {
+		conns = append(conns, c)
+	}
+	sio.sessionsLock.RUnlock()
+
+	for _, c := range conns {
+		c.Send(disconnect(0))
+	}
+
+	var err error
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+
+Drain:
+	for _, c := range conns {
+		for !c.drained() {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				err = ctx.Err()
+				break Drain
+			}
+		}
+	}
+
+	for _, c := range conns {
+		c.Close()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		sio.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	sio.stopRetention()
+	return err
+}
+
+// Track adds n goroutines of a new connection to sio.wg unless Shutdown has
+// been invoked, in which case it returns false. The goroutines are added under
+// shutdownLock, so that they are either waited for by Shutdown or never
+// started.
+func (sio *SocketIO) track(n int) bool {
+	sio.shutdownLock.Lock()
+	defer sio.shutdownLock.Unlock()
+
+	if sio.shuttingDown {
+		return false
+	}
+	sio.wg.Add(n)
+	return true
+}
+
+// IsShuttingDown reports whether Shutdown has been invoked.
+func (sio *SocketIO) isShuttingDown() bool {
+	sio.shutdownLock.Lock()
+	defer sio.shutdownLock.Unlock()
+
+	return sio.shuttingDown
+}
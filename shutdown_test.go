@@ -0,0 +1,131 @@
+package socketio
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestShutdown(t *testing.T) {
+	config := DefaultConfig
+	config.Logger = NOPLogger
+	config.Codec = SIO07Codec{}
+	sio := NewSocketIO(&config)
+
+	var disconnected int
+	sio.OnDisconnect(func(c *Conn) {
+		disconnected++
+	})
+
+	a := connectedConn(t, sio)
+	b := connectedConn(t, sio)
+
+	// nothing flushes the queues, so the draining must time out
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := sio.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	if disconnected != 2 || sio.GetConn(a.sessionid) != nil || sio.GetConn(b.sessionid) != nil {
+		t.Fatal("Expected the connections to be closed")
+	}
+	if err := a.Send("late"); err != ErrDestroyed {
+		t.Fatalf("Expected ErrDestroyed, got %v", err)
+	}
+
+	if err := sio.Shutdown(context.Background()); err != ErrShutdown {
+		t.Fatalf("Expected ErrShutdown, got %v", err)
+	}
+
+	req, err := http.NewRequest("GET", "http://localhost/socket.io/xhr-polling", nil)
+	if err != nil {
+		t.Fatal("NewRequest:", err)
+	}
+	w := httptest.NewRecorder()
+	sio.handle(sio.config.Transports[0], w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected a new session to be refused, got %d", w.Code)
+	}
+}
+
+func TestShutdownIdle(t *testing.T) {
+	config := DefaultConfig
+	config.Logger = NOPLogger
+	sio := NewSocketIO(&config)
+
+	if err := sio.Shutdown(context.Background()); err != nil {
+		t.Fatal("Shutdown:", err)
+	}
+}
+
+func TestShutdownDuringHandshake(t *testing.T) {
+	metrics := NewMemoryMetrics()
+	sio, server, _ := testServer(t, func(config *Config) {
+		config.Metrics = metrics
+	})
+
+	// the handshake gets past the check of handle before Shutdown
+	authorizing, release := make(chan bool), make(chan bool)
+	sio.SetAuthorizer(func(*HandshakeData) (interface{}, error) {
+		authorizing <- true
+		<-release
+		return nil, nil
+	})
+	sio.OnConnect(func(c *Conn) {
+		t.Error("Expected the session not to be established")
+	})
+
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		resp, err := http.Get(server.URL + "/socket.io/xhr-polling")
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	<-authorizing
+	if err := sio.Shutdown(context.Background()); err != nil {
+		t.Fatal("Shutdown:", err)
+	}
+	close(release)
+	<-done
+
+	sio.sessionsLock.RLock()
+	n := len(sio.sessions)
+	sio.sessionsLock.RUnlock()
+	if n != 0 {
+		t.Fatalf("Expected no sessions but got %d", n)
+	}
+	sio.wg.Wait()
+
+	metrics.mutex.Lock()
+	active := metrics.socketsActive[labels("transport", "xhr-polling")]
+	metrics.mutex.Unlock()
+	if active != 0 {
+		t.Fatalf("Expected no active sockets but got %d", active)
+	}
+}
+
+func TestShutdownReplayRetention(t *testing.T) {
+	config := DefaultConfig
+	config.Logger = NOPLogger
+	config.ReplayBufferSize = 10
+	config.ReplayRetention = time.Minute
+	sio := NewSocketIO(&config)
+
+	sio.releaseReplay("a", DisconnectReasonReconnectTimeout)
+	if err := sio.Shutdown(context.Background()); err != nil {
+		t.Fatal("Shutdown:", err)
+	}
+	sio.releaseReplay("b", DisconnectReasonReconnectTimeout)
+
+	sio.replayLock.Lock()
+	n := len(sio.retained)
+	sio.replayLock.Unlock()
+	if n != 0 {
+		t.Fatalf("Expected the retention timers to be stopped but got %d", n)
+	}
+}
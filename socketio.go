@@ -2,55 +2,140 @@ package socketio
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
-	"http"
 	"io"
 	"net"
-	"os"
+	"net/http"
+	"reflect"
 	"strings"
 	"sync"
-	"url"
+	"time"
 )
 
 // SocketIO handles transport abstraction and provide the user
 // a handfull of callbacks to observe different events.
 type SocketIO struct {
-	sessions        map[SessionID]*Conn // Holds the outstanding sessions.
-	sessionsLock    *sync.RWMutex       // Protects the sessions.
-	config          Config              // Holds the configuration values.
+	sessions        map[SessionID]*Conn       // Holds the outstanding sessions of this server.
+	sessionsLock    *sync.RWMutex             // Protects the sessions and the rooms.
+	store           SessionStore              // Maps the session ids to their nodes.
+	node            string                    // The name of the server in the store.
+	sessionIDs      SessionIDGenerator        // Generates and validates the session ids.
+	adapter         Adapter                   // Delivers the broadcasts.
+	metrics         Metrics                   // Records the instrumentation.
+	rooms           map[string]map[*Conn]bool // Holds the members of each room.
+	config          Config                    // Holds the configuration values.
 	serveMux        *ServeMux
 	transportLookup map[string]Transport
 
 	// The callbacks set by the user
 	callbacks struct {
-		onConnect    func(*Conn)              // Invoked on new connection.
-		onDisconnect func(*Conn)              // Invoked on a lost connection.
-		onMessage    func(*Conn, Message)     // Invoked on a message.
-		isAuthorized func(*http.Request) bool // Auth test during new http request
+		endpointCallbacks
+		isAuthorized        func(*http.Request) bool         // Auth test during new http request
+		authorizer          Authorizer                       // Auth test during a handshake.
+		onConnectionRefused func(*http.Request, error)       // Invoked on a connection refused by the limits.
+		onLimitExceeded     func(*Conn, error)               // Invoked on a connection exceeding the inbound limits.
+		onMessageDropped    func(*Conn, interface{}, string) // Invoked on a message dropped from a full queue.
 	}
+
+	namespaces map[string]*Namespace // Holds the namespaces, protected by sessionsLock.
+
+	shutdownLock   sync.Mutex     // Protects shuttingDown and policyListener.
+	shuttingDown   bool           // Indicates if Shutdown has been invoked.
+	policyListener net.Listener   // The listener of ListenAndServeFlashPolicy, if any.
+	wg             sync.WaitGroup // Tracks the per-connection goroutines.
+
+	replay     ReplayStorage             // Keeps the sent messages for a replay, if enabled.
+	replayLock sync.Mutex                // Protects retained.
+	retained   map[SessionID]*time.Timer // Discards the retained replay buffers.
+
+	anchored sync.Map // Holds the anchored regexps of the OriginRules.
+
+	limitLock sync.Mutex     // Protects numConns, ipConns and the admitted flags.
+	numConns  int            // The number of admitted connections.
+	ipConns   map[string]int // The number of admitted connections by remote IP.
+}
+
+// EndpointCallbacks holds the callbacks of an endpoint, i.e. the server
+// itself or one of its namespaces.
+type endpointCallbacks struct {
+	onConnect      func(*Conn)                            // Invoked on new connection.
+	onDisconnect   func(*Conn)                            // Invoked on a lost connection.
+	onMessage      func(*Conn, Message)                   // Invoked on a message.
+	onEvent        map[string]reflect.Value               // Invoked on a named event.
+	onUnknownEvent func(*Conn, string, []json.RawMessage) // Invoked on an event without a handler.
 }
 
 // NewSocketIO creates a new socketio server with chosen transports and configuration
 // options. If transports is nil, the DefaultTransports is used. If config is nil, the
-// DefaultConfig is used.
+// DefaultConfig is used. It panics if the Config.SessionTokens have no usable key,
+// since the sessions could not be protected as configured, or if the
+// Config.SessionIDGenerator has an unusable charset.
 func NewSocketIO(config *Config) *SocketIO {
 	if config == nil {
 		config = &DefaultConfig
 	}
 
+	if config.SessionTokens != nil {
+		if err := config.SessionTokens.validate(); err != nil {
+			panic(err)
+		}
+	}
+
+	if v, ok := config.SessionIDGenerator.(interface{ validate() error }); ok {
+		if err := v.validate(); err != nil {
+			panic(err)
+		}
+	}
+
 	sio := &SocketIO{
 		config:          *config,
 		sessions:        make(map[SessionID]*Conn),
+		rooms:           make(map[string]map[*Conn]bool),
+		namespaces:      make(map[string]*Namespace),
+		ipConns:         make(map[string]int),
+		retained:        make(map[SessionID]*time.Timer),
 		sessionsLock:    new(sync.RWMutex),
 		transportLookup: make(map[string]Transport),
 	}
 
+	if sio.store = sio.config.SessionStore; sio.store == nil {
+		sio.store = NewMemorySessionStore()
+	}
+
+	if sio.node = sio.config.NodeID; sio.node == "" {
+		node, err := NewSessionID()
+		if err != nil {
+			sio.log(LogError, "sio/NewSocketIO: unable to generate a node id", "node_id", LogKeyError, err)
+		}
+		sio.node = string(node)
+	}
+
+	if sio.sessionIDs = sio.config.SessionIDGenerator; sio.sessionIDs == nil {
+		sio.sessionIDs = DefaultSessionIDGenerator
+	}
+
+	if sio.metrics = sio.config.Metrics; sio.metrics == nil {
+		sio.metrics = nopMetrics{}
+	}
+
+	if sio.replay = sio.config.ReplayStorage; sio.replay == nil && sio.config.ReplayBufferSize > 0 {
+		sio.replay = NewMemoryReplayStorage(sio.config.ReplayBufferSize)
+	}
+
 	for _, t := range sio.config.Transports {
 		sio.transportLookup[t.Resource()] = t
 	}
 
 	sio.serveMux = NewServeMux(sio)
 
+	if sio.adapter = sio.config.Adapter; sio.adapter == nil {
+		sio.adapter = new(LocalAdapter)
+	}
+	if err := sio.adapter.Init(sio); err != nil {
+		sio.log(LogError, "sio/NewSocketIO: unable to initialize the adapter", "adapter_init", LogKeyError, err)
+	}
+
 	return sio
 }
 
@@ -61,24 +146,31 @@ func (sio *SocketIO) Broadcast(data interface{}) {
 
 // BroadcastExcept schedules data to be sent to each connection except
 // c. It does not care about the type of data, but it must marshallable
-// by the standard json-package.
+// by the standard json-package. The broadcast goes through the adapter.
 func (sio *SocketIO) BroadcastExcept(c *Conn, data interface{}) {
-	sio.sessionsLock.RLock()
-	defer sio.sessionsLock.RUnlock()
+	sio.broadcast(&Broadcast{Except: sessionIDOf(c), Data: data})
+}
 
-	for _, v := range sio.sessions {
-		if v != c {
-			v.Send(data)
-		}
-	}
+// GetConn returns the connection of the session with sessionid, or nil if the
+// session is not owned by this server according to the SessionStore.
+func (sio *SocketIO) GetConn(sessionid SessionID) *Conn {
+	c, _, _ := sio.lookup(sessionid)
+	return c
 }
 
-// GetConn digs for a session with sessionid and returns it.
-func (sio *SocketIO) GetConn(sessionid SessionID) (c *Conn) {
+// Lookup looks up the session with sessionid from the SessionStore. It returns
+// the connection of the session if this server owns it, or the session of
+// another node and true. A session the store does not know is looked up from
+// the sessions of this server only, since a store may expire the sessions.
+func (sio *SocketIO) lookup(sessionid SessionID) (*Conn, SessionInfo, bool) {
+	if info, ok := sio.store.Lookup(sessionid); ok && info.Node != sio.node {
+		return nil, info, true
+	}
+
 	sio.sessionsLock.RLock()
-	c = sio.sessions[sessionid]
-	sio.sessionsLock.RUnlock()
-	return
+	defer sio.sessionsLock.RUnlock()
+
+	return sio.sessions[sessionid], SessionInfo{}, false
 }
 
 // Mux maps resources to the http.ServeMux mux under the resource given.
@@ -91,7 +183,7 @@ func (sio *SocketIO) ServeMux() *ServeMux {
 
 // OnConnect sets f to be invoked when a new session is established. It passes
 // the established connection as an argument to the callback.
-func (sio *SocketIO) OnConnect(f func(*Conn)) os.Error {
+func (sio *SocketIO) OnConnect(f func(*Conn)) error {
 	sio.callbacks.onConnect = f
 	return nil
 }
@@ -99,7 +191,7 @@ func (sio *SocketIO) OnConnect(f func(*Conn)) os.Error {
 // OnDisconnect sets f to be invoked when a session is considered to be lost. It passes
 // the established connection as an argument to the callback. After disconnection
 // the connection is considered to be destroyed, and it should not be used anymore.
-func (sio *SocketIO) OnDisconnect(f func(*Conn)) os.Error {
+func (sio *SocketIO) OnDisconnect(f func(*Conn)) error {
 	sio.callbacks.onDisconnect = f
 	return nil
 }
@@ -107,7 +199,7 @@ func (sio *SocketIO) OnDisconnect(f func(*Conn)) os.Error {
 // OnMessage sets f to be invoked when a message arrives. It passes
 // the established connection along with the received message as arguments
 // to the callback.
-func (sio *SocketIO) OnMessage(f func(*Conn, Message)) os.Error {
+func (sio *SocketIO) OnMessage(f func(*Conn, Message)) error {
 	sio.callbacks.onMessage = f
 	return nil
 }
@@ -116,20 +208,25 @@ func (sio *SocketIO) OnMessage(f func(*Conn, Message)) os.Error {
 // the http.Request as an argument to the callback.
 // The callback should return true if the connection is authorized or false if it
 // should be dropped. Not setting this callback results in a default pass-through.
-func (sio *SocketIO) SetAuthorization(f func(*http.Request) bool) os.Error {
+// See SetAuthorizer for authorizing the sessions instead of the requests.
+func (sio *SocketIO) SetAuthorization(f func(*http.Request) bool) error {
 	sio.callbacks.isAuthorized = f
 	return nil
 }
 
+// Log passes the operands, formatted like with fmt.Sprint, to the configured
+// Logger as a LogInfo event.
 func (sio *SocketIO) Log(v ...interface{}) {
 	if sio.config.Logger != nil {
-		sio.config.Logger.Println(v...)
+		sio.config.Logger.Log(LogInfo, strings.TrimSuffix(fmt.Sprintln(v...), "\n"))
 	}
 }
 
+// Logf passes the operands, formatted like with fmt.Sprintf, to the configured
+// Logger as a LogInfo event.
 func (sio *SocketIO) Logf(format string, v ...interface{}) {
 	if sio.config.Logger != nil {
-		sio.config.Logger.Printf(format, v...)
+		sio.config.Logger.Log(LogInfo, fmt.Sprintf(format, v...))
 	}
 }
 
@@ -139,30 +236,34 @@ func (sio *SocketIO) Logf(format string, v ...interface{}) {
 // The URL and method must be one of the following:
 //
 // OPTIONS *
-//     GET resource
-//     GET resource/sessionid
-//    POST resource/sessionid
+//
+//	 GET resource
+//	 GET resource/sessionid
+//	POST resource/sessionid
+//
+// A GET without the sessionid is mapped to the session named in the
+// Last-Event-ID header, if there is one.
 func (sio *SocketIO) handle(t Transport, w http.ResponseWriter, req *http.Request) {
 	var parts []string
 	var c *Conn
-	var err os.Error
+	var err error
 
 	if !sio.isAuthorized(req) {
-		sio.Log("sio/handle: unauthorized request:", req)
-		w.WriteHeader(http.StatusUnauthorized)
+		sio.log(LogWarn, "sio/handle: unauthorized request", "unauthorized", LogKeyTransport, t.Resource(), LogKeyRemoteAddr, req.RemoteAddr, "url", req.URL)
+		sio.reject(t, w, http.StatusUnauthorized)
 		return
 	}
 
 	if origin := req.Header.Get("Origin"); origin != "" {
-		if _, ok := sio.verifyOrigin(origin); !ok {
-			sio.Log("sio/handle: unauthorized origin:", origin)
-			w.WriteHeader(http.StatusUnauthorized)
+		policy, ok := sio.verifyOrigin(origin, req)
+		if !ok {
+			sio.log(LogWarn, "sio/handle: unauthorized origin", "unauthorized_origin", LogKeyTransport, t.Resource(), LogKeyRemoteAddr, req.RemoteAddr, "origin", origin)
+			sio.reject(t, w, http.StatusForbidden)
 			return
 		}
 
-		w.Header().Set("Access-Control-Allow-Origin", origin)
-		w.Header().Set("Access-Control-Allow-Credentials", "true")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, GET")
+		// the hijacking transports write these headers too
+		policy.apply(w.Header(), origin, req)
 	}
 
 	switch req.Method {
@@ -174,7 +275,8 @@ func (sio *SocketIO) handle(t Transport, w http.ResponseWriter, req *http.Reques
 		break
 
 	default:
-		w.WriteHeader(http.StatusUnauthorized)
+		w.Header().Set("Allow", "GET, POST, OPTIONS")
+		sio.reject(t, w, http.StatusMethodNotAllowed)
 		return
 	}
 
@@ -188,62 +290,188 @@ func (sio *SocketIO) handle(t Transport, w http.ResponseWriter, req *http.Reques
 		parts = strings.Split(req.URL.Path[i:pathLen], "/")
 	}
 
-	if len(parts) < 2 || parts[1] == "" {
+	var sessionid, resumed SessionID
+	var token string
+	if len(parts) >= 2 {
+		sessionid = SessionID(parts[1])
+	}
+	if sessionid == "" {
+		// a reconnecting EventSource repeats the url of the first request
+		sessionid, _ = lastEventID(req)
+	}
+	if sessionid != "" && sio.config.SessionTokens != nil {
+		sessionid, token = splitSessionToken(sessionid)
+	}
+	if sessionid != "" && !sio.sessionIDs.Valid(sessionid) {
+		sio.log(LogWarn, "sio/handle: malformed session id", "malformed_session_id", LogKeyTransport, t.Resource(), LogKeyRemoteAddr, req.RemoteAddr, "url", req.URL)
+		sio.reject(t, w, http.StatusBadRequest)
+		return
+	}
+
+	if sessionid != "" {
+		var info SessionInfo
+		var misdirected bool
+		if c, info, misdirected = sio.lookup(sessionid); misdirected {
+			sio.forward(t, w, req, info)
+			return
+		}
+		if c == nil && sio.resumable(sessionid, req) {
+			resumed = sessionid
+		}
+	}
+
+	// the token of a resumed session is verified once it has an identity
+	if c != nil {
+		if err = sio.verifySessionToken(sessionid, token, req, c.Identity()); err != nil {
+			sio.rejectSessionToken(t, w, req, sessionid, err)
+			return
+		}
+	}
+
+	if sessionid == "" || resumed != "" {
+		if sio.isShuttingDown() {
+			sio.reject(t, w, http.StatusServiceUnavailable)
+			return
+		}
+
+		data, identity, ok := sio.authorize(t, w, req)
+		if !ok {
+			return
+		}
+
+		if resumed != "" {
+			if err = sio.verifySessionToken(resumed, token, req, identity); err != nil {
+				sio.rejectSessionToken(t, w, req, resumed, err)
+				return
+			}
+		}
+
+		ip, err := sio.admit(req)
+		if err != nil {
+			sio.refuse(t, w, req, err)
+			return
+		}
+
 		c, err = newConn(sio)
 		if err != nil {
-			sio.Log("sio/handle: unable to create a new connection:", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			sio.unreserve(ip)
+			sio.log(LogError, "sio/handle: unable to create a new connection", "new_conn", LogKeyTransport, t.Resource(), LogKeyRemoteAddr, req.RemoteAddr, LogKeyError, err)
+			sio.reject(t, w, http.StatusInternalServerError)
 			return
 		}
-	} else {
-		c = sio.GetConn(SessionID(parts[1]))
+		c.handshakeData, c.identity = data, identity
+		sio.bind(c, ip)
+
+		if resumed != "" {
+			sio.resume(c, resumed)
+			c.token = token
+		} else {
+			c.token = sio.signSessionToken(c.sessionid, req, identity)
+		}
+
+		// give the slot back if the connection never gets established
+		defer func() {
+			c.mutex.Lock()
+			handshaked := c.handshaked
+			c.mutex.Unlock()
+
+			if !handshaked {
+				sio.release(c)
+			}
+		}()
 	}
 
 	// we should now have a connection
 	if c == nil {
-		sio.Log("sio/handle: unable to map request to connection:", req.RawURL)
-		w.WriteHeader(http.StatusBadRequest)
+		sio.log(LogWarn, "sio/handle: unable to map request to connection", "unknown_session", LogKeyTransport, t.Resource(), LogKeyRemoteAddr, req.RemoteAddr, "url", req.URL)
+		sio.reject(t, w, http.StatusBadRequest)
 		return
 	}
 
 	// pass the http conn/req pair to the connection
 	if err = c.handle(t, w, req); err != nil {
-		sio.Logf("sio/handle: conn/handle: %s: %s", c, err)
-		w.WriteHeader(http.StatusUnauthorized)
+		c.log(LogWarn, "sio/handle: unable to handle the request", "handle", LogKeyError, err)
+		switch err {
+		case ErrBufferOverflow:
+			sio.reject(t, w, http.StatusRequestEntityTooLarge)
+		case errWebsocketVersion:
+			w.Header().Set("Sec-WebSocket-Version", "13")
+			sio.reject(t, w, http.StatusBadRequest)
+		default:
+			sio.reject(t, w, http.StatusBadRequest)
+		}
 	}
 }
 
+// Reject answers a request with the error status and records it.
+func (sio *SocketIO) reject(t Transport, w http.ResponseWriter, status int) {
+	sio.metrics.RequestRejected(t.Resource(), status)
+	w.WriteHeader(status)
+}
+
 // OnConnect is invoked by a connection when a new connection has been
 // established succesfully. The establised connection is passed as an
-// argument. It stores the connection and calls the user's OnConnect callback.
+// argument. It stores the connection, registers it to the session store and
+// calls the user's OnConnect callback.
 func (sio *SocketIO) onConnect(c *Conn) {
 	sio.sessionsLock.Lock()
 	sio.sessions[c.sessionid] = c
 	sio.sessionsLock.Unlock()
 
+	sio.metrics.SessionOpened()
+
+	if err := sio.store.Register(SessionInfo{c.sessionid, sio.node, sio.config.NodeURL, c.RemoteAddr(), time.Now()}); err != nil {
+		c.log(LogError, "sio/onConnect: unable to register the session", "register", LogKeyError, err)
+	}
+
 	if sio.callbacks.onConnect != nil {
 		sio.callbacks.onConnect(c)
 	}
+
+	// Shutdown may have taken its snapshot of the sessions before c was
+	// registered, in which case it does not close c
+	if sio.isShuttingDown() {
+		c.Close()
+	}
 }
 
 // OnDisconnect is invoked by a connection when the connection is considered
-// to be lost. It removes the connection and calls the user's OnDisconnect callback.
+// to be lost. It removes the connection from the sessions, the session store and
+// from all of its rooms and namespaces. Finally it calls the OnDisconnect
+// callbacks of the namespaces and the user's OnDisconnect callback.
 func (sio *SocketIO) onDisconnect(c *Conn) {
 	sio.sessionsLock.Lock()
-	sio.sessions[c.sessionid] = nil, false
+	delete(sio.sessions, c.sessionid)
+	sio.leaveAll(c)
+	namespaces := sio.leaveNamespaces(c)
 	sio.sessionsLock.Unlock()
 
+	sio.store.Remove(c.sessionid, sio.node)
+	sio.release(c)
+
+	for _, ns := range namespaces {
+		if ns.callbacks.onDisconnect != nil {
+			ns.callbacks.onDisconnect(c)
+		}
+	}
+
 	if sio.callbacks.onDisconnect != nil {
 		sio.callbacks.onDisconnect(c)
 	}
 }
 
-// OnMessage is invoked by a connection when a new message arrives. It passes
-// this message to the user's OnMessage callback.
+// OnMessage is invoked by a connection when a new message arrives. It routes
+// the messages of the namespaces to their callbacks, dispatches events to their
+// handlers and passes the other messages to the user's OnMessage callback.
 func (sio *SocketIO) onMessage(c *Conn, msg Message) {
-	if sio.callbacks.onMessage != nil {
-		sio.callbacks.onMessage(c, msg)
+	if sio.supportsPackets() {
+		if endpoint, ok := msg.Annotation(SIO07AnnotationEndpoint); ok {
+			sio.onEndpointMessage(c, endpoint, msg)
+			return
+		}
 	}
+
+	sio.dispatch(&sio.callbacks.endpointCallbacks, c, msg)
 }
 
 // isAuthorized is called during the handle() of any new http request
@@ -257,45 +485,6 @@ func (sio *SocketIO) isAuthorized(req *http.Request) bool {
 	return true
 }
 
-func (sio *SocketIO) verifyOrigin(reqOrigin string) (string, bool) {
-	if sio.config.Origins == nil {
-		return "", false
-	}
-
-	u, err := url.Parse(reqOrigin)
-	if err != nil || u.Host == "" {
-		return "", false
-	}
-
-	host := strings.SplitN(u.Host, ":", 2)
-
-	for _, o := range sio.config.Origins {
-		origin := strings.SplitN(o, ":", 2)
-		if origin[0] == "*" || origin[0] == host[0] {
-			if len(origin) < 2 || origin[1] == "*" {
-				return o, true
-			}
-			if len(host) < 2 {
-				switch u.Scheme {
-				case "http", "ws":
-					if origin[1] == "80" {
-						return o, true
-					}
-
-				case "https", "wss":
-					if origin[1] == "443" {
-						return o, true
-					}
-				}
-			} else if origin[1] == host[1] {
-				return o, true
-			}
-		}
-	}
-
-	return "", false
-}
-
 func (sio *SocketIO) generatePolicyFile() []byte {
 	buf := new(bytes.Buffer)
 	buf.WriteString(`<?xml version="1.0"?>
@@ -304,29 +493,32 @@ func (sio *SocketIO) generatePolicyFile() []byte {
 	<site-control permitted-cross-domain-policies="master-only" />
 `)
 
-	if sio.config.Origins != nil {
-		for _, origin := range sio.config.Origins {
-			parts := strings.SplitN(origin, ":", 2)
-			if len(parts) < 1 {
-				continue
-			}
-			host, port := "*", "*"
-			if parts[0] != "" {
-				host = parts[0]
-			}
-			if len(parts) == 2 && parts[1] != "" {
-				port = parts[1]
-			}
+	// the regexp and callback rules can not be expressed in a policy file
+	for _, r := range sio.originRules() {
+		if r.Pattern == "" {
+			continue
+		}
 
-			fmt.Fprintf(buf, "\t<allow-access-from domain=\"%s\" to-ports=\"%s\" />\n", host, port)
+		_, hostport, ok := strings.Cut(r.Pattern, "://")
+		if !ok {
+			hostport = r.Pattern
+		}
+		host, port, _ := strings.Cut(hostport, ":")
+		if host == "" {
+			host = "*"
 		}
+		if port == "" {
+			port = "*"
+		}
+
+		fmt.Fprintf(buf, "\t<allow-access-from domain=\"%s\" to-ports=\"%s\" />\n", host, port)
 	}
 
 	buf.WriteString("</cross-domain-policy>\n")
 	return buf.Bytes()
 }
 
-func (sio *SocketIO) ListenAndServeFlashPolicy(laddr string) os.Error {
+func (sio *SocketIO) ListenAndServeFlashPolicy(laddr string) error {
 	var listener net.Listener
 
 	listener, err := net.Listen("tcp", laddr)
@@ -334,46 +526,61 @@ func (sio *SocketIO) ListenAndServeFlashPolicy(laddr string) os.Error {
 		return err
 	}
 
+	sio.shutdownLock.Lock()
+	if sio.shuttingDown {
+		sio.shutdownLock.Unlock()
+		listener.Close()
+		return ErrShutdown
+	}
+	sio.policyListener = listener
+	sio.shutdownLock.Unlock()
+
 	policy := sio.generatePolicyFile()
 
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
-			sio.Log("ServeFlashsocketPolicy:", err)
-			continue
+			if sio.isShuttingDown() {
+				return nil
+			}
+			sio.log(LogError, "ServeFlashsocketPolicy: unable to accept", "flash_policy", LogKeyError, err)
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return err
 		}
 
+		sio.wg.Add(1)
 		go func() {
+			defer sio.wg.Done()
 			defer conn.Close()
 
 			buf := make([]byte, 20)
 			if _, err := io.ReadFull(conn, buf); err != nil {
-				sio.Log("ServeFlashsocketPolicy:", err)
+				sio.log(LogWarn, "ServeFlashsocketPolicy: unable to serve", "flash_policy", LogKeyRemoteAddr, conn.RemoteAddr(), LogKeyError, err)
 				return
 			}
 			if !bytes.Equal([]byte("<policy-file-request"), buf) {
-				sio.Logf("ServeFlashsocketPolicy: expected \"<policy-file-request\" but got %q", buf)
+				sio.log(LogWarn, "ServeFlashsocketPolicy: unexpected request", "flash_policy", LogKeyRemoteAddr, conn.RemoteAddr(), "request", string(buf))
 				return
 			}
 
 			var nw int
 			for nw < len(policy) {
 				n, err := conn.Write(policy[nw:])
-				if err != nil && err != os.EAGAIN {
-					sio.Log("ServeFlashsocketPolicy:", err)
+				if err != nil {
+					sio.log(LogWarn, "ServeFlashsocketPolicy: unable to serve", "flash_policy", LogKeyRemoteAddr, conn.RemoteAddr(), LogKeyError, err)
 					return
 				}
 				if n > 0 {
 					nw += n
 					continue
 				} else {
-					sio.Log("ServeFlashsocketPolicy: wrote 0 bytes")
+					sio.log(LogWarn, "ServeFlashsocketPolicy: wrote 0 bytes", "flash_policy", LogKeyRemoteAddr, conn.RemoteAddr())
 					return
 				}
 			}
-			sio.Log("ServeFlashsocketPolicy: served", conn.RemoteAddr())
+			sio.log(LogDebug, "ServeFlashsocketPolicy: served", "flash_policy", LogKeyRemoteAddr, conn.RemoteAddr())
 		}()
 	}
-
-	return nil
 }
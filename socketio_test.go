@@ -1,10 +1,12 @@
 package socketio
 
 import (
-	"http"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
-	"fmt"
 )
 
 const (
@@ -16,39 +18,91 @@ const (
 	eventCrash
 )
 
-var events chan *event
+var events chan *serverEvent
 var server *SocketIO
 
-type event struct {
+type serverEvent struct {
 	conn      *Conn
 	eventType uint8
 	msg       Message
 }
 
-func echoServer(addr string, config *Config) <-chan *event {
-	events := make(chan *event)
+func echoServer(addr string, config *Config) <-chan *serverEvent {
+	events := make(chan *serverEvent)
 
 	server = NewSocketIO(config)
 	server.OnConnect(func(c *Conn) {
-		events <- &event{c, eventConnect, nil}
+		events <- &serverEvent{c, eventConnect, nil}
 	})
 	server.OnDisconnect(func(c *Conn) {
-		events <- &event{c, eventDisconnect, nil}
+		events <- &serverEvent{c, eventDisconnect, nil}
 	})
 	server.OnMessage(func(c *Conn, msg Message) {
 		if err := c.Send(msg.Data()); err != nil {
 			fmt.Println("server echo send error: ", err)
 		}
-		events <- &event{c, eventMessage, msg}
+		events <- &serverEvent{c, eventMessage, msg}
 	})
 	go func() {
 		http.ListenAndServe(addr, server.ServeMux())
-		events <- &event{nil, eventCrash, nil}
+		events <- &serverEvent{nil, eventCrash, nil}
 	}()
 
 	return events
 }
 
+// TestServer serves a new SocketIO that speaks the SIO07Codec and does not log.
+// Configure, if not nil, adjusts the Config before the SocketIO is created.
+// The connections are sent to the returned channel as they connect. The server
+// is closed when the test ends.
+func testServer(t *testing.T, configure func(*Config)) (*SocketIO, *httptest.Server, chan *Conn) {
+	config := DefaultConfig
+	config.Logger = NOPLogger
+	config.Codec = SIO07Codec{}
+	if configure != nil {
+		configure(&config)
+	}
+	sio := NewSocketIO(&config)
+
+	connected := make(chan *Conn, 10)
+	sio.OnConnect(func(c *Conn) {
+		connected <- c
+	})
+
+	server := httptest.NewServer(sio.ServeMux())
+	t.Cleanup(server.Close)
+	return sio, server, connected
+}
+
+// Poll makes an xhr-polling request and returns the body of the response.
+func poll(t *testing.T, url string) string {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal("Get:", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal("ReadAll:", err)
+	}
+	return string(body)
+}
+
+// WaitRecorded waits until the flusher of c has taken seq messages.
+func waitRecorded(t *testing.T, c *Conn, seq uint64) {
+	for i := 0; i < 100; i++ {
+		c.mutex.Lock()
+		n := c.seq
+		c.mutex.Unlock()
+
+		if n >= seq {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Expected %d messages to be recorded", seq)
+}
 
 func TestWebsocket(t *testing.T) {
 	finished := make(chan bool, 1)
@@ -58,6 +112,8 @@ func TestWebsocket(t *testing.T) {
 
 	config := DefaultConfig
 	config.QueueLength = numMessages * 2
+	config.HeartbeatInterval = 500 * time.Millisecond
+	config.ReconnectTimeout = 500 * time.Millisecond
 	config.Codec = SIOStreamingCodec{}
 	config.Origins = []string{serverAddr}
 	serverEvents := echoServer(serverAddr, &config)
@@ -70,10 +126,10 @@ func TestWebsocket(t *testing.T) {
 		clientDisconnect <- true
 	})
 
-	time.Sleep(1e9)
+	time.Sleep(time.Second)
 	/*
 		go func() {
-			time.Sleep(5e9)
+			time.Sleep(5 * time.Second)
 			if _, ok := <-finished; !ok {
 				t.Fatalf("timeout")
 			}
@@ -94,8 +150,9 @@ func TestWebsocket(t *testing.T) {
 
 	go func() {
 		for i := 0; i < numMessages; i++ {
-			if err = client.Send(i); err != nil {
-				t.Fatal("Send:", err)
+			if err := client.Send(i); err != nil {
+				t.Error("Send:", err)
+				break
 			}
 		}
 		iook <- true
@@ -104,14 +161,16 @@ func TestWebsocket(t *testing.T) {
 	go func() {
 		for i := 0; i < numMessages; i++ {
 			serverEvent = <-serverEvents
-			t.Logf("Server event %q", serverEvent)
+			t.Logf("Server event %v", serverEvent)
 
 			expect := fmt.Sprintf("%d", i)
 			if serverEvent.eventType != eventMessage || serverEvent.conn.sessionid != client.SessionID() {
-				t.Fatalf("Expected eventMessage but got %#v", serverEvent)
+				t.Errorf("Expected eventMessage but got %#v", serverEvent)
+				break
 			}
 			if serverEvent.msg.Data() != expect {
-				t.Fatalf("Server expected %s but received %s", expect, serverEvent.msg.Data())
+				t.Errorf("Server expected %s but received %s", expect, serverEvent.msg.Data())
+				break
 			} else {
 				t.Logf("Server received %s", serverEvent.msg.Data())
 			}
@@ -126,7 +185,8 @@ func TestWebsocket(t *testing.T) {
 
 			expect := fmt.Sprintf("%d", i)
 			if msg.Data() != expect {
-				t.Fatalf("Client expected %s but received %s", expect, msg.Data())
+				t.Errorf("Client expected %s but received %s", expect, msg.Data())
+				break
 			}
 		}
 		iook <- true
@@ -137,8 +197,8 @@ func TestWebsocket(t *testing.T) {
 	}
 
 	go func() {
-		if err = client.Close(); err != nil {
-			t.Fatal("Close:", err)
+		if err := client.Close(); err != nil {
+			t.Error("Close:", err)
 		}
 	}()
 
@@ -148,7 +208,7 @@ func TestWebsocket(t *testing.T) {
 	t.Log("Waiting for server disconnect")
 	serverEvent = <-serverEvents
 	if serverEvent.eventType != eventDisconnect || serverEvent.conn.sessionid != client.SessionID() {
-		t.Fatalf("Expected disconnect event, but got %q", serverEvent)
+		t.Fatalf("Expected disconnect event, but got %v", serverEvent)
 	}
 
 	finished <- true
@@ -0,0 +1,214 @@
+package socketio
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// The separator of the session id and its token in the session ids sent to
+// the clients. It is not in the SessionIDCharset.
+const sessionTokenSeparator = "."
+
+// The length of the truncated HMAC-SHA256 of a token.
+const sessionTokenMACLength = 16
+
+var (
+	// ErrSessionToken is used when a request presents a session token that is
+	// missing, malformed, or signed for another client or session.
+	ErrSessionToken = errors.New("invalid session token")
+
+	// ErrSessionTokenExpired is used when a request presents a session token
+	// that has outlived the SessionTokenConfig.Lifetime.
+	ErrSessionTokenExpired = errors.New("session token expired")
+)
+
+// SessionTokenConfig enables the signed session tokens. With the tokens, the
+// handshake gives the client the session id followed by a token, e.g.
+// "<sessionid>.<token>", which the client then uses in place of the session
+// id. The token is a HMAC of the session id, its expiry and the bound client
+// properties, so a session can not be taken over by merely observing its id
+// from another client. The requests with a forged or mismatched token are
+// answered with 403 Forbidden and the ones with an expired token with
+// 400 Bad Request, like the requests for an unknown session.
+type SessionTokenConfig struct {
+	// Keys to verify the tokens with. The first key signs the new tokens, so
+	// a key is rotated by prepending the new key and dropping the oldest one
+	// once the tokens signed with it have expired. There must be at least
+	// one key and none of them may be empty, or NewSocketIO panics.
+	Keys [][]byte
+
+	// How long after the handshake the token is accepted. Zero means for the
+	// lifetime of the session.
+	Lifetime time.Duration
+
+	// The number of the leading bits of the remote IPv4 and IPv6 addresses
+	// bound to the token, e.g. 24 and 64. Zero leaves the address unbound,
+	// which lets the clients roam between networks.
+	IPv4PrefixLen int
+	IPv6PrefixLen int
+
+	// Whether to bind the User-Agent header to the token.
+	BindUserAgent bool
+
+	// Whether to bind the identity returned by the Authorizer to the token.
+	// The identity is formatted with fmt.Sprint, so it should format the same
+	// each time for the same client, e.g. a string or a struct of values.
+	BindIdentity bool
+}
+
+// Validate checks that there is a key to sign the tokens with and that none
+// of the keys is empty.
+func (config *SessionTokenConfig) validate() error {
+	if len(config.Keys) == 0 {
+		return errors.New("socketio: SessionTokenConfig has no keys")
+	}
+	for i, key := range config.Keys {
+		if len(key) == 0 {
+			return fmt.Errorf("socketio: SessionTokenConfig key %d is empty", i)
+		}
+	}
+	return nil
+}
+
+// SplitSessionToken splits a session id sent by a client into the session id
+// and the token.
+func splitSessionToken(sid SessionID) (SessionID, string) {
+	id, token, _ := strings.Cut(string(sid), sessionTokenSeparator)
+	return SessionID(id), token
+}
+
+// SignSessionToken returns a token for the session id, the client of req and
+// the identity. It returns "" if the tokens are not enabled.
+func (sio *SocketIO) signSessionToken(sid SessionID, req *http.Request, identity interface{}) string {
+	config := sio.config.SessionTokens
+	if config == nil {
+		return ""
+	}
+
+	var expires uint64
+	if config.Lifetime > 0 {
+		expires = uint64(time.Now().Add(config.Lifetime).Unix())
+	}
+
+	b := make([]byte, 8, 8+sessionTokenMACLength)
+	binary.BigEndian.PutUint64(b, expires)
+	b = append(b, config.mac(config.Keys[0], sid, expires, req, identity)...)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// VerifySessionToken checks the token a request presents for the session id.
+// It returns nil if the tokens are not enabled.
+func (sio *SocketIO) verifySessionToken(sid SessionID, token string, req *http.Request, identity interface{}) error {
+	config := sio.config.SessionTokens
+	if config == nil {
+		return nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(b) != 8+sessionTokenMACLength {
+		return ErrSessionToken
+	}
+	expires := binary.BigEndian.Uint64(b)
+
+	for _, key := range config.Keys {
+		if hmac.Equal(b[8:], config.mac(key, sid, expires, req, identity)) {
+			if expires > 0 && uint64(time.Now().Unix()) > expires {
+				return ErrSessionTokenExpired
+			}
+			return nil
+		}
+	}
+	return ErrSessionToken
+}
+
+// Mac returns the truncated HMAC of the session id, the expiry and the bound
+// properties of the client.
+func (config *SessionTokenConfig) mac(key []byte, sid SessionID, expires uint64, req *http.Request, identity interface{}) []byte {
+	h := hmac.New(sha256.New, key)
+
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], expires)
+	h.Write(b[:])
+	writeTokenField(h, string(sid))
+	writeTokenField(h, config.ipPrefix(req))
+	if config.BindUserAgent {
+		writeTokenField(h, req.UserAgent())
+	}
+	if config.BindIdentity {
+		writeTokenField(h, fmt.Sprint(identity))
+	}
+
+	return h.Sum(nil)[:sessionTokenMACLength]
+}
+
+// WriteTokenField writes a length-prefixed field to h, so that the fields can
+// not be shifted into each other.
+func writeTokenField(h hash.Hash, s string) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(len(s)))
+	h.Write(b[:])
+	h.Write([]byte(s))
+}
+
+// IPPrefix returns the bound prefix of the remote address of req, or "" if
+// the address is not bound.
+func (config *SessionTokenConfig) ipPrefix(req *http.Request) string {
+	if config.IPv4PrefixLen <= 0 && config.IPv6PrefixLen <= 0 {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+	addr = addr.Unmap()
+
+	bits := config.IPv6PrefixLen
+	if addr.Is4() {
+		bits = config.IPv4PrefixLen
+	}
+	if bits <= 0 {
+		return ""
+	}
+
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return addr.String()
+	}
+	return prefix.String()
+}
+
+// PublicID returns the session id given to the client, i.e. the session id
+// followed by the token, if there is one.
+func (c *Conn) publicID() string {
+	if c.token == "" {
+		return string(c.sessionid)
+	}
+	return string(c.sessionid) + sessionTokenSeparator + c.token
+}
+
+// RejectSessionToken answers a request that presented an invalid token for the
+// session id.
+func (sio *SocketIO) rejectSessionToken(t Transport, w http.ResponseWriter, req *http.Request, sid SessionID, err error) {
+	sio.log(LogWarn, "sio/handle: invalid session token", "session_token", LogKeySessionID, sid, LogKeyTransport, t.Resource(), LogKeyRemoteAddr, req.RemoteAddr, LogKeyError, err)
+
+	if err == ErrSessionTokenExpired {
+		sio.reject(t, w, http.StatusBadRequest)
+	} else {
+		sio.reject(t, w, http.StatusForbidden)
+	}
+}
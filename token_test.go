@@ -0,0 +1,120 @@
+package socketio
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSessionTokens(t *testing.T) {
+	oldKey, newKey := []byte("old secret"), []byte("new secret")
+
+	config := DefaultConfig
+	config.Logger = NOPLogger
+	config.SessionTokens = &SessionTokenConfig{
+		Keys:          [][]byte{oldKey},
+		IPv4PrefixLen: 24,
+		BindUserAgent: true,
+		BindIdentity:  true,
+	}
+	sio := &SocketIO{config: config}
+
+	request := func(raddr, agent string) *http.Request {
+		req := httptest.NewRequest("GET", "/socket.io/xhr-polling", nil)
+		req.RemoteAddr = raddr
+		req.Header.Set("User-Agent", agent)
+		return req
+	}
+
+	token := sio.signSessionToken("abc", request("10.0.0.1:1234", "test"), "alice")
+
+	for _, tc := range []struct {
+		name     string
+		sid      SessionID
+		req      *http.Request
+		identity interface{}
+		err      error
+	}{
+		{"same client", "abc", request("10.0.0.1:4321", "test"), "alice", nil},
+		{"same prefix", "abc", request("10.0.0.99:1", "test"), "alice", nil},
+		{"another prefix", "abc", request("10.0.1.1:1", "test"), "alice", ErrSessionToken},
+		{"another agent", "abc", request("10.0.0.1:1", "curl"), "alice", ErrSessionToken},
+		{"another identity", "abc", request("10.0.0.1:1", "test"), "mallory", ErrSessionToken},
+		{"another session", "abd", request("10.0.0.1:1", "test"), "alice", ErrSessionToken},
+	} {
+		if err := sio.verifySessionToken(tc.sid, token, tc.req, tc.identity); err != tc.err {
+			t.Errorf("%s: expected %v but got %v", tc.name, tc.err, err)
+		}
+	}
+
+	// a new key signs, the old one still verifies until it is dropped
+	sio.config.SessionTokens.Keys = [][]byte{newKey, oldKey}
+	if err := sio.verifySessionToken("abc", token, request("10.0.0.1:1", "test"), "alice"); err != nil {
+		t.Fatalf("Expected the old key to verify but got %v", err)
+	}
+	rotated := sio.signSessionToken("abc", request("10.0.0.1:1", "test"), "alice")
+	sio.config.SessionTokens.Keys = [][]byte{newKey}
+	if err := sio.verifySessionToken("abc", token, request("10.0.0.1:1", "test"), "alice"); err != ErrSessionToken {
+		t.Fatalf("Expected the dropped key to fail but got %v", err)
+	}
+	if err := sio.verifySessionToken("abc", rotated, request("10.0.0.1:1", "test"), "alice"); err != nil {
+		t.Fatalf("Expected the new key to verify but got %v", err)
+	}
+
+	// a token that expired at 1970-01-01T00:00:01Z
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, 1)
+	b = append(b, sio.config.SessionTokens.mac(newKey, "abc", 1, request("10.0.0.1:1", "test"), "alice")...)
+	expired := base64.RawURLEncoding.EncodeToString(b)
+	if err := sio.verifySessionToken("abc", expired, request("10.0.0.1:1", "test"), "alice"); err != ErrSessionTokenExpired {
+		t.Fatalf("Expected the token to be expired but got %v", err)
+	}
+}
+
+func TestSessionTokenHandshake(t *testing.T) {
+	_, server, connected := testServer(t, func(config *Config) {
+		config.SessionTokens = &SessionTokenConfig{Keys: [][]byte{[]byte("secret")}, BindUserAgent: true}
+	})
+
+	body := poll(t, server.URL+"/socket.io/xhr-polling")
+	c := <-connected
+	id := c.publicID()
+	if !strings.HasPrefix(id, string(c.sessionid)+".") || !strings.Contains(body, id) {
+		t.Fatalf("Expected the handshake to carry the token %q but got %q", id, body)
+	}
+
+	// the bare session id does not get through
+	resp, err := http.Get(server.URL + "/socket.io/xhr-polling/" + string(c.sessionid))
+	if err != nil {
+		t.Fatal("Get:", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("Expected the bare session id to be forbidden but got %d", resp.StatusCode)
+	}
+
+	c.Send("a")
+	if body = poll(t, server.URL+"/socket.io/xhr-polling/"+id); !strings.Contains(body, "3:::a") {
+		t.Fatalf("Expected the message to be polled with the token but got %q", body)
+	}
+}
+
+func TestSessionTokenKeys(t *testing.T) {
+	for _, keys := range [][][]byte{nil, {}, {[]byte("secret"), nil}, {[]byte("")}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected NewSocketIO to refuse the keys %q", keys)
+				}
+			}()
+
+			config := DefaultConfig
+			config.Logger = NOPLogger
+			config.SessionTokens = &SessionTokenConfig{Keys: keys}
+			NewSocketIO(&config)
+		}()
+	}
+}
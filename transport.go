@@ -1,20 +1,24 @@
 package socketio
 
 import (
+	"errors"
 	"fmt"
-	"http"
 	"io"
-	"os"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
 )
 
 var (
 	// ErrNotConnected is used when some action required the connection to be online,
 	// but it wasn't.
-	ErrNotConnected = os.NewError("not connected")
+	ErrNotConnected = errors.New("not connected")
 
 	// ErrConnected is used when some action required the connection to be offline,
 	// but it wasn't.
-	ErrConnected = os.NewError("already connected")
+	ErrConnected = errors.New("already connected")
 
 	emptyResponse = []byte{}
 	okResponse    = []byte("ok")
@@ -22,12 +26,13 @@ var (
 
 // DefaultTransports holds the defaults
 var DefaultTransports = []Transport{
-	NewXHRPollingTransport(10e9, 5e9),
-	NewXHRMultipartTransport(0, 5e9),
-	NewWebsocketTransport(0, 5e9),
-	NewHTMLFileTransport(0, 5e9),
-	NewFlashsocketTransport(0, 5e9),
-	NewJSONPPollingTransport(0, 5e9),
+	NewXHRPollingTransport(10*time.Second, 5*time.Second),
+	NewXHRMultipartTransport(0, 5*time.Second),
+	NewWebsocketTransport(0, 5*time.Second),
+	NewHTMLFileTransport(0, 5*time.Second),
+	NewFlashsocketTransport(0, 5*time.Second),
+	NewEventSourceTransport(0, 5*time.Second, 15*time.Second),
+	NewJSONPPollingTransport(0, 5*time.Second),
 }
 
 // Transport is the interface that wraps the Resource and newSocket methods.
@@ -42,16 +47,169 @@ type Transport interface {
 
 // Socket is the interface that wraps the basic Read, Write, Close and String
 // methods. Additionally it has Transport and accept methods.
-// 
+//
 // Transport returns the Transport that created this socket.
 // Accept takes the http.ResponseWriter / http.Request -pair from a http handler
-// and hijacks the connection for itself. The third parameter is a function callback
-// that will be invoked when the connection has been succesfully hijacked and the socket
-// is ready to be used.
+// and either hijacks the connection for itself or, like the polling sockets,
+// keeps the pair until the response has been written. The third parameter is a
+// function callback that will be invoked when the socket is ready to be used.
+// Accept may wait for the socket to be used before it returns.
 type socket interface {
 	io.ReadWriteCloser
 	fmt.Stringer
 
 	Transport() Transport
-	accept(http.ResponseWriter, *http.Request, func()) os.Error
+	accept(http.ResponseWriter, *http.Request, func()) error
+}
+
+// BinarySocket is implemented by the sockets that carry binary frames
+// natively, e.g. the websocket ones.
+//
+// WriteBinary writes p as a single binary frame. ReadFrame reads a whole frame
+// and tells if it is a binary one. The reader of a connection uses ReadFrame
+// instead of Read if the socket implements it. SupportsBinary tells if the
+// connection can carry binary frames, e.g. a legacy hixie websocket can not.
+type binarySocket interface {
+	WriteBinary(p []byte) (int, error)
+	ReadFrame() (p []byte, binary bool, err error)
+	supportsBinary() bool
+}
+
+// TimeoutConn wraps a net.Conn and sets the read and write deadlines before
+// each Read and Write so that every operation must complete within its
+// timeout. A timeout of zero means no timeout.
+type timeoutConn struct {
+	net.Conn
+	rtimeout time.Duration
+	wtimeout time.Duration
+}
+
+func newTimeoutConn(conn net.Conn, rtimeout, wtimeout time.Duration) *timeoutConn {
+	return &timeoutConn{conn, rtimeout, wtimeout}
+}
+
+func (tc *timeoutConn) Read(p []byte) (int, error) {
+	if tc.rtimeout > 0 {
+		tc.Conn.SetReadDeadline(time.Now().Add(tc.rtimeout))
+	}
+	return tc.Conn.Read(p)
+}
+
+func (tc *timeoutConn) Write(p []byte) (int, error) {
+	if tc.wtimeout > 0 {
+		tc.Conn.SetWriteDeadline(time.Now().Add(tc.wtimeout))
+	}
+	return tc.Conn.Write(p)
+}
+
+// PollTimeoutError is returned by the Read of a polling socket when the poll
+// has been pending for the read timeout of its transport.
+type pollTimeoutError struct{}
+
+func (pollTimeoutError) Error() string   { return "poll timeout" }
+func (pollTimeoutError) Timeout() bool   { return true }
+func (pollTimeoutError) Temporary() bool { return true }
+
+// PollResponse answers a single poll through the http.ResponseWriter of the
+// request, so that the polling transports work with any net/http server, the
+// connections are kept alive and the headers set by the middleware are kept.
+// Since the ResponseWriter can only be used until the handler returns, accept
+// waits until the response is written or the socket is closed.
+//
+// Read has nothing to read: it waits until the poll is over and returns
+// io.EOF, or a timeout error after the read timeout.
+type pollResponse struct {
+	w         http.ResponseWriter
+	req       *http.Request
+	rtimeout  time.Duration
+	wtimeout  time.Duration
+	mutex     sync.Mutex
+	connected bool
+	done      chan struct{} // Closed when the poll is over.
+}
+
+// Open takes the http responseWriter/req -pair for a poll.
+func (pr *pollResponse) open(w http.ResponseWriter, req *http.Request, rtimeout, wtimeout time.Duration) error {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+
+	if pr.connected {
+		return ErrConnected
+	}
+
+	pr.w, pr.req = w, req
+	pr.rtimeout, pr.wtimeout = rtimeout, wtimeout
+	pr.connected = true
+	pr.done = make(chan struct{})
+	return nil
+}
+
+// Wait blocks until the poll is over. If the client goes away, the socket is
+// closed.
+func (pr *pollResponse) wait() {
+	select {
+	case <-pr.done:
+	case <-pr.req.Context().Done():
+		pr.Close()
+	}
+}
+
+func (pr *pollResponse) Read(p []byte) (int, error) {
+	pr.mutex.Lock()
+	connected, done := pr.connected, pr.done
+	pr.mutex.Unlock()
+
+	if !connected {
+		return 0, ErrNotConnected
+	}
+
+	var timeout <-chan time.Time
+	if pr.rtimeout > 0 {
+		timer := time.NewTimer(pr.rtimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-done:
+		return 0, io.EOF
+	case <-timeout:
+		return 0, pollTimeoutError{}
+	}
+}
+
+// Respond writes the response of the poll and ends it.
+func (pr *pollResponse) respond(contentType string, body []byte) error {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+
+	if !pr.connected {
+		return ErrNotConnected
+	}
+	pr.connected = false
+	defer close(pr.done)
+
+	if pr.wtimeout > 0 {
+		http.NewResponseController(pr.w).SetWriteDeadline(time.Now().Add(pr.wtimeout))
+	}
+
+	h := pr.w.Header()
+	h.Set("Content-Type", contentType)
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+	_, err := pr.w.Write(body)
+	return err
+}
+
+// Close ends the poll without a response body.
+func (pr *pollResponse) Close() error {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+
+	if !pr.connected {
+		return ErrNotConnected
+	}
+
+	pr.connected = false
+	close(pr.done)
+	return nil
 }
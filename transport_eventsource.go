@@ -0,0 +1,266 @@
+package socketio
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The padding sent before the first event, so that the proxies that buffer
+// the beginning of a response pass the stream on.
+var eventsourcePadding = ":" + strings.Repeat(" ", 2048) + "\n\n"
+
+// The eventsource transport.
+type eventsourceTransport struct {
+	rtimeout  time.Duration // The period during which the client must send a message.
+	wtimeout  time.Duration // The period during which a write must succeed.
+	keepalive time.Duration // The interval of the keepalive comments.
+}
+
+// Creates a new eventsource transport with the given read and write timeouts
+// and the interval of the keepalive comments. A keepalive of zero disables the
+// comments.
+func NewEventSourceTransport(rtimeout, wtimeout, keepalive time.Duration) Transport {
+	return &eventsourceTransport{rtimeout, wtimeout, keepalive}
+}
+
+// Resource returns the resource name.
+func (t *eventsourceTransport) Resource() string {
+	return "eventsource"
+}
+
+// Creates a new socket that can be used with a connection.
+func (t *eventsourceTransport) newSocket() socket {
+	return &eventsourceSocket{t: t}
+}
+
+// Implements the socket interface for eventsource transports. The messages
+// are streamed as text/event-stream events through the http.ResponseWriter of
+// the request, so that the stream works with any net/http server, e.g. over
+// HTTP/2, and the client sends its messages with POST requests, just like with
+// the polling transports. Since the ResponseWriter can only be used until the
+// handler returns, accept waits until the socket is closed.
+//
+// Read has nothing to read: it waits until the socket is closed or the client
+// goes away and returns io.EOF, or a timeout error after the read timeout.
+type eventsourceSocket struct {
+	t         *eventsourceTransport
+	w         http.ResponseWriter
+	rc        *http.ResponseController
+	mutex     sync.Mutex // Serializes the writes of the events and the keepalives.
+	connected bool
+	id        string        // The id of the next event.
+	done      chan struct{} // Closed when the socket is closed.
+}
+
+// String returns a verbose representation of the socket.
+func (s *eventsourceSocket) String() string {
+	return s.t.Resource()
+}
+
+// Transport returns the transport the socket is based on.
+func (s *eventsourceSocket) Transport() Transport {
+	return s.t
+}
+
+// Accepts a http connection & request pair. It sends the headers, calls
+// proceed if succesfull and waits until the socket is closed. The
+// ResponseWriter must be able to flush, or http.ErrNotSupported is returned
+// before anything is written.
+func (s *eventsourceSocket) accept(w http.ResponseWriter, req *http.Request, proceed func()) (err error) {
+	s.mutex.Lock()
+
+	if s.connected {
+		s.mutex.Unlock()
+		return ErrConnected
+	}
+
+	if !canFlush(w) {
+		s.mutex.Unlock()
+		return http.ErrNotSupported
+	}
+
+	// the headers set so far, e.g. the CORS ones, are kept
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+
+	s.w, s.rc = w, http.NewResponseController(w)
+	if err = s.flush(eventsourcePadding); err != nil {
+		s.mutex.Unlock()
+		return
+	}
+
+	s.connected = true
+	s.done = make(chan struct{})
+	done := s.done
+	s.mutex.Unlock()
+
+	if s.t.keepalive > 0 {
+		go s.keepalive(done)
+	}
+	proceed()
+
+	select {
+	case <-done:
+	case <-req.Context().Done():
+		s.Close()
+	}
+	return
+}
+
+// CanFlush reports whether w, or a ResponseWriter it wraps, is an
+// http.Flusher.
+func canFlush(w http.ResponseWriter) bool {
+	for {
+		switch rw := w.(type) {
+		case http.Flusher:
+			return true
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = rw.Unwrap()
+		default:
+			return false
+		}
+	}
+}
+
+// Flush writes p to the stream and flushes it to the client. The caller holds
+// s.mutex.
+func (s *eventsourceSocket) flush(p string) error {
+	if s.t.wtimeout > 0 {
+		s.rc.SetWriteDeadline(time.Now().Add(s.t.wtimeout))
+	}
+
+	if _, err := io.WriteString(s.w, p); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+// Keepalive writes a comment every keepalive interval until the socket is
+// closed, so that the proxies do not time out an idle stream.
+func (s *eventsourceSocket) keepalive(done chan struct{}) {
+	ticker := time.NewTicker(s.t.keepalive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.mutex.Lock()
+			err := ErrNotConnected
+			if s.connected {
+				err = s.flush(":\n\n")
+			}
+			s.mutex.Unlock()
+
+			if err != nil {
+				s.Close()
+				return
+			}
+
+		case <-done:
+			return
+		}
+	}
+}
+
+func (s *eventsourceSocket) Read(p []byte) (n int, err error) {
+	s.mutex.Lock()
+	connected, done := s.connected, s.done
+	s.mutex.Unlock()
+
+	if !connected {
+		return 0, ErrNotConnected
+	}
+
+	var timeout <-chan time.Time
+	if s.t.rtimeout > 0 {
+		timer := time.NewTimer(s.t.rtimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-done:
+		return 0, io.EOF
+	case <-timeout:
+		return 0, pollTimeoutError{}
+	}
+}
+
+// Write sends p as a single event. The event is labeled with the id set with
+// setEventID. Since the EventSource ends a line at a carriage return, a line
+// feed or both, each of them arrives as a line feed.
+func (s *eventsourceSocket) Write(p []byte) (n int, err error) {
+	var buf strings.Builder
+	if s.id != "" {
+		fmt.Fprintf(&buf, "id: %s\n", s.id)
+	}
+
+	data := strings.ReplaceAll(string(p), "\r\n", "\n")
+	data = strings.ReplaceAll(data, "\r", "\n")
+	for _, line := range strings.Split(data, "\n") {
+		buf.WriteString("data: ")
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.connected {
+		return 0, ErrNotConnected
+	}
+	if err = s.flush(buf.String()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// SetEventID sets the id of the following events.
+func (s *eventsourceSocket) setEventID(id string) {
+	s.id = id
+}
+
+func (s *eventsourceSocket) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.connected {
+		return ErrNotConnected
+	}
+
+	s.connected = false
+	close(s.done)
+	return nil
+}
+
+// EventSocket is implemented by the sockets that label what they write with
+// an id the client sends back when it reconnects, e.g. the eventsource ones.
+type eventSocket interface {
+	setEventID(id string)
+}
+
+// LabelEvents sets the id of the events written to c.socket from now on: the
+// session id and the sequence number of the latest recorded message. The
+// caller holds c.mutex.
+func (c *Conn) labelEvents() {
+	if es, ok := c.socket.(eventSocket); ok {
+		es.setEventID(c.publicID() + ":" + strconv.FormatUint(c.seq, 10))
+	}
+}
+
+// LastEventID returns the session id and the sequence number in the
+// Last-Event-ID header an EventSource sends when it reconnects.
+func lastEventID(req *http.Request) (SessionID, string) {
+	sid, seq, ok := strings.Cut(req.Header.Get("Last-Event-ID"), ":")
+	if !ok {
+		return "", ""
+	}
+	return SessionID(sid), seq
+}
@@ -1,8 +1,8 @@
 package socketio
 
 import (
-	"http"
-	"os"
+	"net/http"
+	"time"
 )
 
 // The flashsocket transport.
@@ -10,9 +10,17 @@ type flashsocketTransport struct {
 	wsTransport *websocketTransport
 }
 
-// Creates a new flashsocket transport with the given read and write timeouts.
-func NewFlashsocketTransport(rtimeout, wtimeout int64) Transport {
-	return &flashsocketTransport{&websocketTransport{rtimeout, wtimeout}}
+// Creates a new flashsocket transport with the given read and write timeouts
+// and the rest of the settings from the DefaultWebsocketConfig.
+func NewFlashsocketTransport(rtimeout, wtimeout time.Duration) Transport {
+	config := DefaultWebsocketConfig
+	config.ReadTimeout, config.WriteTimeout = rtimeout, wtimeout
+	return NewFlashsocketTransportConfig(config)
+}
+
+// Creates a new flashsocket transport with the given config.
+func NewFlashsocketTransportConfig(config WebsocketConfig) Transport {
+	return &flashsocketTransport{&websocketTransport{config}}
 }
 
 // Resource returns the resource name.
@@ -43,20 +51,30 @@ func (s *flashsocketSocket) String() string {
 
 // Accepts a http connection & request pair. It upgrades the connection and calls
 // proceed if succesfull.
-//
-// TODO: Remove the ugly channels and timeouts. They should not be needed!
-func (s *flashsocketSocket) accept(w http.ResponseWriter, req *http.Request, proceed func()) (err os.Error) {
+func (s *flashsocketSocket) accept(w http.ResponseWriter, req *http.Request, proceed func()) (err error) {
 	return s.s.accept(w, req, proceed)
 }
 
-func (s *flashsocketSocket) Read(p []byte) (int, os.Error) {
+func (s *flashsocketSocket) Read(p []byte) (int, error) {
 	return s.s.Read(p)
 }
 
-func (s *flashsocketSocket) Write(p []byte) (int, os.Error) {
+func (s *flashsocketSocket) Write(p []byte) (int, error) {
 	return s.s.Write(p)
 }
 
-func (s *flashsocketSocket) Close() os.Error {
+func (s *flashsocketSocket) WriteBinary(p []byte) (int, error) {
+	return s.s.(binarySocket).WriteBinary(p)
+}
+
+func (s *flashsocketSocket) ReadFrame() ([]byte, bool, error) {
+	return s.s.(binarySocket).ReadFrame()
+}
+
+func (s *flashsocketSocket) supportsBinary() bool {
+	return s.s.(binarySocket).supportsBinary()
+}
+
+func (s *flashsocketSocket) Close() error {
 	return s.s.Close()
 }
@@ -1,26 +1,25 @@
 package socketio
 
 import (
-	"http"
-	"os"
-	"io"
 	"bytes"
-	"strings"
-	"json"
-	"net"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
 )
 
 var htmlfileHeader = "<html><body>" + strings.Repeat(" ", 244)
 
 // The xhr-multipart transport.
 type htmlfileTransport struct {
-	rtimeout int64 // The period during which the client must send a message.
-	wtimeout int64 // The period during which a write must succeed.
+	rtimeout time.Duration // The period during which the client must send a message.
+	wtimeout time.Duration // The period during which a write must succeed.
 }
 
 // Creates a new xhr-multipart transport with the given read and write timeouts.
-func NewHTMLFileTransport(rtimeout, wtimeout int64) Transport {
+func NewHTMLFileTransport(rtimeout, wtimeout time.Duration) Transport {
 	return &htmlfileTransport{rtimeout, wtimeout}
 }
 
@@ -53,7 +52,7 @@ func (s *htmlfileSocket) Transport() Transport {
 
 // Accepts a http connection & request pair. It hijacks the connection, sends headers and calls
 // proceed if succesfull.
-func (s *htmlfileSocket) accept(w http.ResponseWriter, req *http.Request, proceed func()) (err os.Error) {
+func (s *htmlfileSocket) accept(w http.ResponseWriter, req *http.Request, proceed func()) (err error) {
 	if s.connected {
 		return ErrConnected
 	}
@@ -61,14 +60,18 @@ func (s *htmlfileSocket) accept(w http.ResponseWriter, req *http.Request, procee
 	rwc, _, err := w.(http.Hijacker).Hijack()
 
 	if err == nil {
-		rwc.(*net.TCPConn).SetReadTimeout(s.t.rtimeout)
-		rwc.(*net.TCPConn).SetWriteTimeout(s.t.wtimeout)
+		rwc = newTimeoutConn(rwc, s.t.rtimeout, s.t.wtimeout)
+
+		// the headers set so far, e.g. the CORS ones, are kept
+		h := w.Header()
+		h.Set("Content-Type", "text/html")
+		h.Set("Connection", "keep-alive")
+		h.Set("Transfer-Encoding", "chunked")
 
 		buf := new(bytes.Buffer)
 		buf.WriteString("HTTP/1.1 200 OK\r\n")
-		buf.WriteString("Content-Type: text/html\r\n")
-		buf.WriteString("Connection: keep-alive\r\n")
-		buf.WriteString("Transfer-Encoding: chunked\r\n\r\n")
+		h.Write(buf)
+		buf.WriteString("\r\n")
 		if _, err = buf.WriteTo(rwc); err != nil {
 			rwc.Close()
 			return
@@ -86,7 +89,7 @@ func (s *htmlfileSocket) accept(w http.ResponseWriter, req *http.Request, procee
 	return
 }
 
-func (s *htmlfileSocket) Read(p []byte) (n int, err os.Error) {
+func (s *htmlfileSocket) Read(p []byte) (n int, err error) {
 	if !s.connected {
 		return 0, ErrNotConnected
 	}
@@ -94,9 +97,8 @@ func (s *htmlfileSocket) Read(p []byte) (n int, err os.Error) {
 	return s.rwc.Read(p)
 }
 
-
 // Write sends a single multipart message to the wire.
-func (s *htmlfileSocket) Write(p []byte) (n int, err os.Error) {
+func (s *htmlfileSocket) Write(p []byte) (n int, err error) {
 	if !s.connected {
 		return 0, ErrNotConnected
 	}
@@ -108,10 +110,13 @@ func (s *htmlfileSocket) Write(p []byte) (n int, err os.Error) {
 	}
 
 	fmt.Fprintf(&buf, "<script>parent.s._(%s, document);</script>", jp)
-	return fmt.Fprintf(s.rwc, "%x\r\n%s\r\n", buf.Len(), buf.String())
+	if _, err = fmt.Fprintf(s.rwc, "%x\r\n%s\r\n", buf.Len(), buf.String()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
 }
 
-func (s *htmlfileSocket) Close() os.Error {
+func (s *htmlfileSocket) Close() error {
 	if !s.connected {
 		return ErrNotConnected
 	}
@@ -1,23 +1,21 @@
 package socketio
 
 import (
-	"http"
-	"os"
-	"io"
-	"net"
-	"strconv"
-	"json"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"strconv"
+	"time"
 )
 
 // The jsonp-polling transport.
 type jsonpPollingTransport struct {
-	rtimeout int64 // The period during which the client must send a message.
-	wtimeout int64 // The period during which a write must succeed.
+	rtimeout time.Duration // The period during which the client must send a message.
+	wtimeout time.Duration // The period during which a write must succeed.
 }
 
 // Creates a new json-polling transport with the given read and write timeouts.
-func NewJSONPPollingTransport(rtimeout, wtimeout int64) Transport {
+func NewJSONPPollingTransport(rtimeout, wtimeout time.Duration) Transport {
 	return &jsonpPollingTransport{rtimeout, wtimeout}
 }
 
@@ -33,10 +31,9 @@ func (t *jsonpPollingTransport) newSocket() (s socket) {
 
 // Implements the socket interface.
 type jsonpPollingSocket struct {
-	t         *jsonpPollingTransport
-	rwc       io.ReadWriteCloser
-	index     int
-	connected bool
+	t     *jsonpPollingTransport
+	index int
+	pollResponse
 }
 
 // String returns the verbose representation of the transport instance.
@@ -49,62 +46,35 @@ func (s *jsonpPollingSocket) Transport() Transport {
 	return s.t
 }
 
-// Accepts a http connection & request pair. It hijacks the connection and calls
-// proceed if succesfull.
-func (s *jsonpPollingSocket) accept(w http.ResponseWriter, req *http.Request, proceed func()) (err os.Error) {
-	if s.connected {
-		return ErrConnected
+// Accepts a http connection & request pair. It calls proceed and waits until
+// the poll is answered.
+func (s *jsonpPollingSocket) accept(w http.ResponseWriter, req *http.Request, proceed func()) (err error) {
+	if err = s.open(w, req, s.t.rtimeout, s.t.wtimeout); err != nil {
+		return
 	}
 
-	rwc, _, err := w.(http.Hijacker).Hijack()
-	if err == nil {
-		rwc.(*net.TCPConn).SetReadTimeout(s.t.rtimeout)
-		rwc.(*net.TCPConn).SetWriteTimeout(s.t.wtimeout)
-		s.rwc = rwc
-		s.connected = true
-		s.index = 0
-		if ts := req.FormValue("t"); ts != "" {
-			if index, err := strconv.Atoi(ts); err == nil {
-				s.index = index
-			}
+	s.index = 0
+	if ts := req.FormValue("t"); ts != "" {
+		if index, err := strconv.Atoi(ts); err == nil {
+			s.index = index
 		}
-		proceed()
-	}
-	return
-}
-
-func (s *jsonpPollingSocket) Read(p []byte) (n int, err os.Error) {
-	if !s.connected {
-		return 0, ErrNotConnected
 	}
 
-	return s.rwc.Read(p)
+	proceed()
+	s.wait()
+	return
 }
 
-// Write sends a single message to the wire and closes the connection.
-func (s *jsonpPollingSocket) Write(p []byte) (n int, err os.Error) {
-	if !s.connected {
-		return 0, ErrNotConnected
-	}
-
-	defer s.Close()
-
+// Write sends a single message as the response of the poll and ends it.
+func (s *jsonpPollingSocket) Write(p []byte) (n int, err error) {
 	var jp []byte
 	if jp, err = json.Marshal(string(p)); err != nil {
 		return
 	}
 
 	jsonp := fmt.Sprintf("io.JSONP[%d]._(%s);", s.index, string(jp))
-	return fmt.Fprintf(s.rwc,
-		"HTTP/1.0 200 OK\r\nContent-Type: text/javascript; charset=UTF-8\r\nContent-Length: %d\r\n\r\n%s",
-		len(jsonp), jsonp)
-}
-
-func (s *jsonpPollingSocket) Close() os.Error {
-	if !s.connected {
-		return ErrNotConnected
+	if err = s.respond("text/javascript; charset=UTF-8", []byte(jsonp)); err != nil {
+		return 0, err
 	}
-
-	s.connected = false
-	return s.rwc.Close()
+	return len(p), nil
 }
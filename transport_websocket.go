@@ -1,22 +1,27 @@
 package socketio
 
 import (
-	"http"
-	"os"
-	"websocket"
+	"net/http"
+	"sync"
+	"time"
 )
 
-var errWebsocketHandshake = os.NewError("websocket handshake error")
-
 // The websocket transport.
 type websocketTransport struct {
-	rtimeout int64 // The period during which the client must send a message.
-	wtimeout int64 // The period during which a write must succeed.
+	config WebsocketConfig
+}
+
+// Creates a new websocket transport with the given read and write timeouts and
+// the rest of the settings from the DefaultWebsocketConfig.
+func NewWebsocketTransport(rtimeout, wtimeout time.Duration) Transport {
+	config := DefaultWebsocketConfig
+	config.ReadTimeout, config.WriteTimeout = rtimeout, wtimeout
+	return NewWebsocketTransportConfig(config)
 }
 
-// Creates a new websocket transport with the given read and write timeouts.
-func NewWebsocketTransport(rtimeout, wtimeout int64) Transport {
-	return &websocketTransport{rtimeout, wtimeout}
+// Creates a new websocket transport with the given config.
+func NewWebsocketTransportConfig(config WebsocketConfig) Transport {
+	return &websocketTransport{config}
 }
 
 // Resource returns the resource name.
@@ -32,9 +37,11 @@ func (t *websocketTransport) newSocket() socket {
 // websocketTransport implements the transport interface for websockets
 type websocketSocket struct {
 	t         *websocketTransport // the transport configuration
-	ws        *websocket.Conn     // the websocket connection
+	ws        *websocketConn      // the websocket connection
 	connected bool                // used internally to represent the connection state
-	close     chan byte
+	pending   []byte              // the unread part of the last message read with Read
+	close     chan struct{}       // closed to stop the pinger
+	closeOnce sync.Once
 }
 
 // Transport returns the transport the socket is based on.
@@ -49,61 +56,106 @@ func (s *websocketSocket) String() string {
 
 // Accepts a http connection & request pair. It upgrades the connection and calls
 // proceed if succesfull.
-//
-// TODO: Remove the ugly channels and timeouts. They should not be needed!
-func (s *websocketSocket) accept(w http.ResponseWriter, req *http.Request, proceed func()) (err os.Error) {
+func (s *websocketSocket) accept(w http.ResponseWriter, req *http.Request, proceed func()) (err error) {
 	if s.connected {
 		return ErrConnected
 	}
 
-	f := func(ws *websocket.Conn) {
-		err = nil
-		ws.SetReadTimeout(s.t.rtimeout)
-		ws.SetWriteTimeout(s.t.wtimeout)
-		s.connected = true
-		s.ws = ws
-		s.close = make(chan byte)
-		defer close(s.close)
-
-		proceed()
+	if s.ws, err = upgradeWebsocket(w, req, &s.t.config); err != nil {
+		return
+	}
 
-		// must block until closed
-		<-s.close
+	s.connected = true
+	s.close = make(chan struct{})
+	if s.t.config.PingInterval > 0 && !s.ws.hixie {
+		go s.pinger()
 	}
 
-	err = errWebsocketHandshake
-	websocket.Handler(f).ServeHTTP(w, req)
+	proceed()
 	return
 }
 
-func (s *websocketSocket) Read(p []byte) (int, os.Error) {
+// Pinger pings the client every PingInterval until the socket is closed.
+func (s *websocketSocket) pinger() {
+	ticker := time.NewTicker(s.t.config.PingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if s.ws.Ping() != nil {
+				return
+			}
+		case <-s.close:
+			return
+		}
+	}
+}
+
+func (s *websocketSocket) Read(p []byte) (int, error) {
+	if !s.connected {
+		return 0, ErrNotConnected
+	}
+
+	for len(s.pending) == 0 {
+		_, msg, err := s.ws.ReadMessage()
+		if err != nil {
+			return 0, err
+		}
+		s.pending = msg
+	}
+
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+// Write writes p as a single text message.
+func (s *websocketSocket) Write(p []byte) (int, error) {
 	if !s.connected {
 		return 0, ErrNotConnected
 	}
 
-	return s.ws.Read(p)
+	if err := s.ws.WriteMessage(websocketOpText, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
 }
 
-func (s *websocketSocket) Write(p []byte) (int, os.Error) {
+// WriteBinary writes p as a single binary message.
+func (s *websocketSocket) WriteBinary(p []byte) (int, error) {
 	if !s.connected {
 		return 0, ErrNotConnected
 	}
 
-	return s.ws.Write(p)
+	if err := s.ws.WriteMessage(websocketOpBinary, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// ReadFrame reads a whole text or binary message.
+func (s *websocketSocket) ReadFrame() ([]byte, bool, error) {
+	if !s.connected {
+		return nil, false, ErrNotConnected
+	}
+
+	op, p, err := s.ws.ReadMessage()
+	return p, op == websocketOpBinary, err
+}
+
+// SupportsBinary tells if the connection carries binary messages, i.e. if it
+// is not a hixie one.
+func (s *websocketSocket) supportsBinary() bool {
+	return s.connected && !s.ws.hixie
 }
 
-func (s *websocketSocket) Close() os.Error {
+func (s *websocketSocket) Close() error {
 	if !s.connected {
 		return ErrNotConnected
 	}
 
 	s.connected = false
-	go func() {
-		select {
-		case s.close <- 1:
-		default:
-		}
-	}()
-
+	s.closeOnce.Do(func() { close(s.close) })
 	return s.ws.Close()
 }
@@ -1,22 +1,21 @@
 package socketio
 
 import (
-	"http"
-	"os"
-	"io"
 	"bytes"
-	"net"
 	"fmt"
+	"io"
+	"net/http"
+	"time"
 )
 
 // The xhr-multipart transport.
 type xhrMultipartTransport struct {
-	rtimeout int64 // The period during which the client must send a message.
-	wtimeout int64 // The period during which a write must succeed.
+	rtimeout time.Duration // The period during which the client must send a message.
+	wtimeout time.Duration // The period during which a write must succeed.
 }
 
 // Creates a new xhr-multipart transport with the given read and write timeouts.
-func NewXHRMultipartTransport(rtimeout, wtimeout int64) Transport {
+func NewXHRMultipartTransport(rtimeout, wtimeout time.Duration) Transport {
 	return &xhrMultipartTransport{rtimeout, wtimeout}
 }
 
@@ -49,7 +48,7 @@ func (s *xhrMultipartSocket) Transport() Transport {
 
 // Accepts a http connection & request pair. It hijacks the connection, sends headers and calls
 // proceed if succesfull.
-func (s *xhrMultipartSocket) accept(w http.ResponseWriter, req *http.Request, proceed func()) (err os.Error) {
+func (s *xhrMultipartSocket) accept(w http.ResponseWriter, req *http.Request, proceed func()) (err error) {
 	if s.connected {
 		return ErrConnected
 	}
@@ -57,18 +56,16 @@ func (s *xhrMultipartSocket) accept(w http.ResponseWriter, req *http.Request, pr
 	rwc, _, err := w.(http.Hijacker).Hijack()
 
 	if err == nil {
-		rwc.(*net.TCPConn).SetReadTimeout(s.t.rtimeout)
-		rwc.(*net.TCPConn).SetWriteTimeout(s.t.wtimeout)
+		rwc = newTimeoutConn(rwc, s.t.rtimeout, s.t.wtimeout)
+
+		// the headers set so far, e.g. the CORS ones, are kept
+		h := w.Header()
+		h.Set("Content-Type", "multipart/x-mixed-replace; boundary=\"socketio\"")
+		h.Set("Connection", "keep-alive")
 
 		buf := new(bytes.Buffer)
 		buf.WriteString("HTTP/1.0 200 OK\r\n")
-		buf.WriteString("Content-Type: multipart/x-mixed-replace; boundary=\"socketio\"\r\n")
-		buf.WriteString("Connection: keep-alive\r\n")
-		if origin := req.Header.Get("Origin"); origin != "" {
-			fmt.Fprintf(buf,
-				"Access-Control-Allow-Origin: %s\r\nAccess-Control-Allow-Credentials: true\r\n",
-				origin)
-		}
+		h.Write(buf)
 		buf.WriteString("\r\n--socketio\r\n")
 
 		if _, err = buf.WriteTo(rwc); err != nil {
@@ -84,7 +81,7 @@ func (s *xhrMultipartSocket) accept(w http.ResponseWriter, req *http.Request, pr
 	return
 }
 
-func (s *xhrMultipartSocket) Read(p []byte) (n int, err os.Error) {
+func (s *xhrMultipartSocket) Read(p []byte) (n int, err error) {
 	if !s.connected {
 		return 0, ErrNotConnected
 	}
@@ -93,15 +90,18 @@ func (s *xhrMultipartSocket) Read(p []byte) (n int, err os.Error) {
 }
 
 // Write sends a single multipart message to the wire.
-func (s *xhrMultipartSocket) Write(p []byte) (n int, err os.Error) {
+func (s *xhrMultipartSocket) Write(p []byte) (n int, err error) {
 	if !s.connected {
 		return 0, ErrNotConnected
 	}
 
-	return fmt.Fprintf(s.rwc, "Content-Type: text/plain\r\n\r\n%s\n--socketio\n", p)
+	if _, err = fmt.Fprintf(s.rwc, "Content-Type: text/plain\r\n\r\n%s\n--socketio\n", p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
 }
 
-func (s *xhrMultipartSocket) Close() os.Error {
+func (s *xhrMultipartSocket) Close() error {
 	if !s.connected {
 		return ErrNotConnected
 	}
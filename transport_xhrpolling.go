@@ -1,22 +1,18 @@
 package socketio
 
 import (
-	"http"
-	"bytes"
-	"os"
-	"io"
-	"net"
-	"fmt"
+	"net/http"
+	"time"
 )
 
 // The xhr-polling transport.
 type xhrPollingTransport struct {
-	rtimeout int64 // The period during which the client must send a message.
-	wtimeout int64 // The period during which a write must succeed.
+	rtimeout time.Duration // The period during which the client must send a message.
+	wtimeout time.Duration // The period during which a write must succeed.
 }
 
 // Creates a new xhr-polling transport with the given read and write timeouts.
-func NewXHRPollingTransport(rtimeout, wtimeout int64) Transport {
+func NewXHRPollingTransport(rtimeout, wtimeout time.Duration) Transport {
 	return &xhrPollingTransport{rtimeout, wtimeout}
 }
 
@@ -32,10 +28,8 @@ func (t *xhrPollingTransport) newSocket() socket {
 
 // Implements the socket interface for xhr-polling transports.
 type xhrPollingSocket struct {
-	t         *xhrPollingTransport
-	rwc       io.ReadWriteCloser
-	req       *http.Request
-	connected bool
+	t *xhrPollingTransport
+	pollResponse
 }
 
 // String returns the verbose representation of the socket.
@@ -48,63 +42,22 @@ func (s *xhrPollingSocket) Transport() Transport {
 	return s.t
 }
 
-// Accepts a http connection & request pair. It hijacks the connection and calls
-// proceed if succesfull.
-func (s *xhrPollingSocket) accept(w http.ResponseWriter, req *http.Request, proceed func()) (err os.Error) {
-	if s.connected {
-		return ErrConnected
+// Accepts a http connection & request pair. It calls proceed and waits until
+// the poll is answered.
+func (s *xhrPollingSocket) accept(w http.ResponseWriter, req *http.Request, proceed func()) (err error) {
+	if err = s.open(w, req, s.t.rtimeout, s.t.wtimeout); err != nil {
+		return
 	}
 
-	s.req = req
-	s.rwc, _, err = w.(http.Hijacker).Hijack()
-	if err == nil {
-		s.rwc.(*net.TCPConn).SetReadTimeout(s.t.rtimeout)
-		s.rwc.(*net.TCPConn).SetWriteTimeout(s.t.wtimeout)
-		s.connected = true
-		proceed()
-	}
+	proceed()
+	s.wait()
 	return
 }
 
-func (s *xhrPollingSocket) Read(p []byte) (int, os.Error) {
-	if !s.connected {
-		return 0, ErrNotConnected
-	}
-
-	return s.rwc.Read(p)
-}
-
-// Write sends a single message to the wire and closes the connection.
-func (s *xhrPollingSocket) Write(p []byte) (int, os.Error) {
-	if !s.connected {
-		return 0, ErrNotConnected
-	}
-
-	defer s.Close()
-
-	buf := new(bytes.Buffer)
-
-	buf.WriteString("HTTP/1.0 200 OK\r\n")
-	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
-	fmt.Fprintf(buf, "Content-Length: %d\r\n", len(p))
-
-	if origin := s.req.Header.Get("Origin"); origin != "" {
-		fmt.Fprintf(buf, "Access-Control-Allow-Origin: %s\r\n", origin)
-		buf.WriteString("Access-Control-Allow-Credentials: true\r\n")
-	}
-
-	buf.WriteString("\r\n")
-	buf.Write(p)
-
-	nr, err := buf.WriteTo(s.rwc)
-	return int(nr), err
-}
-
-func (s *xhrPollingSocket) Close() os.Error {
-	if !s.connected {
-		return ErrNotConnected
+// Write sends a single message as the response of the poll and ends it.
+func (s *xhrPollingSocket) Write(p []byte) (int, error) {
+	if err := s.respond("text/plain; charset=UTF-8", p); err != nil {
+		return 0, err
 	}
-
-	s.connected = false
-	return s.rwc.Close()
+	return len(p), nil
 }
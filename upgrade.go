@@ -0,0 +1,137 @@
+package socketio
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// The messages of the upgrade probe. They are exchanged as such, before the
+// probed socket carries any encoded messages.
+const (
+	upgradeProbe  = "probe"
+	upgradeCommit = "upgrade"
+)
+
+var (
+	// ErrUpgradeTransport is used when an upgrade is probed on a transport
+	// that can not carry the probe, e.g. a polling one.
+	ErrUpgradeTransport = errors.New("transport can not be upgraded to")
+
+	errUpgradeProbe = errors.New("unexpected upgrade probe")
+)
+
+// Upgrade takes over a GET request with the upgrade query parameter, which
+// probes a framed transport, e.g. websocket, for a session connected with
+// another transport, e.g. xhr-polling. The flow is:
+//
+//  1. The client opens the new transport for its session id with ?upgrade=1
+//     and sends "probe" through it.
+//  2. The server answers with "probe". Meanwhile the messages are still
+//     delivered through the old transport.
+//  3. The client stops polling and sends "upgrade" through the new transport.
+//  4. The server switches the connection to the new socket, ends the pending
+//     poll with an empty response, and resumes the delivery through the new
+//     socket with the messages the old one did not write.
+//
+// The flusher records and writes the messages while holding c.mutex, so
+// switching the socket under the same lock never splits a write between the
+// sockets. If the probe fails or does not complete within the
+// Config.UpgradeTimeout, the new socket is closed and the session carries on
+// with the old transport.
+func (c *Conn) upgrade(t Transport, w http.ResponseWriter, req *http.Request) (err error) {
+	s := t.newSocket()
+	if _, ok := s.(binarySocket); !ok {
+		return ErrUpgradeTransport
+	}
+
+	if err = s.accept(w, req, func() {}); err != nil {
+		return
+	}
+
+	// the hijacked request can not be answered with an error status anymore,
+	// so the failures are only logged from now on
+	var timer *time.Timer
+	if timeout := c.sio.config.UpgradeTimeout; timeout > 0 {
+		timer = time.AfterFunc(timeout, func() { s.Close() })
+	}
+
+	err = probeUpgrade(s)
+	if timer != nil && !timer.Stop() && err == nil {
+		err = ErrNotConnected
+	}
+	if err != nil {
+		c.log(LogInfo, "sio/conn: upgrade failed", "upgrade", "to", t.Resource(), LogKeyError, err)
+		s.Close()
+		return nil
+	}
+
+	c.mutex.Lock()
+
+	if c.disconnected {
+		c.mutex.Unlock()
+		s.Close()
+		return nil
+	}
+
+	old := c.socket
+	c.socket = s
+	c.publishLogAddr()
+	c.labelEvents()
+	c.online = true
+	c.lastConnected = time.Now()
+	c.sio.metrics.SocketOpened(t.Resource(), true)
+
+	var from string
+	if old != nil {
+		from = old.Transport().Resource()
+
+		// ends the pending poll, if there is one
+		old.Write(emptyResponse)
+		old.Close()
+	}
+
+	c.log(LogInfo, "sio/conn: upgraded", "upgraded", "from", from)
+
+	c.replay(req)
+	c.numConns++
+
+	select {
+	case c.wakeupFlusher <- 1:
+	default:
+	}
+
+	select {
+	case c.wakeupReader <- 1:
+	default:
+	}
+
+	c.mutex.Unlock()
+	return nil
+}
+
+// ProbeUpgrade answers the probe of the client and waits for it to commit the
+// upgrade.
+func probeUpgrade(s socket) error {
+	buf := make([]byte, len(upgradeCommit))
+
+	n, err := s.Read(buf)
+	if err != nil {
+		return err
+	}
+	if string(buf[:n]) != upgradeProbe {
+		return errUpgradeProbe
+	}
+
+	if _, err = s.Write([]byte(upgradeProbe)); err != nil {
+		return err
+	}
+
+	if n, err = s.Read(buf); err != nil {
+		return err
+	}
+	if string(buf[:n]) != upgradeCommit {
+		return errUpgradeProbe
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package socketio
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUpgrade(t *testing.T) {
+	sio, server, connected := testServer(t, nil)
+	received := make(chan string, 1)
+	sio.OnMessage(func(c *Conn, msg Message) {
+		received <- msg.Data()
+	})
+	addr := strings.TrimPrefix(server.URL, "http://")
+	sio.config.Origins = []string{addr}
+
+	poll(t, server.URL+"/socket.io/xhr-polling")
+	c := <-connected
+	sid := string(c.sessionid)
+
+	polled := make(chan string, 1)
+	go func() {
+		polled <- poll(t, server.URL+"/socket.io/xhr-polling/"+sid)
+	}()
+
+	// only the framed transports can be probed
+	resp, err := http.Get(server.URL + "/socket.io/xhr-polling/" + sid + "?upgrade=1")
+	if err != nil {
+		t.Fatal("Get:", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected the upgrade to xhr-polling to be rejected but got %d", resp.StatusCode)
+	}
+
+	ws, err := dialWebsocket("ws://"+addr+"/socket.io/websocket/"+sid+"?upgrade=1", server.URL, &DefaultWebsocketConfig)
+	if err != nil {
+		t.Fatal("dialWebsocket:", err)
+	}
+	defer ws.Close()
+
+	if err = ws.WriteMessage(websocketOpText, []byte(upgradeProbe)); err != nil {
+		t.Fatal("WriteMessage:", err)
+	}
+	if _, p, err := ws.ReadMessage(); err != nil || string(p) != upgradeProbe {
+		t.Fatalf("Expected the probe to be answered but got %q: %v", p, err)
+	}
+
+	// the session is still delivered through the polling
+	c.Send("a")
+	if body := <-polled; !strings.Contains(body, "3:::a") {
+		t.Fatalf("Expected the message to be polled but got %q", body)
+	}
+
+	// the client stopped polling, so the write fails until the upgrade
+	c.Send("b")
+	waitRecorded(t, c, 2)
+
+	if err = ws.WriteMessage(websocketOpText, []byte(upgradeCommit)); err != nil {
+		t.Fatal("WriteMessage:", err)
+	}
+
+	// c may be written or replayed along with b
+	c.Send("c")
+	var got []string
+	for !strings.Contains(strings.Join(got, ""), "3:::c") {
+		_, p, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatal("ReadMessage:", err)
+		}
+		got = append(got, string(p))
+	}
+	if all := strings.Join(got, ""); strings.Contains(all, "3:::a") || strings.Count(all, "3:::b") != 1 || strings.Count(all, "3:::c") != 1 {
+		t.Fatalf("Expected b and c exactly once through the websocket but got %q", got)
+	}
+
+	// the reader has switched to the websocket too
+	if err = ws.WriteMessage(websocketOpText, []byte(sio07Frame("3:::up"))); err != nil {
+		t.Fatal("WriteMessage:", err)
+	}
+	select {
+	case msg := <-received:
+		if msg != "up" {
+			t.Fatalf("Expected the server to receive up but got %q", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the server to read the upgraded socket")
+	}
+
+	c.mutex.Lock()
+	transport := c.socket.Transport().Resource()
+	c.mutex.Unlock()
+	if transport != "websocket" {
+		t.Fatalf("Expected the session to use the websocket but it uses %s", transport)
+	}
+}
@@ -7,11 +7,14 @@ import (
 
 type nopWriter struct{}
 
-func (nw nopWriter) Write(p []byte) (n int, err os.Error) {
+func (nw nopWriter) Write(p []byte) (n int, err error) {
 	return len(p), nil
 }
 
 var (
-	NOPLogger     = log.New(nopWriter{}, "", 0)
-	DefaultLogger = log.New(os.Stdout, "", log.Ldate|log.Ltime)
+	// NOPLogger discards all the events.
+	NOPLogger Logger = nopLogger{}
+
+	// DefaultLogger prints the events of LogInfo and above to the stdout.
+	DefaultLogger = NewStdLogger(log.New(os.Stdout, "", log.Ldate|log.Ltime), LogInfo)
 )
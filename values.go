@@ -0,0 +1,64 @@
+package socketio
+
+import (
+	"context"
+	"fmt"
+)
+
+// Context returns the context of the session. It is cancelled when the
+// session gets disconnected, so the handlers and the goroutines working on
+// behalf of the session can stop with it. The cause of the cancellation,
+// as returned by context.Cause, wraps ErrNotConnected and names the reason of
+// the disconnect, e.g. DisconnectReasonHeartbeat.
+func (c *Conn) Context() context.Context {
+	return c.ctx
+}
+
+// Set stores the value under the key for the lifetime of the connection,
+// replacing the previous value, if any. The values are still available in
+// the OnDisconnect callbacks. Set is safe for concurrent use.
+func (c *Conn) Set(key string, value interface{}) {
+	c.valuesLock.Lock()
+	defer c.valuesLock.Unlock()
+
+	if c.values == nil {
+		c.values = make(map[string]interface{})
+	}
+	c.values[key] = value
+}
+
+// Get returns the value stored under the key and whether there is one.
+func (c *Conn) Get(key string) (value interface{}, ok bool) {
+	c.valuesLock.RLock()
+	defer c.valuesLock.RUnlock()
+
+	value, ok = c.values[key]
+	return
+}
+
+// Delete removes the value stored under the key, if any.
+func (c *Conn) Delete(key string) {
+	c.valuesLock.Lock()
+	defer c.valuesLock.Unlock()
+
+	delete(c.values, key)
+}
+
+// ConnValue returns the value stored under the key of c if there is one of
+// type T, e.g.
+//
+//	user, ok := socketio.ConnValue[*User](c, "user")
+func ConnValue[T any](c *Conn, key string) (value T, ok bool) {
+	v, found := c.Get(key)
+	if !found {
+		return
+	}
+	value, ok = v.(T)
+	return
+}
+
+// DisconnectCause returns the cause the context of a connection is cancelled
+// with for the given reason.
+func disconnectCause(reason string) error {
+	return fmt.Errorf("%w: %s", ErrNotConnected, reason)
+}
@@ -0,0 +1,72 @@
+package socketio
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testUser struct {
+	name string
+}
+
+func TestConnValues(t *testing.T) {
+	config := DefaultConfig
+	config.Logger = NOPLogger
+	sio := NewSocketIO(&config)
+
+	var seen *testUser
+	sio.OnDisconnect(func(c *Conn) {
+		seen, _ = ConnValue[*testUser](c, "user")
+	})
+
+	c := connectedConn(t, sio)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c.Set("counter", i)
+			c.Get("counter")
+		}(i)
+	}
+	wg.Wait()
+
+	c.Set("user", &testUser{"alice"})
+	if u, ok := ConnValue[*testUser](c, "user"); !ok || u.name != "alice" {
+		t.Fatalf("Expected the user alice but got %v", u)
+	}
+	if _, ok := ConnValue[string](c, "user"); ok {
+		t.Fatal("Expected a value of another type to be missing")
+	}
+
+	c.Delete("counter")
+	if _, ok := c.Get("counter"); ok {
+		t.Fatal("Expected the deleted value to be missing")
+	}
+
+	ctx := c.Context()
+	stopped := make(chan struct{})
+	go func() {
+		<-ctx.Done()
+		close(stopped)
+	}()
+
+	c.Close()
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the context to be cancelled on disconnect")
+	}
+	if cause := context.Cause(ctx); !errors.Is(cause, ErrNotConnected) || !strings.Contains(cause.Error(), DisconnectReasonClosed) {
+		t.Fatalf("Expected the cause to name the reason but got %v", cause)
+	}
+	if seen == nil || seen.name != "alice" {
+		t.Fatalf("Expected the values to be available in OnDisconnect but got %v", seen)
+	}
+}
@@ -0,0 +1,900 @@
+package socketio
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// The websocket opcodes (RFC 6455, section 5.2).
+const (
+	websocketOpContinuation = 0x0
+	websocketOpText         = 0x1
+	websocketOpBinary       = 0x2
+	websocketOpClose        = 0x8
+	websocketOpPing         = 0x9
+	websocketOpPong         = 0xa
+)
+
+// The websocket close codes (RFC 6455, section 7.4.1).
+const (
+	WebsocketCloseNormal          = 1000
+	WebsocketCloseGoingAway       = 1001
+	WebsocketCloseProtocolError   = 1002
+	WebsocketCloseUnsupportedData = 1003
+	WebsocketCloseNoStatus        = 1005
+	WebsocketCloseInvalidPayload  = 1007
+	WebsocketClosePolicyViolation = 1008
+	WebsocketCloseMessageTooBig   = 1009
+	WebsocketCloseInternalError   = 1011
+)
+
+// The GUID used to compute the Sec-WebSocket-Accept header.
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// The tail that a sync flush leaves at the end of a deflated message.
+var deflateTail = []byte{0, 0, 0xff, 0xff}
+
+var (
+	errWebsocketHandshake = errors.New("websocket handshake error")
+	errWebsocketVersion   = errors.New("unsupported websocket version")
+)
+
+// WebsocketStatusError is returned by dialWebsocket when the server answers
+// the handshake with an error status.
+type websocketStatusError int
+
+func (e websocketStatusError) Error() string {
+	return "websocket handshake failed with status " + strconv.Itoa(int(e))
+}
+
+// WebsocketCloseError is returned when a websocket connection is closed with a
+// close frame, either by the peer or because the peer violated the protocol.
+type WebsocketCloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *WebsocketCloseError) Error() string {
+	return fmt.Sprintf("websocket closed with %d %s", e.Code, e.Reason)
+}
+
+// WebsocketConfig holds the settings of the websocket and flashsocket
+// transports.
+type WebsocketConfig struct {
+	// The period during which the client must send a frame, and the period
+	// during which a write must succeed. Zero means no timeout.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+
+	// Maximum payload size of a received frame, and of a written one: the
+	// larger messages are written in fragments. Zero means no limit.
+	MaxFrameSize int
+
+	// Maximum size of a received message, after the fragments have been
+	// joined and the message has been decompressed. Zero means no limit.
+	MaxMessageSize int
+
+	// Whether to negotiate the permessage-deflate extension (RFC 7692) with
+	// the clients offering it. The messages are compressed at the
+	// CompressionLevel, except for the ones smaller than the
+	// CompressionThreshold.
+	Compression          bool
+	CompressionLevel     int
+	CompressionThreshold int
+
+	// The interval between the pings sent to the client. Zero disables the
+	// pings.
+	PingInterval time.Duration
+
+	// Whether to accept the legacy hixie-75 and hixie-76 handshakes. The
+	// hixie connections carry only text frames.
+	AllowHixie bool
+}
+
+// DefaultWebsocketConfig holds the defaults of NewWebsocketTransport and
+// NewFlashsocketTransport.
+var DefaultWebsocketConfig = WebsocketConfig{
+	ReadTimeout:          0,
+	WriteTimeout:         5 * time.Second,
+	MaxFrameSize:         0,
+	MaxMessageSize:       32 << 20,
+	Compression:          true,
+	CompressionLevel:     flate.BestSpeed,
+	CompressionThreshold: 128,
+	PingInterval:         0,
+	AllowHixie:           false,
+}
+
+// WebsocketConn is one end of a websocket connection. It reads and writes
+// whole messages and handles the control frames. The writes are safe for
+// concurrent use, the reads are not.
+type websocketConn struct {
+	conn    net.Conn
+	br      *bufio.Reader
+	config  *WebsocketConfig
+	client  bool // Indicates if the frames written are masked.
+	hixie   bool // Indicates if the connection uses the hixie framing.
+	deflate bool // Indicates if permessage-deflate was negotiated.
+
+	wmutex    sync.Mutex // Serializes the writes.
+	closeSent bool       // Indicates if a close frame has been written.
+	fw        *flate.Writer
+	fbuf      bytes.Buffer
+	fr        io.ReadCloser
+}
+
+// ReadMessage reads the next text or binary message. It answers the pings and
+// the close frames on the way. If the peer closed the connection or violated
+// the protocol, a *WebsocketCloseError is returned.
+func (wc *websocketConn) ReadMessage() (op byte, p []byte, err error) {
+	if wc.hixie {
+		return wc.readHixieMessage()
+	}
+
+	var compressed, started bool
+
+	for {
+		fin, rsv1, fop, payload, err := wc.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch fop {
+		case websocketOpPing, websocketOpPong, websocketOpClose:
+			if !fin || rsv1 || len(payload) > 125 {
+				return 0, nil, wc.fail(WebsocketCloseProtocolError, "malformed control frame")
+			}
+
+			switch fop {
+			case websocketOpPing:
+				if err = wc.writeFrame(true, false, websocketOpPong, payload); err != nil {
+					return 0, nil, err
+				}
+
+			case websocketOpClose:
+				return 0, nil, wc.closed(payload)
+			}
+			continue
+
+		case websocketOpContinuation:
+			if !started || rsv1 {
+				return 0, nil, wc.fail(WebsocketCloseProtocolError, "unexpected continuation frame")
+			}
+
+		case websocketOpText, websocketOpBinary:
+			if started {
+				return 0, nil, wc.fail(WebsocketCloseProtocolError, "expected a continuation frame")
+			}
+			if rsv1 && !wc.deflate {
+				return 0, nil, wc.fail(WebsocketCloseProtocolError, "unexpected compressed frame")
+			}
+			started, op, compressed = true, fop, rsv1
+
+		default:
+			return 0, nil, wc.fail(WebsocketCloseProtocolError, "unknown opcode "+strconv.Itoa(int(fop)))
+		}
+
+		// a compressed message is limited before it is inflated too, so that
+		// the peer can not make it buffered without an end
+		if max := wc.config.MaxMessageSize; max > 0 && len(p)+len(payload) > max {
+			return 0, nil, wc.fail(WebsocketCloseMessageTooBig, "message too big")
+		}
+		p = append(p, payload...)
+
+		if fin {
+			break
+		}
+	}
+
+	if compressed {
+		if p, err = wc.inflate(p); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	if op == websocketOpText && !utf8.Valid(p) {
+		return 0, nil, wc.fail(WebsocketCloseInvalidPayload, "invalid utf-8")
+	}
+
+	return op, p, nil
+}
+
+// ReadFrame reads a single frame and unmasks its payload.
+func (wc *websocketConn) readFrame() (fin, rsv1 bool, op byte, payload []byte, err error) {
+	if t := wc.config.ReadTimeout; t > 0 {
+		wc.conn.SetReadDeadline(time.Now().Add(t))
+	}
+
+	var header [14]byte
+	if _, err = io.ReadFull(wc.br, header[:2]); err != nil {
+		return
+	}
+
+	fin = header[0]&0x80 != 0
+	rsv1 = header[0]&0x40 != 0
+	op = header[0] & 0x0f
+	masked := header[1]&0x80 != 0
+
+	if header[0]&0x30 != 0 {
+		err = wc.fail(WebsocketCloseProtocolError, "reserved bits set")
+		return
+	}
+	if masked == wc.client {
+		err = wc.fail(WebsocketCloseProtocolError, "invalid masking")
+		return
+	}
+
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		if _, err = io.ReadFull(wc.br, header[:2]); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(header[:2]))
+
+	case 127:
+		if _, err = io.ReadFull(wc.br, header[:8]); err != nil {
+			return
+		}
+		if length = binary.BigEndian.Uint64(header[:8]); length>>63 != 0 {
+			err = wc.fail(WebsocketCloseProtocolError, "invalid length")
+			return
+		}
+	}
+
+	if max := wc.config.MaxFrameSize; max > 0 && length > uint64(max) && op < websocketOpClose {
+		err = wc.fail(WebsocketCloseMessageTooBig, "frame too big")
+		return
+	}
+	if max := wc.config.MaxMessageSize; max > 0 && length > uint64(max) {
+		err = wc.fail(WebsocketCloseMessageTooBig, "message too big")
+		return
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err = io.ReadFull(wc.br, mask[:]); err != nil {
+			return
+		}
+	}
+
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(wc.br, payload); err != nil {
+		return
+	}
+
+	if masked {
+		maskBytes(mask, payload)
+	}
+	return
+}
+
+// Closed answers a close frame with the same code and closes the connection.
+func (wc *websocketConn) closed(payload []byte) error {
+	e := &WebsocketCloseError{Code: WebsocketCloseNoStatus}
+	if len(payload) >= 2 {
+		e.Code = int(binary.BigEndian.Uint16(payload))
+		e.Reason = string(payload[2:])
+	} else if len(payload) == 1 {
+		return wc.fail(WebsocketCloseProtocolError, "malformed close frame")
+	}
+
+	code := e.Code
+	if code == WebsocketCloseNoStatus {
+		code = WebsocketCloseNormal
+	}
+	wc.writeClose(code, "")
+	wc.conn.Close()
+	return e
+}
+
+// Fail closes the connection with the given code and reason and returns the
+// error describing it.
+func (wc *websocketConn) fail(code int, reason string) error {
+	wc.writeClose(code, reason)
+	wc.conn.Close()
+	return &WebsocketCloseError{code, reason}
+}
+
+// Close writes a normal close frame and closes the connection.
+func (wc *websocketConn) Close() error {
+	wc.writeClose(WebsocketCloseNormal, "")
+	return wc.conn.Close()
+}
+
+// WriteClose writes a close frame unless one has been written already.
+func (wc *websocketConn) writeClose(code int, reason string) error {
+	if wc.hixie {
+		wc.wmutex.Lock()
+		defer wc.wmutex.Unlock()
+
+		if wc.closeSent {
+			return nil
+		}
+		wc.closeSent = true
+		return wc.write([]byte{0xff, 0x00})
+	}
+
+	p := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(p, uint16(code))
+	p = append(p, reason...)
+	if len(p) > 125 {
+		p = p[:125]
+	}
+	return wc.writeFrame(true, false, websocketOpClose, p)
+}
+
+// WriteMessage writes a text or binary message. The message is compressed if
+// permessage-deflate was negotiated, and it is fragmented if it is larger than
+// the MaxFrameSize.
+func (wc *websocketConn) WriteMessage(op byte, p []byte) error {
+	if wc.hixie {
+		return wc.writeHixieMessage(op, p)
+	}
+
+	wc.wmutex.Lock()
+	defer wc.wmutex.Unlock()
+
+	compressed := false
+	if wc.deflate && len(p) >= wc.config.CompressionThreshold {
+		var err error
+		if p, err = wc.compress(p); err != nil {
+			return err
+		}
+		compressed = true
+	}
+
+	max := wc.config.MaxFrameSize
+	for first := true; ; first = false {
+		n := len(p)
+		if max > 0 && n > max {
+			n = max
+		}
+
+		fop := byte(websocketOpContinuation)
+		if first {
+			fop = op
+		}
+
+		if err := wc.writeFrameLocked(n == len(p), first && compressed, fop, p[:n]); err != nil {
+			return err
+		}
+
+		if p = p[n:]; len(p) == 0 {
+			return nil
+		}
+	}
+}
+
+// WriteFrame writes a single frame.
+func (wc *websocketConn) writeFrame(fin, rsv1 bool, op byte, payload []byte) error {
+	wc.wmutex.Lock()
+	defer wc.wmutex.Unlock()
+
+	return wc.writeFrameLocked(fin, rsv1, op, payload)
+}
+
+// WriteFrameLocked writes a single frame. The caller holds wc.wmutex.
+func (wc *websocketConn) writeFrameLocked(fin, rsv1 bool, op byte, payload []byte) error {
+	if wc.closeSent {
+		return ErrNotConnected
+	}
+	if op == websocketOpClose {
+		wc.closeSent = true
+	}
+
+	frame := make([]byte, 0, 14+len(payload))
+
+	b := op
+	if fin {
+		b |= 0x80
+	}
+	if rsv1 {
+		b |= 0x40
+	}
+	frame = append(frame, b)
+
+	var m byte
+	if wc.client {
+		m = 0x80
+	}
+
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, m|byte(n))
+	case n <= 0xffff:
+		frame = append(frame, m|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, m|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+
+	if wc.client {
+		var mask [4]byte
+		if _, err := io.ReadFull(rand.Reader, mask[:]); err != nil {
+			return err
+		}
+		frame = append(frame, mask[:]...)
+		start := len(frame)
+		frame = append(frame, payload...)
+		maskBytes(mask, frame[start:])
+	} else {
+		frame = append(frame, payload...)
+	}
+
+	return wc.write(frame)
+}
+
+// Write writes p to the connection within the WriteTimeout. The caller holds
+// wc.wmutex.
+func (wc *websocketConn) write(p []byte) error {
+	if t := wc.config.WriteTimeout; t > 0 {
+		wc.conn.SetWriteDeadline(time.Now().Add(t))
+	}
+	_, err := wc.conn.Write(p)
+	return err
+}
+
+// Ping writes a ping frame.
+func (wc *websocketConn) Ping() error {
+	if wc.hixie {
+		return nil
+	}
+	return wc.writeFrame(true, false, websocketOpPing, nil)
+}
+
+// Compress deflates p without the context takeover. The caller holds
+// wc.wmutex.
+func (wc *websocketConn) compress(p []byte) ([]byte, error) {
+	wc.fbuf.Reset()
+
+	var err error
+	if wc.fw == nil {
+		if wc.fw, err = flate.NewWriter(&wc.fbuf, wc.config.CompressionLevel); err != nil {
+			return nil, err
+		}
+	} else {
+		wc.fw.Reset(&wc.fbuf)
+	}
+
+	if _, err = wc.fw.Write(p); err != nil {
+		return nil, err
+	}
+	if err = wc.fw.Flush(); err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimSuffix(wc.fbuf.Bytes(), deflateTail), nil
+}
+
+// Inflate decompresses a message deflated without the context takeover.
+func (wc *websocketConn) inflate(p []byte) ([]byte, error) {
+	src := io.MultiReader(bytes.NewReader(p), bytes.NewReader(deflateTail))
+	if wc.fr == nil {
+		wc.fr = flate.NewReader(src)
+	} else {
+		wc.fr.(flate.Resetter).Reset(src, nil)
+	}
+
+	var r io.Reader = wc.fr
+	max := wc.config.MaxMessageSize
+	if max > 0 {
+		r = io.LimitReader(r, int64(max)+1)
+	}
+
+	out, err := io.ReadAll(r)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, wc.fail(WebsocketCloseInvalidPayload, "invalid compressed data")
+	}
+	if max > 0 && len(out) > max {
+		return nil, wc.fail(WebsocketCloseMessageTooBig, "message too big")
+	}
+	return out, nil
+}
+
+// MaskBytes masks or unmasks p with the key.
+func maskBytes(key [4]byte, p []byte) {
+	for i := range p {
+		p[i] ^= key[i&3]
+	}
+}
+
+// ReadHixieMessage reads a text frame of the hixie framing: 0x00, the UTF-8
+// data and 0xff. The length-prefixed frames are skipped.
+func (wc *websocketConn) readHixieMessage() (byte, []byte, error) {
+	for {
+		if t := wc.config.ReadTimeout; t > 0 {
+			wc.conn.SetReadDeadline(time.Now().Add(t))
+		}
+
+		typ, err := wc.br.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		if typ&0x80 == 0 {
+			var p []byte
+			for {
+				line, err := wc.br.ReadSlice(0xff)
+				p = append(p, line...)
+				if max := wc.config.MaxMessageSize; max > 0 && len(p) > max+1 {
+					return 0, nil, wc.fail(WebsocketCloseMessageTooBig, "message too big")
+				}
+
+				if err == nil {
+					return websocketOpText, p[:len(p)-1], nil
+				} else if err != bufio.ErrBufferFull {
+					return 0, nil, err
+				}
+			}
+		}
+
+		var length int64
+		for {
+			b, err := wc.br.ReadByte()
+			if err != nil {
+				return 0, nil, err
+			}
+			length = length<<7 | int64(b&0x7f)
+			if b&0x80 == 0 {
+				break
+			}
+		}
+
+		if typ == 0xff && length == 0 {
+			wc.writeClose(WebsocketCloseNormal, "")
+			wc.conn.Close()
+			return 0, nil, &WebsocketCloseError{Code: WebsocketCloseNormal}
+		}
+
+		if _, err = io.CopyN(io.Discard, wc.br, length); err != nil {
+			return 0, nil, err
+		}
+	}
+}
+
+// WriteHixieMessage writes a text frame of the hixie framing.
+func (wc *websocketConn) writeHixieMessage(op byte, p []byte) error {
+	if op != websocketOpText {
+		return errors.New("hixie websockets carry only text")
+	}
+
+	wc.wmutex.Lock()
+	defer wc.wmutex.Unlock()
+
+	if wc.closeSent {
+		return ErrNotConnected
+	}
+
+	frame := make([]byte, 0, len(p)+2)
+	frame = append(frame, 0x00)
+	frame = append(frame, p...)
+	frame = append(frame, 0xff)
+
+	return wc.write(frame)
+}
+
+// HeaderHasToken tells if the comma separated header contains the token.
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WebsocketAccept computes the Sec-WebSocket-Accept of the key.
+func websocketAccept(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// The permessage-deflate extension as negotiated by the server: neither end
+// keeps the compression context between the messages.
+const deflateExtension = "permessage-deflate; server_no_context_takeover; client_no_context_takeover"
+
+// AcceptDeflate tells if one of the permessage-deflate offers in h can be
+// accepted with deflateExtension.
+func acceptDeflate(h http.Header) bool {
+	for _, v := range h.Values("Sec-Websocket-Extensions") {
+	Offers:
+		for _, offer := range strings.Split(v, ",") {
+			params := strings.Split(offer, ";")
+			if strings.TrimSpace(params[0]) != "permessage-deflate" {
+				continue
+			}
+
+			for _, param := range params[1:] {
+				name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+				value = strings.Trim(strings.TrimSpace(value), `"`)
+
+				switch strings.TrimSpace(name) {
+				case "server_no_context_takeover", "client_no_context_takeover":
+
+				case "client_max_window_bits":
+					// the inflater handles any window size
+
+				case "server_max_window_bits":
+					// the deflater always uses the full window
+					if value != "15" {
+						continue Offers
+					}
+
+				default:
+					continue Offers
+				}
+			}
+
+			return true
+		}
+	}
+	return false
+}
+
+// UpgradeWebsocket performs the server side of the handshake of req and
+// hijacks the connection. It accepts the RFC 6455 handshake, and the hixie
+// ones if the config allows them. Nothing has been written to w if an error
+// is returned.
+func upgradeWebsocket(w http.ResponseWriter, req *http.Request, config *WebsocketConfig) (*websocketConn, error) {
+	if req.Method != "GET" || !strings.EqualFold(req.Header.Get("Upgrade"), "websocket") ||
+		!headerHasToken(req.Header, "Connection", "upgrade") {
+		return nil, errWebsocketHandshake
+	}
+
+	key := req.Header.Get("Sec-Websocket-Key")
+	if key == "" {
+		if config.AllowHixie {
+			return upgradeHixie(w, req, config)
+		}
+		return nil, errWebsocketHandshake
+	}
+
+	if req.Header.Get("Sec-Websocket-Version") != "13" {
+		return nil, errWebsocketVersion
+	}
+	if k, err := base64.StdEncoding.DecodeString(key); err != nil || len(k) != 16 {
+		return nil, errWebsocketHandshake
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, errWebsocketHandshake
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	wc := &websocketConn{conn: conn, br: rw.Reader, config: config}
+	wc.deflate = config.Compression && acceptDeflate(req.Header)
+
+	buf := new(bytes.Buffer)
+	buf.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	buf.WriteString("Upgrade: websocket\r\n")
+	buf.WriteString("Connection: Upgrade\r\n")
+	fmt.Fprintf(buf, "Sec-WebSocket-Accept: %s\r\n", websocketAccept(key))
+	if wc.deflate {
+		fmt.Fprintf(buf, "Sec-WebSocket-Extensions: %s\r\n", deflateExtension)
+	}
+	buf.WriteString("\r\n")
+
+	if _, err = conn.Write(buf.Bytes()); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return wc, nil
+}
+
+// UpgradeHixie performs the server side of the hixie-76 handshake, or of the
+// hixie-75 one if the request has no keys.
+func upgradeHixie(w http.ResponseWriter, req *http.Request, config *WebsocketConfig) (*websocketConn, error) {
+	key1, key2 := req.Header.Get("Sec-Websocket-Key1"), req.Header.Get("Sec-Websocket-Key2")
+	hixie76 := key1 != "" && key2 != ""
+
+	var challenge [16]byte
+	if hixie76 {
+		n1, ok1 := hixieKey(key1)
+		n2, ok2 := hixieKey(key2)
+		if !ok1 || !ok2 {
+			return nil, errWebsocketHandshake
+		}
+		binary.BigEndian.PutUint32(challenge[:4], n1)
+		binary.BigEndian.PutUint32(challenge[4:8], n2)
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, errWebsocketHandshake
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	if hixie76 {
+		// the 8 bytes of the key3 follow the headers
+		if _, err = io.ReadFull(rw.Reader, challenge[8:]); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	scheme := "ws"
+	if req.TLS != nil {
+		scheme = "wss"
+	}
+	location := scheme + "://" + req.Host + req.URL.RequestURI()
+
+	buf := new(bytes.Buffer)
+	if hixie76 {
+		buf.WriteString("HTTP/1.1 101 WebSocket Protocol Handshake\r\n")
+		buf.WriteString("Upgrade: WebSocket\r\n")
+		buf.WriteString("Connection: Upgrade\r\n")
+		fmt.Fprintf(buf, "Sec-WebSocket-Origin: %s\r\n", req.Header.Get("Origin"))
+		fmt.Fprintf(buf, "Sec-WebSocket-Location: %s\r\n", location)
+		if protocol := req.Header.Get("Sec-Websocket-Protocol"); protocol != "" {
+			fmt.Fprintf(buf, "Sec-WebSocket-Protocol: %s\r\n", protocol)
+		}
+		buf.WriteString("\r\n")
+		sum := md5.Sum(challenge[:])
+		buf.Write(sum[:])
+	} else {
+		buf.WriteString("HTTP/1.1 101 Web Socket Protocol Handshake\r\n")
+		buf.WriteString("Upgrade: WebSocket\r\n")
+		buf.WriteString("Connection: Upgrade\r\n")
+		fmt.Fprintf(buf, "WebSocket-Origin: %s\r\n", req.Header.Get("Origin"))
+		fmt.Fprintf(buf, "WebSocket-Location: %s\r\n", location)
+		buf.WriteString("\r\n")
+	}
+
+	if _, err = conn.Write(buf.Bytes()); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &websocketConn{conn: conn, br: rw.Reader, config: config, hixie: true}, nil
+}
+
+// HixieKey computes the number of a hixie-76 key: the digits of the key as a
+// number divided by the number of the spaces in it.
+func hixieKey(key string) (uint32, bool) {
+	var n uint64
+	spaces := 0
+	for _, r := range key {
+		switch {
+		case r >= '0' && r <= '9':
+			n = n*10 + uint64(r-'0')
+		case r == ' ':
+			spaces++
+		}
+	}
+
+	if spaces == 0 || n%uint64(spaces) != 0 || n/uint64(spaces) > 0xffffffff {
+		return 0, false
+	}
+	return uint32(n / uint64(spaces)), true
+}
+
+// DialWebsocket performs the client side of the RFC 6455 handshake with the
+// server at rawurl. It offers the permessage-deflate extension if the config
+// enables the compression.
+func dialWebsocket(rawurl, origin string, config *WebsocketConfig) (*websocketConn, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		if u.Scheme == "wss" {
+			host += ":443"
+		} else {
+			host += ":80"
+		}
+	}
+
+	var conn net.Conn
+	switch u.Scheme {
+	case "ws":
+		conn, err = net.Dial("tcp", host)
+	case "wss":
+		conn, err = tls.Dial("tcp", host, &tls.Config{ServerName: u.Hostname()})
+	default:
+		return nil, errors.New("unsupported websocket scheme " + u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var k [16]byte
+	if _, err = io.ReadFull(rand.Reader, k[:]); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(k[:])
+
+	req := &http.Request{
+		Method:     "GET",
+		URL:        u,
+		Host:       u.Host,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			"Upgrade":               {"websocket"},
+			"Connection":            {"Upgrade"},
+			"Sec-Websocket-Key":     {key},
+			"Sec-Websocket-Version": {"13"},
+		},
+	}
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	if config.Compression {
+		req.Header.Set("Sec-Websocket-Extensions", "permessage-deflate; server_no_context_takeover; client_no_context_takeover")
+	}
+
+	if err = req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		conn.Close()
+		return nil, websocketStatusError(resp.StatusCode)
+	}
+	if resp.Header.Get("Sec-Websocket-Accept") != websocketAccept(key) {
+		conn.Close()
+		return nil, errWebsocketHandshake
+	}
+
+	wc := &websocketConn{conn: conn, br: br, config: config, client: true}
+
+	if ext := resp.Header.Get("Sec-Websocket-Extensions"); ext != "" {
+		params := strings.Split(ext, ";")
+		if !config.Compression || strings.TrimSpace(params[0]) != "permessage-deflate" {
+			conn.Close()
+			return nil, errWebsocketHandshake
+		}
+		for _, param := range params[1:] {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if name == "client_max_window_bits" && strings.Trim(value, `"`) != "15" {
+				conn.Close()
+				return nil, errWebsocketHandshake
+			}
+		}
+		wc.deflate = true
+	}
+
+	return wc, nil
+}
@@ -0,0 +1,341 @@
+package socketio
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// WebsocketPipe returns the server and client ends of an in-memory websocket
+// connection.
+func websocketPipe(server, client WebsocketConfig) (*websocketConn, *websocketConn) {
+	a, b := net.Pipe()
+	return &websocketConn{conn: a, br: bufio.NewReader(a), config: &server, deflate: server.Compression},
+		&websocketConn{conn: b, br: bufio.NewReader(b), config: &client, deflate: client.Compression, client: true}
+}
+
+func TestWebsocketMessages(t *testing.T) {
+	long := bytes.Repeat([]byte("socket.io "), 100)
+
+	tests := []struct {
+		name   string
+		config WebsocketConfig
+		op     byte
+		data   []byte
+	}{
+		{"text", WebsocketConfig{}, websocketOpText, []byte("hello")},
+		{"binary", WebsocketConfig{}, websocketOpBinary, []byte{0, 0xff, 0xfe}},
+		{"empty", WebsocketConfig{}, websocketOpText, []byte{}},
+		{"fragmented", WebsocketConfig{MaxFrameSize: 64}, websocketOpText, long},
+		{"compressed", WebsocketConfig{Compression: true, CompressionLevel: 1}, websocketOpText, long},
+		{"compressed fragments", WebsocketConfig{Compression: true, CompressionLevel: 1, MaxFrameSize: 8}, websocketOpBinary, long},
+	}
+
+	for _, test := range tests {
+		server, client := websocketPipe(test.config, test.config)
+
+		for _, pair := range [][2]*websocketConn{{client, server}, {server, client}} {
+			w, r := pair[0], pair[1]
+
+			errc := make(chan error, 1)
+			go func() {
+				errc <- w.WriteMessage(test.op, test.data)
+			}()
+
+			op, p, err := r.ReadMessage()
+			if err != nil {
+				t.Fatalf("%s: ReadMessage: %s", test.name, err)
+			}
+			if err = <-errc; err != nil {
+				t.Fatalf("%s: WriteMessage: %s", test.name, err)
+			}
+			if op != test.op || !bytes.Equal(p, test.data) {
+				t.Fatalf("%s: expected %d %q but got %d %q", test.name, test.op, test.data, op, p)
+			}
+		}
+
+		server.conn.Close()
+		client.conn.Close()
+	}
+}
+
+func TestWebsocketCompressedFrames(t *testing.T) {
+	config := WebsocketConfig{Compression: true, CompressionLevel: 1}
+	server, client := websocketPipe(config, config)
+	defer server.conn.Close()
+
+	data := bytes.Repeat([]byte("a"), 1000)
+	go client.WriteMessage(websocketOpText, data)
+
+	fin, rsv1, op, payload, err := server.readFrame()
+	if err != nil {
+		t.Fatal("readFrame:", err)
+	}
+	if !fin || !rsv1 || op != websocketOpText || len(payload) >= len(data) {
+		t.Fatalf("expected a single compressed frame, got fin=%v rsv1=%v op=%d len=%d", fin, rsv1, op, len(payload))
+	}
+
+	if p, err := server.inflate(payload); err != nil || !bytes.Equal(p, data) {
+		t.Fatalf("expected the frame to inflate to the message, got %d bytes: %v", len(p), err)
+	}
+}
+
+func TestWebsocketClose(t *testing.T) {
+	tests := []struct {
+		name   string
+		config WebsocketConfig
+		frames func(*websocketConn)
+		code   int
+	}{
+		{"too big", WebsocketConfig{MaxMessageSize: 8}, func(c *websocketConn) {
+			c.WriteMessage(websocketOpText, []byte("0123456789"))
+		}, WebsocketCloseMessageTooBig},
+		{"too big fragments", WebsocketConfig{MaxMessageSize: 8}, func(c *websocketConn) {
+			c.writeFrame(false, false, websocketOpText, []byte("01234"))
+			c.writeFrame(true, false, websocketOpContinuation, []byte("56789"))
+		}, WebsocketCloseMessageTooBig},
+		{"too big compressed fragments", WebsocketConfig{Compression: true, MaxMessageSize: 100}, func(c *websocketConn) {
+			junk := bytes.Repeat([]byte{0xff}, 90)
+			if c.writeFrame(false, true, websocketOpText, junk) != nil {
+				return
+			}
+			for i := 0; i < 1000; i++ {
+				if c.writeFrame(false, false, websocketOpContinuation, junk) != nil {
+					return
+				}
+			}
+		}, WebsocketCloseMessageTooBig},
+		{"frame too big", WebsocketConfig{MaxFrameSize: 4}, func(c *websocketConn) {
+			c.WriteMessage(websocketOpBinary, []byte("01234"))
+		}, WebsocketCloseMessageTooBig},
+		{"invalid utf-8", WebsocketConfig{}, func(c *websocketConn) {
+			c.WriteMessage(websocketOpText, []byte{0xff, 0xfe})
+		}, WebsocketCloseInvalidPayload},
+		{"unexpected continuation", WebsocketConfig{}, func(c *websocketConn) {
+			c.writeFrame(true, false, websocketOpContinuation, []byte("a"))
+		}, WebsocketCloseProtocolError},
+		{"fragmented ping", WebsocketConfig{}, func(c *websocketConn) {
+			c.writeFrame(false, false, websocketOpPing, nil)
+		}, WebsocketCloseProtocolError},
+		{"unnegotiated compression", WebsocketConfig{}, func(c *websocketConn) {
+			c.writeFrame(true, true, websocketOpText, []byte("a"))
+		}, WebsocketCloseProtocolError},
+		{"peer close", WebsocketConfig{}, func(c *websocketConn) {
+			c.writeClose(WebsocketCloseGoingAway, "bye")
+		}, WebsocketCloseGoingAway},
+	}
+
+	for _, test := range tests {
+		server, client := websocketPipe(test.config, WebsocketConfig{})
+
+		go test.frames(client)
+
+		// the client reads the close frame the server answers with
+		closed := make(chan error, 1)
+		go func() {
+			for {
+				if _, _, err := client.ReadMessage(); err != nil {
+					closed <- err
+					return
+				}
+			}
+		}()
+
+		_, _, err := server.ReadMessage()
+		var ce *WebsocketCloseError
+		if !errors.As(err, &ce) || ce.Code != test.code {
+			t.Fatalf("%s: expected the server to close with %d but got %v", test.name, test.code, err)
+		}
+
+		err = <-closed
+		if !errors.As(err, &ce) || ce.Code != test.code {
+			t.Fatalf("%s: expected the client to receive %d but got %v", test.name, test.code, err)
+		}
+	}
+}
+
+func TestWebsocketPing(t *testing.T) {
+	server, client := websocketPipe(WebsocketConfig{}, WebsocketConfig{})
+	defer server.conn.Close()
+
+	go server.ReadMessage()
+
+	go client.writeFrame(true, false, websocketOpPing, []byte("are you there"))
+
+	fin, _, op, payload, err := client.readFrame()
+	if err != nil {
+		t.Fatal("readFrame:", err)
+	}
+	if !fin || op != websocketOpPong || string(payload) != "are you there" {
+		t.Fatalf("expected a pong with the payload of the ping, got %d %q", op, payload)
+	}
+}
+
+func TestWebsocketAcceptDeflate(t *testing.T) {
+	tests := []struct {
+		offer  string
+		accept bool
+	}{
+		{"", false},
+		{"x-webkit-deflate-frame", false},
+		{"permessage-deflate", true},
+		{"permessage-deflate; client_max_window_bits", true},
+		{"permessage-deflate; server_max_window_bits=10", false},
+		{"permessage-deflate; server_max_window_bits=10, permessage-deflate", true},
+		{`permessage-deflate; server_max_window_bits="15"; client_no_context_takeover`, true},
+		{"permessage-deflate; unknown", false},
+	}
+
+	for _, test := range tests {
+		h := http.Header{}
+		if test.offer != "" {
+			h.Set("Sec-WebSocket-Extensions", test.offer)
+		}
+		if accept := acceptDeflate(h); accept != test.accept {
+			t.Errorf("%q: expected %v but got %v", test.offer, test.accept, accept)
+		}
+	}
+}
+
+func TestWebsocketHandshake(t *testing.T) {
+	config := DefaultWebsocketConfig
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		wc, err := upgradeWebsocket(w, req, &config)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		defer wc.Close()
+
+		if op, p, err := wc.ReadMessage(); err == nil {
+			wc.WriteMessage(op, p)
+		}
+	}))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	config.Compression = false
+	client, err := dialWebsocket(url, server.URL, &config)
+	if err != nil {
+		t.Fatal("dialWebsocket:", err)
+	}
+	if client.deflate {
+		t.Fatal("expected no compression when it is not offered")
+	}
+	client.Close()
+
+	config.Compression = true
+	if client, err = dialWebsocket(url, server.URL, &config); err != nil {
+		t.Fatal("dialWebsocket:", err)
+	}
+	defer client.Close()
+	if !client.deflate {
+		t.Fatal("expected the compression to be negotiated")
+	}
+
+	data := bytes.Repeat([]byte("compressed "), 100)
+	if err = client.WriteMessage(websocketOpText, data); err != nil {
+		t.Fatal("WriteMessage:", err)
+	}
+	if _, p, err := client.ReadMessage(); err != nil || !bytes.Equal(p, data) {
+		t.Fatalf("expected the message to be echoed, got %q: %v", p, err)
+	}
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	req.Header.Set("Sec-WebSocket-Version", "8")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal("Do:", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected an unsupported version to be rejected, got %d", resp.StatusCode)
+	}
+}
+
+func TestWebsocketAccept(t *testing.T) {
+	// the example of RFC 6455, section 1.3
+	if accept := websocketAccept("dGhlIHNhbXBsZSBub25jZQ=="); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("unexpected Sec-WebSocket-Accept %q", accept)
+	}
+}
+
+func TestWebsocketHixie76(t *testing.T) {
+	config := DefaultWebsocketConfig
+	config.AllowHixie = true
+
+	received := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		wc, err := upgradeWebsocket(w, req, &config)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		defer wc.Close()
+
+		if wc.WriteMessage(websocketOpBinary, []byte("binary")) == nil {
+			t.Error("expected a hixie connection to refuse binary messages")
+		}
+		wc.WriteMessage(websocketOpText, []byte("hello"))
+
+		if _, p, err := wc.ReadMessage(); err == nil {
+			received <- string(p)
+		}
+	}))
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal("Dial:", err)
+	}
+	defer conn.Close()
+
+	// the example of draft-ietf-hybi-thewebsocketprotocol-00, section 1.3
+	io.WriteString(conn, "GET /demo HTTP/1.1\r\n"+
+		"Host: example.com\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Sec-WebSocket-Key2: 12998 5 Y3 1  .P00\r\n"+
+		"Sec-WebSocket-Protocol: sample\r\n"+
+		"Upgrade: WebSocket\r\n"+
+		"Sec-WebSocket-Key1: 4 @1  46546xW%0l 1 5\r\n"+
+		"Origin: http://example.com\r\n"+
+		"\r\n"+
+		"^n:ds[4U")
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal("ReadResponse:", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Location") != "ws://example.com/demo" {
+		t.Fatalf("unexpected response %d %v", resp.StatusCode, resp.Header)
+	}
+
+	var challenge [16]byte
+	if _, err = io.ReadFull(br, challenge[:]); err != nil {
+		t.Fatal("ReadFull:", err)
+	}
+	if string(challenge[:]) != "8jKS'y:G*Co,Wxa-" {
+		t.Fatalf("unexpected challenge response %q", challenge)
+	}
+
+	frame, err := br.ReadString(0xff)
+	if err != nil || frame != "\x00hello\xff" {
+		t.Fatalf("expected a hixie text frame, got %q: %v", frame, err)
+	}
+
+	io.WriteString(conn, "\x00hi\xff")
+	if p := <-received; p != "hi" {
+		t.Fatalf("expected the server to receive hi, got %q", p)
+	}
+}